@@ -0,0 +1,147 @@
+package multiflight
+
+import (
+	"context"
+	"sort"
+	"time"
+)
+
+// WithBatchWindow queues the keys calls have to load for d and loads the
+// keys queued in that window together, so calls of the same loader
+// arriving close to each other share loader calls even for distinct
+// keys. With
+// WithMaxBatchSize a window dispatches at most that many keys, chosen by
+// priority (see WithPriority), and the rest wait for the next window.
+//
+// The keys of a window are loaded with one loader call per loader, the
+// default loader of DoDefault or the loader of the calls passing the
+// same WithBatchKey, with the context of the first call, which carries
+// its values but is never cancelled; use WithLoadTimeout to bound such
+// loads. The keys of other calls are loaded with a loader call of their
+// own at the end of the window.
+func WithBatchWindow[K comparable, V any](d time.Duration) Option[K, V] {
+	return func(o *options[K, V]) {
+		o.batchWindow = d
+	}
+}
+
+// WithPriority sets the priority of the keys a call queues in a batch
+// window, higher first; the default is 0. Queued keys gain one level of
+// priority for every dispatch that leaves them behind, so low priority
+// keys are never starved.
+func WithPriority(p int) CallOption {
+	return func(co *callOptions) {
+		co.priority = p
+	}
+}
+
+// WithBatchKey identifies the loader of a call for WithBatchWindow: the
+// calls passing equal keys share loader calls within a window, made with
+// the loader of the first of them. key must be comparable, e.g. the name
+// of the loader.
+func WithBatchKey(key any) CallOption {
+	return func(co *callOptions) {
+		co.source = key
+	}
+}
+
+// queued is a key waiting in the batch window.
+type queued[K comparable, V any] struct {
+	e        *ent[K, V]
+	ctx      context.Context
+	load     loadFunc[K, V]
+	priority int // aged by one level for every dispatch missed
+	seq      uint64
+}
+
+// enqueue queues ents, to load with load of the given source, for the
+// next dispatch of the batch window. Without a source, ents share no
+// loader call with other calls.
+func (g *Group[K, V]) enqueue(ctx context.Context, ents []*ent[K, V], load loadFunc[K, V], source any, priority int) {
+	ctx = detach(ctx)
+	if source == nil {
+		source = new(int) // a source of their own
+	}
+	g.withLock(func() {
+		for _, e := range ents {
+			e.source = source
+			g.queueSeq++
+			g.queue = append(g.queue, &queued[K, V]{e: e, ctx: ctx, load: load, priority: priority, seq: g.queueSeq})
+		}
+		if g.window == nil {
+			g.window = time.AfterFunc(g.opts.batchWindow, g.dispatch)
+		}
+	})
+}
+
+// dispatch loads the queued keys when the batch window closes, one
+// loader call per loader, keeping those that don't fit in the batch for
+// the next window.
+func (g *Group[K, V]) dispatch() {
+	var loads []*queued[K, V] // the first key of every loader, with all its keys
+	by := make(map[any][]*ent[K, V])
+	g.withLock(func() {
+		g.window = nil
+
+		batch := g.queue
+		if size := g.opts.maxBatchSize; size > 0 && len(batch) > size {
+			g.sortQueue()
+			batch = g.queue[:size:size]
+			g.queue = append(g.queue[:0:0], g.queue[size:]...)
+			for _, q := range g.queue {
+				q.priority++
+			}
+			g.window = time.AfterFunc(g.opts.batchWindow, g.dispatch)
+		} else {
+			g.queue = nil
+		}
+
+		for _, q := range batch {
+			if _, has := by[q.e.source]; !has {
+				loads = append(loads, q)
+			}
+			by[q.e.source] = append(by[q.e.source], q.e)
+		}
+	})
+
+	for i, q := range loads {
+		if i < len(loads)-1 {
+			go g.runLoad(q.ctx, by[q.e.source], q.load)
+		} else {
+			g.runLoad(q.ctx, by[q.e.source], q.load)
+		}
+	}
+}
+
+// sortQueue orders the queue by priority, then by arrival.
+// Must be called with g.mu held.
+func (g *Group[K, V]) sortQueue() {
+	sort.Slice(g.queue, func(i, j int) bool {
+		if g.queue[i].priority != g.queue[j].priority {
+			return g.queue[i].priority > g.queue[j].priority
+		}
+		return g.queue[i].seq < g.queue[j].seq
+	})
+}
+
+// detached is a context with the values of its parent that is never
+// cancelled.
+type detached struct {
+	context.Context
+}
+
+func detach(ctx context.Context) context.Context {
+	return detached{ctx}
+}
+
+func (detached) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (detached) Done() <-chan struct{} {
+	return nil
+}
+
+func (detached) Err() error {
+	return nil
+}
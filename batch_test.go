@@ -0,0 +1,182 @@
+package multiflight
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBatchWindow(t *testing.T) {
+	const WorkerNum = 10
+
+	var mu sync.Mutex
+	var batches [][]int
+	loader := func(ctx context.Context, keys []int) (map[int]string, error) {
+		mu.Lock()
+		batches = append(batches, keys)
+		mu.Unlock()
+		resuts := make(map[int]string, len(keys))
+		for _, k := range keys {
+			resuts[k] = fmt.Sprintf("val: %d", k)
+		}
+		return resuts, nil
+	}
+
+	ast := assert.New(t)
+	g := NewGroup(
+		WithBatchWindow[int, string](time.Millisecond*20),
+		WithDefaultLoader[int, string](loader),
+	)
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < WorkerNum; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			results, err := g.DoDefault(context.Background(), []int{i})
+			ast.Nil(err)
+			ast.Equal(map[int]string{i: fmt.Sprintf("val: %d", i)}, results)
+		}(i)
+	}
+	wg.Wait()
+
+	// distinct keys of concurrent calls of the default loader share the
+	// loader call
+	ast.Len(batches, 1)
+	ast.Len(batches[0], WorkerNum)
+	ast.Equal(0, g.Len())
+}
+
+func TestBatchWindowPriority(t *testing.T) {
+	var mu sync.Mutex
+	var batches [][]int
+	loader := func(ctx context.Context, keys []int) (map[int]string, error) {
+		mu.Lock()
+		batches = append(batches, keys)
+		mu.Unlock()
+		resuts := make(map[int]string, len(keys))
+		for _, k := range keys {
+			resuts[k] = fmt.Sprintf("val: %d", k)
+		}
+		return resuts, nil
+	}
+
+	ast := assert.New(t)
+	g := NewGroup(
+		WithBatchWindow[int, string](time.Millisecond*50),
+		WithMaxBatchSize[int, string](2),
+	)
+
+	wg := sync.WaitGroup{}
+	do := func(keys []int, opts ...CallOption) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results, err := g.Do(context.Background(), keys, loader, append(opts, WithBatchKey("load"))...)
+			ast.Nil(err)
+			ast.Len(results, len(keys))
+		}()
+	}
+
+	do([]int{1, 2, 3})
+	ast.Eventually(func() bool { return g.Stats().Waiters == 3 }, time.Second, time.Millisecond)
+	// submitted later, but still makes the first dispatch
+	do([]int{10}, WithPriority(1))
+	wg.Wait()
+
+	ast.Equal([][]int{{10, 1}, {2, 3}}, batches)
+}
+
+func TestBatchWindowAging(t *testing.T) {
+	var mu sync.Mutex
+	var batches [][]int
+	loader := func(ctx context.Context, keys []int) (map[int]string, error) {
+		mu.Lock()
+		batches = append(batches, keys)
+		mu.Unlock()
+		return map[int]string{}, nil
+	}
+	dispatched := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(batches)
+	}
+
+	ast := assert.New(t)
+	g := NewGroup(
+		WithBatchWindow[int, string](time.Millisecond*20),
+		WithMaxBatchSize[int, string](1),
+	)
+
+	wg := sync.WaitGroup{}
+	do := func(keys []int, opts ...CallOption) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := g.Do(context.Background(), keys, loader, append(opts, WithBatchKey("load"))...)
+			ast.Nil(err)
+		}()
+	}
+
+	do([]int{1, 2})
+	ast.Eventually(func() bool { return g.Stats().Waiters == 2 }, time.Second, time.Millisecond)
+	do([]int{10}, WithPriority(1))
+	ast.Eventually(func() bool { return dispatched() == 2 }, time.Second, time.Millisecond)
+
+	// 2 was left behind twice, so it now beats 11
+	do([]int{11}, WithPriority(1))
+	wg.Wait()
+
+	ast.Equal([][]int{{10}, {1}, {2}, {11}}, batches)
+}
+
+func TestBatchWindowLoaders(t *testing.T) {
+	var mu sync.Mutex
+	batches := map[string][][]int{}
+	loaderOf := func(name string) Loader[int, string] {
+		return func(ctx context.Context, keys []int) (map[int]string, error) {
+			mu.Lock()
+			batches[name] = append(batches[name], keys)
+			mu.Unlock()
+			resuts := make(map[int]string, len(keys))
+			for _, k := range keys {
+				resuts[k] = fmt.Sprintf("%s: %d", name, k)
+			}
+			return resuts, nil
+		}
+	}
+	a, b, c := loaderOf("a"), loaderOf("b"), loaderOf("c")
+
+	ast := assert.New(t)
+	g := NewGroup(WithBatchWindow[int, string](time.Millisecond * 20))
+
+	// the calls of each batch key share a loader call of their own, and
+	// calls without one share none
+	wg := sync.WaitGroup{}
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			load, name, opts := a, "a", []CallOption{WithBatchKey("a")}
+			switch i % 3 {
+			case 1:
+				load, name, opts = b, "b", []CallOption{WithBatchKey("b")}
+			case 2:
+				load, name, opts = c, "c", nil
+			}
+			results, err := g.Do(context.Background(), []int{i}, load, opts...)
+			ast.Nil(err)
+			ast.Equal(map[int]string{i: fmt.Sprintf("%s: %d", name, i)}, results)
+		}(i)
+	}
+	wg.Wait()
+	ast.Len(batches["a"], 1)
+	ast.ElementsMatch([]int{0, 3}, batches["a"][0])
+	ast.Len(batches["b"], 1)
+	ast.ElementsMatch([]int{1, 4}, batches["b"][0])
+	ast.Len(batches["c"], 2)
+}
@@ -0,0 +1,51 @@
+package multiflight
+
+import (
+	"context"
+	"sort"
+	"sync/atomic"
+)
+
+type batchIDKey struct{}
+
+// BatchIDFromContext returns the ID of the loader call ctx, or a context
+// derived from it, is passed to, e.g. for the loader to log it. The IDs
+// number the loader calls of a group, retries and revalidations
+// included; they are the IDs of Hooks, CallStats.BatchIDs and of the
+// logs of WithLogger, so that one ID ties the logs of a loader call to
+// those of the callers it served.
+func BatchIDFromContext(ctx context.Context) (uint64, bool) {
+	id, ok := ctx.Value(batchIDKey{}).(uint64)
+	return id, ok
+}
+
+// nextBatch numbers a new loader call of ents and returns its context.
+func (g *Group[K, V]) nextBatch(ctx context.Context, ents []*ent[K, V]) (context.Context, uint64) {
+	id := atomic.AddUint64(&g.batches, 1)
+	for _, e := range ents {
+		atomic.StoreUint64(&e.batch, id)
+	}
+	return context.WithValue(ctx, batchIDKey{}, id), id
+}
+
+// batchIDs returns the IDs of the loader calls that completed the
+// completed entries of ents, in ascending order.
+func batchIDs[K comparable, V any](ents []*ent[K, V]) []uint64 {
+	var ids []uint64
+	seen := make(map[uint64]struct{}, len(ents))
+	for _, e := range ents {
+		select {
+		case <-e.done:
+		default:
+			continue
+		}
+		id := atomic.LoadUint64(&e.batch)
+		if _, has := seen[id]; has || id == 0 {
+			continue
+		}
+		seen[id] = struct{}{}
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+	return ids
+}
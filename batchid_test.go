@@ -0,0 +1,83 @@
+package multiflight
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBatchID(t *testing.T) {
+	errBoom := errors.New("boom")
+	var (
+		mu     sync.Mutex
+		loaded = map[int][]uint64{} // batch IDs by key
+	)
+	release := make(chan struct{})
+	loader := func(ctx context.Context, keys []int) (map[int]string, error) {
+		id, ok := BatchIDFromContext(ctx)
+		mu.Lock()
+		for _, k := range keys {
+			if ok {
+				loaded[k] = append(loaded[k], id)
+			}
+		}
+		retry := keys[0] == 3 && len(loaded[3]) == 1
+		mu.Unlock()
+		if keys[0] == 1 {
+			<-release
+		}
+		if retry {
+			return nil, errBoom
+		}
+		return map[int]string{keys[0]: fmt.Sprint(keys[0])}, nil
+	}
+	var started []uint64
+	hooks := Hooks[int, string]{OnLoadStart: func(id uint64, keys []int) {
+		mu.Lock()
+		started = append(started, id)
+		mu.Unlock()
+	}}
+
+	ast := assert.New(t)
+	g := NewGroup(
+		WithMaxBatchSize[int, string](1),
+		WithRetry[int, string](2, func(int) time.Duration { return 0 }, nil),
+		WithHooks(hooks),
+	)
+	_, ok := BatchIDFromContext(context.Background())
+	ast.False(ok)
+
+	leader := make(chan CallStats, 1)
+	go func() {
+		_, cs, err := g.DoStats(context.Background(), []int{1}, loader)
+		ast.Nil(err)
+		leader <- cs
+	}()
+	ast.Eventually(func() bool { return g.Len() == 1 }, time.Second, time.Millisecond)
+	go func() {
+		ast.Eventually(func() bool { return g.Stats().SharedKeys == 1 }, time.Second, time.Millisecond)
+		close(release)
+	}()
+	_, cs, err := g.DoStats(context.Background(), []int{1, 2, 3}, loader)
+	ast.Nil(err)
+
+	// the callers report the IDs the loader sees, the last attempt of a
+	// retried key included
+	mu.Lock()
+	defer mu.Unlock()
+	ast.Equal([]uint64{1}, loaded[1])
+	ast.Len(loaded[2], 1)
+	ast.Len(loaded[3], 2)
+	ast.Equal([]uint64{1}, (<-leader).BatchIDs)
+	ids := []uint64{1, loaded[2][0], loaded[3][1]}
+	if ids[1] > ids[2] {
+		ids[1], ids[2] = ids[2], ids[1]
+	}
+	ast.Equal(ids, cs.BatchIDs)
+	ast.ElementsMatch([]uint64{1, 2, 3, 4}, started)
+}
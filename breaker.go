@@ -0,0 +1,196 @@
+package multiflight
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned for keys whose load was refused by the
+// circuit breaker.
+var ErrCircuitOpen = errors.New("multiflight: circuit open")
+
+// Breaker decides whether loader calls may go to the backend.
+type Breaker interface {
+	// Allow reports whether a loader call may be dispatched now.
+	Allow() bool
+	// Record reports the outcome of a call that was allowed.
+	Record(err error)
+}
+
+// WithBreaker consults b before every loader call. When b refuses it,
+// the keys of the call fail with ErrCircuitOpen right away and are
+// removed from the group, so later calls reach the breaker again.
+func WithBreaker[K comparable, V any](b Breaker) Option[K, V] {
+	return func(o *options[K, V]) {
+		o.breaker = b
+	}
+}
+
+type breakerState int
+
+const (
+	breakerClosed breakerState = iota
+	breakerOpen
+	breakerHalfOpen
+)
+
+// ConsecutiveBreaker is a Breaker that opens after a number of
+// consecutive failed loads. Once the cooldown has passed it lets a
+// single probe through: success closes it again, failure reopens it.
+type ConsecutiveBreaker struct {
+	threshold int
+	cooldown  time.Duration
+	now       func() time.Time
+
+	mu       sync.Mutex // protects the fields below
+	state    breakerState
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// NewConsecutiveBreaker returns a breaker that opens after threshold
+// consecutive failures and probes again after cooldown.
+func NewConsecutiveBreaker(threshold int, cooldown time.Duration) *ConsecutiveBreaker {
+	return &ConsecutiveBreaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		now:       time.Now,
+	}
+}
+
+// Allow implements Breaker.
+func (b *ConsecutiveBreaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		if b.now().Sub(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.state = breakerHalfOpen
+		b.probing = true
+		return true
+	case breakerHalfOpen:
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	default:
+		return true
+	}
+}
+
+// Record implements Breaker.
+func (b *ConsecutiveBreaker) Record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if err == nil {
+		// a call allowed before the circuit opened doesn't close it
+		switch b.state {
+		case breakerHalfOpen:
+			b.state = breakerClosed
+			b.probing = false
+			b.failures = 0
+		case breakerClosed:
+			b.failures = 0
+		}
+		return
+	}
+
+	b.failures++
+	if b.state == breakerHalfOpen || b.failures >= b.threshold {
+		b.state = breakerOpen
+		b.openedAt = b.now()
+		b.probing = false
+	}
+}
+
+// WithCircuitBreaker is WithBreaker with a RateBreaker opening when more
+// than threshold of the loader calls in the error window failed, and
+// probing again after cooldown.
+func WithCircuitBreaker[K comparable, V any](threshold float64, cooldown time.Duration) Option[K, V] {
+	return func(o *options[K, V]) {
+		o.circuitThreshold = threshold
+		o.circuitCooldown = cooldown
+	}
+}
+
+// RateBreaker is a Breaker that opens when the error rate of the last
+// calls exceeds a threshold, once it has seen enough calls to fill its
+// window. Once the cooldown has passed it lets a single probe through:
+// success closes it again with an empty window, failure reopens it.
+type RateBreaker struct {
+	threshold float64
+	window    int
+	cooldown  time.Duration
+	now       func() time.Time
+
+	mu       sync.Mutex // protects the fields below
+	state    breakerState
+	outcomes outcomes
+	openedAt time.Time
+	probing  bool
+}
+
+// NewRateBreaker returns a breaker that opens when more than threshold
+// of the last window calls failed and probes again after cooldown.
+func NewRateBreaker(threshold float64, window int, cooldown time.Duration) *RateBreaker {
+	return &RateBreaker{
+		threshold: threshold,
+		window:    window,
+		cooldown:  cooldown,
+		now:       time.Now,
+	}
+}
+
+// Allow implements Breaker.
+func (b *RateBreaker) Allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case breakerOpen:
+		if b.now().Sub(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.state = breakerHalfOpen
+		b.probing = true
+		return true
+	case breakerHalfOpen:
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	default:
+		return true
+	}
+}
+
+// Record implements Breaker.
+func (b *RateBreaker) Record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch {
+	case b.state == breakerHalfOpen && err == nil:
+		b.state = breakerClosed
+		b.probing = false
+		b.outcomes.reset()
+	case b.state == breakerHalfOpen:
+		b.state = breakerOpen
+		b.openedAt = b.now()
+		b.probing = false
+	default:
+		b.outcomes.record(b.window, err != nil)
+		if b.outcomes.full() && b.outcomes.rate() > b.threshold {
+			b.state = breakerOpen
+			b.openedAt = b.now()
+		}
+	}
+}
@@ -0,0 +1,145 @@
+package multiflight
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConsecutiveBreaker(t *testing.T) {
+	errBackend := errors.New("backend down")
+
+	var calls int32
+	var failing int32 = 1
+	loader := func(ctx context.Context, keys []int) (map[int]string, error) {
+		atomic.AddInt32(&calls, 1)
+		if atomic.LoadInt32(&failing) == 1 {
+			return nil, errBackend
+		}
+		resuts := make(map[int]string, len(keys))
+		for _, k := range keys {
+			resuts[k] = fmt.Sprintf("val: %d", k)
+		}
+		return resuts, nil
+	}
+
+	now := time.Now()
+	b := NewConsecutiveBreaker(2, time.Second)
+	b.now = func() time.Time { return now }
+
+	ast := assert.New(t)
+	g := NewGroup(WithBreaker[int, string](b))
+	do := func() error {
+		_, err := g.Do(context.Background(), []int{1, 2}, loader)
+		return err
+	}
+
+	// closed: failures go to the backend until the threshold
+	ast.ErrorIs(do(), errBackend)
+	ast.ErrorIs(do(), errBackend)
+	ast.Equal(int32(2), calls)
+
+	// open: fail fast without loading
+	ast.ErrorIs(do(), ErrCircuitOpen)
+	ast.Equal(int32(2), calls)
+	ast.Equal(0, g.Len())
+
+	// half-open: a failed probe opens the circuit again
+	now = now.Add(time.Second)
+	ast.ErrorIs(do(), errBackend)
+	ast.Equal(int32(3), calls)
+	ast.ErrorIs(do(), ErrCircuitOpen)
+
+	// half-open: a successful probe closes the circuit
+	now = now.Add(time.Second)
+	atomic.StoreInt32(&failing, 0)
+	ast.Nil(do())
+	ast.Equal(int32(4), calls)
+	ast.Nil(do())
+	ast.Equal(int32(5), calls)
+}
+
+func TestConsecutiveBreakerSingleProbe(t *testing.T) {
+	now := time.Now()
+	b := NewConsecutiveBreaker(1, time.Second)
+	b.now = func() time.Time { return now }
+
+	ast := assert.New(t)
+	b.Record(errors.New("boom"))
+	ast.False(b.Allow())
+
+	now = now.Add(time.Second)
+	ast.True(b.Allow())
+	// only one probe at a time
+	ast.False(b.Allow())
+	b.Record(nil)
+	ast.True(b.Allow())
+	ast.True(b.Allow())
+
+	// a call allowed before the circuit opened doesn't close it
+	b.Record(errors.New("boom"))
+	b.Record(nil)
+	ast.False(b.Allow())
+}
+
+func TestCircuitBreaker(t *testing.T) {
+	errBackend := errors.New("backend down")
+
+	var calls int32
+	var failing int32
+	loader := func(ctx context.Context, keys []int) (map[int]string, error) {
+		atomic.AddInt32(&calls, 1)
+		if atomic.LoadInt32(&failing) == 1 && keys[0]%2 == 0 {
+			return nil, errBackend
+		}
+		return map[int]string{keys[0]: fmt.Sprintf("val: %d", keys[0])}, nil
+	}
+
+	now := time.Now()
+	ast := assert.New(t)
+	g := NewGroup(
+		WithErrorWindow[int, string](10),
+		WithCircuitBreaker[int, string](0.4, time.Second),
+	)
+	g.opts.breaker.(*RateBreaker).now = func() time.Time { return now }
+	do := func(key int) error {
+		_, err := g.Do(context.Background(), []int{key}, loader)
+		return err
+	}
+
+	// closed: an error rate up to the threshold goes to the backend
+	for i := 0; i < 10; i++ {
+		_ = do(i)
+	}
+	atomic.StoreInt32(&failing, 1)
+	for i := 0; i < 8; i += 2 {
+		ast.Nil(do(i + 1))
+		ast.ErrorIs(do(i), errBackend)
+	}
+	ast.Equal(int32(18), calls)
+
+	// open: past the threshold, fail fast without loading
+	ast.Nil(do(9))
+	ast.ErrorIs(do(10), errBackend)
+	ast.ErrorIs(do(11), ErrCircuitOpen)
+	ast.Equal(int32(20), calls)
+
+	// half-open: a failed probe opens the circuit again
+	now = now.Add(time.Second)
+	ast.ErrorIs(do(12), errBackend)
+	ast.ErrorIs(do(13), ErrCircuitOpen)
+	ast.Equal(int32(21), calls)
+
+	// half-open: a successful probe closes the circuit, forgetting the
+	// failures
+	now = now.Add(time.Second)
+	ast.Nil(do(13))
+	ast.ErrorIs(do(14), errBackend)
+	ast.Nil(do(15))
+	ast.Equal(int32(24), calls)
+}
@@ -0,0 +1,924 @@
+package multiflight
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Entry is a loaded value together with its own cache TTL.
+type Entry[V any] struct {
+	Val V
+	// TTL overrides the group TTL for this value. Zero means the group
+	// TTL applies and a negative TTL keeps the value out of the cache.
+	TTL time.Duration
+	// Expires, if set, is when the value expires instead of after TTL.
+	// A value that has already expired isn't cached.
+	Expires time.Time
+}
+
+// lifetime is how long an EntryLoader has a value cached, the zero
+// lifetime meaning the group TTL.
+type lifetime struct {
+	ttl     time.Duration
+	expires time.Time
+}
+
+// EntryLoader is a Loader that chooses the cache lifetime of every value.
+type EntryLoader[K comparable, V any] func(ctx context.Context, keys []K) (map[K]Entry[V], error)
+
+// WithTTL caches loaded values for d, so later calls are served without
+// loading until the value expires. Values are cached per key, the TTL
+// of an Entry returned by an EntryLoader taking precedence over d. With
+// d <= 0 only values with a positive Entry TTL are cached.
+func WithTTL[K comparable, V any](d time.Duration) Option[K, V] {
+	return func(o *options[K, V]) {
+		o.cache = true
+		o.ttl = d
+	}
+}
+
+// WithNegativeTTL remembers for d the keys a loader reported missing, so
+// Do leaves them out of its result without loading them again until the
+// record expires. It applies to MarkNotFound as well.
+func WithNegativeTTL[K comparable, V any](d time.Duration) Option[K, V] {
+	return func(o *options[K, V]) {
+		o.cache = true
+		o.negativeTTL = d
+	}
+}
+
+// WithErrorTTL remembers for d the errors keys failed with, so calls
+// during that window fail with the same error right away instead of
+// loading the keys again, which absorbs callers retrying a failing load
+// in a tight loop. Only errors cacheable reports true for are kept; a
+// nil cacheable keeps every error but context.Canceled. d is independent
+// of the TTL of values. DoRefresh ignores cached errors, and Forget
+// clears them.
+func WithErrorTTL[K comparable, V any](d time.Duration, cacheable func(error) bool) Option[K, V] {
+	return func(o *options[K, V]) {
+		o.cache = true
+		o.errorTTL = d
+		o.errorCacheable = cacheable
+	}
+}
+
+// WithStaleWhileRevalidate keeps serving values for up to grace past
+// their TTL while reloading them in the background, like WithSoftTTL
+// with the TTL as soft TTL: callers get the expired value right away,
+// the key being reloaded once however many callers read it, and the
+// next ones the reloaded value. Values expired for longer than grace
+// are loaded as usual again.
+func WithStaleWhileRevalidate[K comparable, V any](grace time.Duration) Option[K, V] {
+	return func(o *options[K, V]) {
+		o.staleGrace = grace
+	}
+}
+
+// WithValueEqual keeps the cached value of a key when the key is loaded
+// or set again with a value equal reports equal to it: the value isn't
+// replaced, so WithOnEvict isn't called, and keeps its expiry unless
+// WithEqualValueExtendsTTL is set. With WithSoftTTL or
+// WithStaleWhileRevalidate, the kept value is fresh again all the same,
+// until the soft TTL or the TTL of the new value runs out. equal is
+// called with the cache lock held and must not use the group.
+func WithValueEqual[K comparable, V any](equal func(a, b V) bool) Option[K, V] {
+	return func(o *options[K, V]) {
+		o.equal = equal
+	}
+}
+
+// WithEqualValueExtendsTTL gives the values kept by WithValueEqual the
+// expiry of the value they are equal to, as if they were replaced.
+func WithEqualValueExtendsTTL[K comparable, V any]() Option[K, V] {
+	return func(o *options[K, V]) {
+		o.equalExtendsTTL = true
+	}
+}
+
+// WithOnChange calls onChange when a key is loaded with a value other
+// than the one cached for it, e.g. to invalidate state derived from the
+// value. Values are compared with the func of WithValueEqual, or with ==
+// if V is comparable and not an interface, and always differ otherwise.
+// Keys loaded without a value cached, and values set with Set, don't
+// get a call. Like onEvict, onChange is called without the group locks
+// held, so it may use the group, and possibly from multiple goroutines
+// at once.
+func WithOnChange[K comparable, V any](onChange func(key K, oldVal, newVal V)) Option[K, V] {
+	return func(o *options[K, V]) {
+		o.onChange = onChange
+	}
+}
+
+// WithTTLJitter spreads the expiry of cached values by up to fraction of
+// their TTL either way, so values cached together don't expire, and get
+// loaded again, all at once. It applies to the TTL of an Entry as well,
+// but not to its absolute expiry.
+func WithTTLJitter[K comparable, V any](fraction float64) Option[K, V] {
+	return func(o *options[K, V]) {
+		o.ttlJitter = fraction
+	}
+}
+
+// WithSoftTTL serves values cached for longer than d, but not expired
+// yet, while reloading them in the background: callers get the stale
+// value right away and the next ones the reloaded value. Keys are
+// reloaded once however many callers read them, and their values, once
+// expired with the TTL of WithTTL, are loaded as usual again.
+func WithSoftTTL[K comparable, V any](d time.Duration) Option[K, V] {
+	return func(o *options[K, V]) {
+		o.softTTL = d
+	}
+}
+
+// WithEarlyExpiration reloads cached values a bit before they expire,
+// at random, so values cached together don't all expire, and get
+// reloaded, at once. Every read of a value reloads it with a probability
+// growing as it nears its expiry and with the time its load took, scaled
+// by beta: 1 is a good default and larger values reload earlier. The
+// other callers are served the cached value meanwhile.
+func WithEarlyExpiration[K comparable, V any](beta float64) Option[K, V] {
+	return func(o *options[K, V]) {
+		o.earlyBeta = beta
+	}
+}
+
+// WithLRU bounds the cache to n results, evicting the least recently
+// used ones beyond that. On its own it caches values until they are
+// evicted, and combined with WithTTL results are also dropped when they
+// expire. Keys being loaded are not cached yet and never evicted.
+func WithLRU[K comparable, V any](n int) Option[K, V] {
+	return func(o *options[K, V]) {
+		o.cache = true
+		o.maxEntries = n
+	}
+}
+
+// WithMaxCacheBytes bounds the cache to about n bytes of values, as
+// measured by size, evicting the least recently used results beyond
+// that. A value larger than n on its own is returned to its callers but
+// not cached. Like WithLRU it caches values until they are evicted
+// unless combined with WithTTL, and both bounds can be set together.
+func WithMaxCacheBytes[K comparable, V any](n int64, size func(key K, val V) int64) Option[K, V] {
+	return func(o *options[K, V]) {
+		o.cache = true
+		o.maxBytes = n
+		o.sizer = size
+	}
+}
+
+// WithValueClone caches a clone of every value, made by clone, and
+// serves callers clones of the cached values, so callers mutating the
+// values they get, e.g. slices or pointers, never alter the cache or the
+// values of other callers served from it. Callers sharing a load in
+// flight still share its values.
+func WithValueClone[K comparable, V any](clone func(V) V) Option[K, V] {
+	return func(o *options[K, V]) {
+		o.clone = clone
+	}
+}
+
+// WithValueInterner caches a single instance of the values intern maps
+// to the same ID, e.g. configs or templates that many keys load equal
+// copies of: the keys whose values have the same ID share the value
+// cached first until none of them is cached anymore. IDs must be
+// comparable. WithValueInterner does nothing unless the group caches
+// results.
+func WithValueInterner[K comparable, V any](intern func(V) any) Option[K, V] {
+	return func(o *options[K, V]) {
+		o.interner = intern
+	}
+}
+
+// EvictReason is why a value was removed from the cache.
+type EvictReason int
+
+const (
+	// Expired values outlived their TTL.
+	Expired EvictReason = iota
+	// Evicted values were the least recently used beyond a cache bound.
+	Evicted
+	// Invalidated values were dropped by Invalidate, Forget,
+	// ForgetUnshared, ForgetAll or MarkNotFound, or by a load of their
+	// key finding it missing.
+	Invalidated
+	// Replaced values were replaced by a newer result for their key, or
+	// by a newer value not to be cached.
+	Replaced
+)
+
+func (r EvictReason) String() string {
+	switch r {
+	case Expired:
+		return "expired"
+	case Evicted:
+		return "evicted"
+	case Invalidated:
+		return "invalidated"
+	case Replaced:
+		return "replaced"
+	}
+	return fmt.Sprintf("EvictReason(%d)", int(r))
+}
+
+// WithOnEvict calls onEvict with every value removed from the cache and
+// why, e.g. to release the resources it holds or to keep derived
+// indexes in sync. Not found records and errors aren't values and don't
+// get a call. onEvict is called without the group locks held, so it may
+// use the group, and possibly from multiple goroutines at once.
+func WithOnEvict[K comparable, V any](onEvict func(key K, val V, reason EvictReason)) Option[K, V] {
+	return func(o *options[K, V]) {
+		o.cache = true
+		o.onEvict = onEvict
+	}
+}
+
+// cache stores completed results. It has its own lock, which may be
+// taken while holding the group lock but never the other way round.
+type cache[K comparable, V any] struct {
+	ttl         time.Duration
+	negativeTTL time.Duration
+	errorTTL    time.Duration
+	softTTL     time.Duration
+	grace       time.Duration // served past the expiry while reloading
+	equal       func(a, b V) bool
+	extendEqual bool // values kept as equal get the new expiry
+	onChange    func(key K, oldVal, newVal V)
+	comparable  bool // values can be compared with ==
+	jitter      float64
+	earlyBeta   float64
+	maxEntries  int
+	maxBytes    int64
+	size        func(key K, val V) int64
+	onEvict     func(key K, val V, reason EvictReason)
+	clone       func(V) V // nil if values are shared
+	interner    func(V) any
+	now         func() time.Time
+	rand        func() float64 // in [0, 1)
+
+	evictions uint64 // updated atomically
+	swept     uint64 // updated atomically
+
+	mu       sync.Mutex // protects items, lru, expiries, bytes, evicted and interned
+	items    map[K]*item[V]
+	lru      *list.List           // keys from the most to the least recently used, nil without a bound
+	expiries expiries[K, V]       // the items that expire, the soonest first
+	bytes    int64                // total size of the items
+	evicted  []eviction[K, V]     // removed values onEvict hasn't been called with yet
+	changed  []change[K, V]       // loaded values onChange hasn't been called with yet
+	interned map[any]*interned[V] // values shared by items, by ID, lazily initialized
+}
+
+// interned is a value shared by the items whose values have its ID.
+type interned[V any] struct {
+	id   any
+	val  V
+	refs int // items sharing val
+}
+
+// eviction is a value removed from the cache.
+type eviction[K comparable, V any] struct {
+	key    K
+	val    V
+	reason EvictReason
+}
+
+// change is a value replaced by a different loaded value, for onChange.
+type change[K comparable, V any] struct {
+	key      K
+	old, new V
+}
+
+// item is a cached value, the knowledge that a key doesn't exist, or
+// the error loading it failed with.
+type item[V any] struct {
+	val      V
+	notFound bool
+	err      error
+	expires  time.Time     // zero if the item never expires
+	stale    time.Time     // zero if the item is never reloaded in the background
+	accessed time.Time     // last read, zero if never read
+	cost     time.Duration // how long loading the value took
+	size     int64         // as measured by the cache sizer
+	elem     *list.Element
+	interned *interned[V] // the shared value, nil unless interned
+	index    int          // in the expiry heap, if in it
+}
+
+func newCache[K comparable, V any](o *options[K, V]) *cache[K, V] {
+	c := &cache[K, V]{
+		ttl:         o.ttl,
+		negativeTTL: o.negativeTTL,
+		errorTTL:    o.errorTTL,
+		softTTL:     o.softTTL,
+		grace:       o.staleGrace,
+		equal:       o.equal,
+		extendEqual: o.equalExtendsTTL,
+		onChange:    o.onChange,
+		comparable:  isComparable[V](),
+		jitter:      o.ttlJitter,
+		earlyBeta:   o.earlyBeta,
+		maxEntries:  o.maxEntries,
+		maxBytes:    o.maxBytes,
+		size:        o.sizer,
+		onEvict:     o.onEvict,
+		clone:       o.clone,
+		interner:    o.interner,
+		now:         time.Now,
+		rand:        rand.Float64,
+		items:       make(map[K]*item[V]),
+	}
+	if c.maxEntries > 0 || c.maxBytes > 0 {
+		c.lru = list.New()
+	}
+	return c
+}
+
+// expiry returns when a value cached now for ttl expires.
+func (c *cache[K, V]) expiry(ttl time.Duration) time.Time {
+	if c.jitter > 0 {
+		ttl += time.Duration(float64(ttl) * c.jitter * (2*c.rand() - 1))
+	}
+	return c.now().Add(ttl)
+}
+
+// get returns what is cached for key, dropping it if expired.
+func (c *cache[K, V]) get(key K) (it item[V], ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cached, has := c.items[key]
+	if !has {
+		return it, false
+	}
+	if !cached.expires.IsZero() && !c.now().Before(cached.expires) {
+		c.remove(key, cached, Expired)
+		return it, false
+	}
+	cached.accessed = c.now()
+	if c.lru != nil {
+		c.lru.MoveToFront(cached.elem)
+	}
+	return *cached, true
+}
+
+// peek is get for the bookkeeping of the group: it neither counts as a
+// read of key nor removes it once expired.
+func (c *cache[K, V]) peek(key K) (it item[V], ok bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cached, has := c.items[key]
+	if !has || !cached.expires.IsZero() && !c.now().Before(cached.expires) {
+		return it, false
+	}
+	return *cached, true
+}
+
+// set caches val for key for its lifetime. A zero lifetime means the
+// cache TTL and a negative TTL, an expiry in the past, or no TTL at all,
+// removes any cached value instead, unless the cache is bounded in which
+// case values without a TTL never expire.
+func (c *cache[K, V]) set(key K, val V, life lifetime, cost time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.setLocked(key, val, life, cost)
+}
+
+// restore is set for a value that doesn't replace one already cached.
+func (c *cache[K, V]) restore(key K, val V, life lifetime) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if it, has := c.items[key]; has && (it.expires.IsZero() || c.now().Before(it.expires)) {
+		return
+	}
+	c.setLocked(key, val, life, 0)
+}
+
+// setLocked is set with c.mu held.
+func (c *cache[K, V]) setLocked(key K, val V, life lifetime, cost time.Duration) {
+	it := &item[V]{val: c.copy(val), cost: cost}
+	if c.size != nil {
+		it.size = c.size(key, val)
+	}
+	ttl := life.ttl
+	if !life.expires.IsZero() {
+		// an absolute expiry is kept as is, without jitter
+		if ttl = life.expires.Sub(c.now()); ttl <= 0 {
+			c.drop(key, Replaced)
+			return
+		}
+		it.expires = life.expires
+	} else {
+		if ttl == 0 {
+			ttl = c.ttl
+		}
+		if ttl < 0 || ttl == 0 && c.lru == nil {
+			c.drop(key, Replaced)
+			return
+		}
+		if ttl > 0 {
+			it.expires = c.expiry(ttl)
+		}
+	}
+	if c.grace > 0 && !it.expires.IsZero() {
+		it.stale = it.expires
+		it.expires = it.expires.Add(c.grace)
+	}
+	if c.softTTL > 0 && (ttl == 0 || c.softTTL < ttl) {
+		it.stale = c.now().Add(c.softTTL)
+	}
+	if old := c.unchanged(key, val); old != nil {
+		// the value is fresh again, whether or not it lives longer, and
+		// unread since, like a replacement
+		old.stale, old.accessed = it.stale, time.Time{}
+		if c.extendEqual {
+			old.expires, old.cost = it.expires, it.cost
+			c.expiries.update(key, old)
+		}
+		return
+	}
+	c.put(key, it)
+}
+
+// unchanged returns the cached value of key if it is equal to val, see
+// WithValueEqual, or nil.
+func (c *cache[K, V]) unchanged(key K, val V) *item[V] {
+	if c.equal == nil {
+		return nil
+	}
+	old, has := c.items[key]
+	if !has || old.notFound || old.err != nil {
+		return nil
+	}
+	if !old.expires.IsZero() && !c.now().Before(old.expires) {
+		return nil
+	}
+	if !c.equal(old.val, val) {
+		return nil
+	}
+	return old
+}
+
+// copy returns a clone of val for a caller or the cache, or val itself
+// without WithValueClone.
+func (c *cache[K, V]) copy(val V) V {
+	if c.clone == nil {
+		return val
+	}
+	return c.clone(val)
+}
+
+// expiresEarly reports whether it should be reloaded before it expires,
+// drawing from the XFetch distribution.
+func (c *cache[K, V]) expiresEarly(it item[V]) bool {
+	if c.earlyBeta <= 0 || it.expires.IsZero() || it.cost <= 0 {
+		return false
+	}
+	early := time.Duration(float64(it.cost) * c.earlyBeta * -math.Log(1-c.rand()))
+	return !c.now().Add(early).Before(it.expires)
+}
+
+// freshUntil returns when it expires, as opposed to when it stops being
+// served, the grace period of WithStaleWhileRevalidate later.
+func (c *cache[K, V]) freshUntil(it *item[V]) time.Time {
+	if c.grace > 0 && !it.expires.IsZero() {
+		return it.expires.Add(-c.grace)
+	}
+	return it.expires
+}
+
+// isStale reports whether it should be reloaded in the background.
+func (c *cache[K, V]) isStale(it item[V]) bool {
+	return !it.stale.IsZero() && !c.now().Before(it.stale)
+}
+
+// setNotFound caches that key doesn't exist for the negative TTL, or
+// the cache TTL if there is none.
+func (c *cache[K, V]) setNotFound(key K) {
+	ttl := c.negativeTTL
+	if ttl <= 0 {
+		ttl = c.ttl
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.drop(key, Invalidated)
+	if ttl <= 0 {
+		return
+	}
+	c.put(key, &item[V]{notFound: true, expires: c.expiry(ttl)})
+}
+
+// setErr caches that loading key failed with err for the error TTL.
+func (c *cache[K, V]) setErr(key K, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.put(key, &item[V]{err: err, expires: c.expiry(c.errorTTL)})
+}
+
+// delete removes key from the cache.
+func (c *cache[K, V]) delete(key K) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.drop(key, Invalidated)
+}
+
+// clear removes every item.
+func (c *cache[K, V]) clear() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for key, it := range c.items {
+		c.evict(key, it, Invalidated)
+	}
+	c.items = make(map[K]*item[V])
+	c.expiries = nil
+	c.bytes = 0
+	c.interned = nil
+	if c.lru != nil {
+		c.lru.Init()
+	}
+}
+
+// put stores it for key, evicting the least recently used items beyond
+// the bounds. An item too large for the cache on its own is not stored.
+// Must be called with c.mu held.
+func (c *cache[K, V]) put(key K, it *item[V]) {
+	c.drop(key, Replaced)
+	if c.maxBytes > 0 && it.size > c.maxBytes {
+		return
+	}
+	if c.interner != nil && !it.notFound && it.err == nil {
+		c.intern(it)
+	}
+	c.items[key] = it
+	c.bytes += it.size
+	c.expiries.update(key, it)
+	if c.lru == nil {
+		return
+	}
+
+	it.elem = c.lru.PushFront(key)
+	for c.overBound() {
+		oldest := c.lru.Back().Value.(K)
+		c.remove(oldest, c.items[oldest], Evicted)
+		atomic.AddUint64(&c.evictions, 1)
+	}
+}
+
+// intern makes it share the value cached with the same ID, if any. Must
+// be called with c.mu held.
+func (c *cache[K, V]) intern(it *item[V]) {
+	id := c.interner(it.val)
+	in, has := c.interned[id]
+	if !has {
+		if c.interned == nil {
+			c.interned = make(map[any]*interned[V])
+		}
+		in = &interned[V]{id: id, val: it.val}
+		c.interned[id] = in
+	}
+	in.refs++
+	it.val, it.interned = in.val, in
+}
+
+// overBound reports whether the cache holds more than its bounds allow.
+// Must be called with c.mu held.
+func (c *cache[K, V]) overBound() bool {
+	return c.maxEntries > 0 && c.lru.Len() > c.maxEntries ||
+		c.maxBytes > 0 && c.bytes > c.maxBytes
+}
+
+// drop removes key if cached, for reason unless it has expired. Must be
+// called with c.mu held.
+func (c *cache[K, V]) drop(key K, reason EvictReason) {
+	it, has := c.items[key]
+	if !has {
+		return
+	}
+	if !it.expires.IsZero() && !c.now().Before(it.expires) {
+		reason = Expired
+	}
+	c.remove(key, it, reason)
+}
+
+// remove removes the item it cached for key for reason. Must be called
+// with c.mu held.
+func (c *cache[K, V]) remove(key K, it *item[V], reason EvictReason) {
+	c.evict(key, it, reason)
+	delete(c.items, key)
+	c.bytes -= it.size
+	c.expiries.remove(it)
+	if c.lru != nil {
+		c.lru.Remove(it.elem)
+	}
+	if in := it.interned; in != nil {
+		if in.refs--; in.refs == 0 {
+			delete(c.interned, in.id)
+		}
+	}
+}
+
+// evict queues the value of it for onEvict. Must be called with c.mu
+// held.
+func (c *cache[K, V]) evict(key K, it *item[V], reason EvictReason) {
+	if c.onEvict != nil && !it.notFound && it.err == nil {
+		c.evicted = append(c.evicted, eviction[K, V]{key: key, val: it.val, reason: reason})
+	}
+}
+
+// setLoaded is set for a value loaded, queueing it for onChange if it
+// differs from the value cached.
+func (c *cache[K, V]) setLoaded(key K, val V, life lifetime, cost time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.onChange != nil {
+		old, has := c.items[key]
+		if has && !old.notFound && old.err == nil && (old.expires.IsZero() || c.now().Before(old.expires)) && !c.same(old.val, val) {
+			c.changed = append(c.changed, change[K, V]{key: key, old: old.val, new: val})
+		}
+	}
+	c.setLocked(key, val, life, cost)
+}
+
+// same reports whether a and b are the same value for onChange.
+func (c *cache[K, V]) same(a, b V) bool {
+	switch {
+	case c.equal != nil:
+		return c.equal(a, b)
+	case c.comparable:
+		return any(a) == any(b)
+	}
+	return false
+}
+
+// isComparable reports whether the values of V can be compared with ==
+// without panicking.
+func isComparable[V any]() bool {
+	return strictlyComparable(reflect.TypeOf((*V)(nil)).Elem())
+}
+
+// strictlyComparable reports whether t is comparable and holds no
+// interface, whose dynamic values may not be.
+func strictlyComparable(t reflect.Type) bool {
+	switch t.Kind() {
+	case reflect.Interface:
+		return false
+	case reflect.Array:
+		return strictlyComparable(t.Elem())
+	case reflect.Struct:
+		for i := 0; i < t.NumField(); i++ {
+			if !strictlyComparable(t.Field(i).Type) {
+				return false
+			}
+		}
+		return true
+	}
+	return t.Comparable()
+}
+
+// notifyEvicted calls onEvict with the values removed so far, and
+// onChange with the values changed. It must be called without any lock
+// held.
+func (c *cache[K, V]) notifyEvicted() {
+	if c.onEvict == nil && c.onChange == nil {
+		return
+	}
+	c.mu.Lock()
+	evicted, changed := c.evicted, c.changed
+	c.evicted, c.changed = nil, nil
+	c.mu.Unlock()
+	for _, ev := range evicted {
+		c.onEvict(ev.key, ev.val, ev.reason)
+	}
+	for _, ch := range changed {
+		c.onChange(ch.key, ch.old, ch.new)
+	}
+}
+
+// revalidate reloads the stale values of ents in the background.
+func (g *Group[K, V]) revalidate(ctx context.Context, ents []*ent[K, V], load loadFunc[K, V], source any, priority int) {
+	ctx = detach(ctx)
+	if g.opts.batchWindow > 0 {
+		g.enqueue(ctx, ents, load, source, priority)
+		return
+	}
+	go g.runLoad(ctx, ents, load)
+}
+
+// MarkNotFound records that keys don't exist, so Do leaves them out of
+// its result without loading them until the record expires with the
+// negative TTL, or the group TTL. Keys currently being loaded are not
+// affected, and a DoRefresh of a key, or a load of it after the record
+// expired, replaces the record with whatever the loader returns.
+// MarkNotFound does nothing unless the group caches results.
+func (g *Group[K, V]) MarkNotFound(keys ...K) {
+	if g.cache == nil {
+		return
+	}
+	for _, key := range keys {
+		g.cache.setNotFound(key)
+	}
+	g.cache.notifyEvicted()
+	g.eachPartition(func(p *Group[K, V]) {
+		p.MarkNotFound(keys...)
+	})
+}
+
+// Invalidate drops whatever is cached for keys, values, not found
+// records and errors, from the cache and the external cache, so the next
+// calls load them again. Loads of keys in flight go on and their callers
+// get their results, but these results aren't cached since they may
+// predate the invalidation.
+func (g *Group[K, V]) Invalidate(keys ...K) {
+	g.invalidate(keys)
+	g.eachPartition(func(p *Group[K, V]) {
+		p.invalidate(keys)
+	})
+	if s := g.opts.store; s != nil {
+		s.Delete(context.Background(), keys)
+	}
+}
+
+// invalidate is Invalidate without the external cache.
+func (g *Group[K, V]) invalidate(keys []K) {
+	g.dropNotFound(keys)
+	g.withLock(func() {
+		for _, key := range keys {
+			// the loads in flight write back to neither cache
+			if e, has := g.m[key]; has {
+				e.skipCache = true
+			}
+			if g.cache != nil {
+				g.cache.delete(key)
+			}
+		}
+	})
+}
+
+// ForgetUnshared drops the cached results of the keys nobody is loading
+// or waiting for, to reclaim memory, so their next calls load them
+// again. Keys being loaded keep whatever is cached for them.
+func (g *Group[K, V]) ForgetUnshared() {
+	if g.cache == nil {
+		return
+	}
+	g.withLock(func() {
+		g.cache.mu.Lock()
+		defer g.cache.mu.Unlock()
+		for key := range g.cache.items {
+			if _, has := g.m[key]; !has {
+				g.cache.drop(key, Invalidated)
+			}
+		}
+	})
+	g.eachPartition(func(p *Group[K, V]) {
+		p.ForgetUnshared()
+	})
+}
+
+// Snapshot returns the values currently cached, with their expiry, e.g.
+// to persist them and Restore them in a later process. Values that never
+// expire have a zero Expires, and values expired but still served by
+// WithStaleWhileRevalidate are left out.
+func (g *Group[K, V]) Snapshot() map[K]Entry[V] {
+	if g.cache == nil {
+		return nil
+	}
+
+	c := g.cache
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	entries := make(map[K]Entry[V], len(c.items))
+	for key, it := range c.items {
+		expires := c.freshUntil(it)
+		if it.notFound || it.err != nil || !expires.IsZero() && !now.Before(expires) {
+			continue
+		}
+		entries[key] = Entry[V]{Val: c.copy(it.val), Expires: expires}
+	}
+	return entries
+}
+
+// Restore caches entries, e.g. taken by Snapshot, like an EntryLoader
+// returning them would. Entries that have expired already are skipped,
+// and so are the keys cached or being loaded meanwhile, whose values are
+// fresher. Restore does nothing unless the group caches results.
+func (g *Group[K, V]) Restore(entries map[K]Entry[V]) {
+	if g.cache == nil {
+		return
+	}
+	g.withLock(func() {
+		for key, e := range entries {
+			if _, has := g.m[key]; has {
+				continue
+			}
+			g.cache.restore(key, e.Val, lifetime{ttl: e.TTL, expires: e.Expires})
+		}
+	})
+}
+
+// Export returns the values currently cached, like Snapshot without
+// their expiry, e.g. to persist them before shutting down and Import
+// them on startup.
+func (g *Group[K, V]) Export() map[K]V {
+	entries := g.Snapshot()
+	if entries == nil {
+		return nil
+	}
+	vals := make(map[K]V, len(entries))
+	for key, e := range entries {
+		vals[key] = e.Val
+	}
+	return vals
+}
+
+// Import caches vals, e.g. taken by Export, all at once and with the
+// group TTL from now on. Like Restore, it skips the keys cached or being
+// loaded meanwhile, and does nothing unless the group caches results.
+func (g *Group[K, V]) Import(vals map[K]V) {
+	entries := make(map[K]Entry[V], len(vals))
+	for key, v := range vals {
+		entries[key] = Entry[V]{Val: v}
+	}
+	g.Restore(entries)
+}
+
+// Set caches val for key with the group TTL, as if it had been loaded,
+// and stores it in the external cache. It replaces whatever was cached
+// for key, a not found record or an error included. Set wins over a
+// load of key in flight: its callers still get the loaded value but it
+// isn't cached. Set does nothing unless the group caches results or has
+// an external cache.
+func (g *Group[K, V]) Set(key K, val V) {
+	g.SetMany(map[K]V{key: val})
+}
+
+// SetMany is Set for multiple keys.
+func (g *Group[K, V]) SetMany(vals map[K]V) {
+	g.set(vals)
+	g.eachPartition(func(p *Group[K, V]) {
+		p.set(vals)
+	})
+	if s := g.opts.store; s != nil {
+		s.Set(context.Background(), vals)
+	}
+}
+
+// set is SetMany without the external cache.
+func (g *Group[K, V]) set(vals map[K]V) {
+	if g.opts.notFoundCoalesce > 0 {
+		keys := make([]K, 0, len(vals))
+		for k := range vals {
+			keys = append(keys, k)
+		}
+		g.dropNotFound(keys)
+	}
+	g.withLock(func() {
+		for k, v := range vals {
+			// the loads in flight write back to neither cache
+			if e, has := g.m[k]; has {
+				e.skipCache = true
+			}
+			if g.cache != nil {
+				g.cache.set(k, v, lifetime{}, 0)
+			}
+		}
+	})
+}
+
+// DoEntries is like Do for loaders that set the cache TTL of each value.
+func (g *Group[K, V]) DoEntries(ctx context.Context, keys []K, load EntryLoader[K, V], opts ...CallOption) (map[K]V, error) {
+	co := newCallOptions(opts)
+	return g.do(ctx, keys, load.batch(), co)
+}
+
+func (l EntryLoader[K, V]) batch() loadFunc[K, V] {
+	return func(ctx context.Context, keys []K) (map[K]V, map[K]lifetime, error) {
+		entries, err := l(ctx, keys)
+		if entries == nil {
+			return nil, nil, err
+		}
+
+		vals := make(map[K]V, len(entries))
+		ttls := make(map[K]lifetime, len(entries))
+		for k, e := range entries {
+			vals[k] = e.Val
+			if e.TTL != 0 || !e.Expires.IsZero() {
+				ttls[k] = lifetime{ttl: e.TTL, expires: e.Expires}
+			}
+		}
+		return vals, ttls, err
+	}
+}
@@ -0,0 +1,1297 @@
+package multiflight
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeClock is a manually advanced clock for cache tests.
+type fakeClock struct {
+	now int64
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Now().UnixNano()}
+}
+
+func (c *fakeClock) Now() time.Time {
+	return time.Unix(0, atomic.LoadInt64(&c.now))
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	atomic.AddInt64(&c.now, int64(d))
+}
+
+// countingLoader returns a loader formatting values with the current
+// version and counting the keys it loads.
+func countingLoader(version *int32, loaded *int32) Loader[int, string] {
+	return func(ctx context.Context, keys []int) (map[int]string, error) {
+		atomic.AddInt32(loaded, int32(len(keys)))
+		resuts := make(map[int]string, len(keys))
+		for _, k := range keys {
+			resuts[k] = fmt.Sprintf("val: %d v%d", k, atomic.LoadInt32(version))
+		}
+		return resuts, nil
+	}
+}
+
+func TestTTL(t *testing.T) {
+	var version, loaded int32
+	loader := countingLoader(&version, &loaded)
+
+	ast := assert.New(t)
+	clock := newFakeClock()
+	g := NewGroup(WithTTL[int, string](time.Minute))
+	g.cache.now = clock.Now
+
+	results, err := g.Do(context.Background(), []int{1, 2}, loader)
+	ast.Nil(err)
+	ast.Equal(map[int]string{1: "val: 1 v0", 2: "val: 2 v0"}, results)
+	ast.Equal(int32(2), loaded)
+
+	// served from the cache, only the new key is loaded
+	atomic.StoreInt32(&version, 1)
+	results, err = g.Do(context.Background(), []int{1, 2, 3}, loader)
+	ast.Nil(err)
+	ast.Equal(map[int]string{1: "val: 1 v0", 2: "val: 2 v0", 3: "val: 3 v1"}, results)
+	ast.Equal(int32(3), loaded)
+
+	// expired values are loaded again
+	clock.Advance(time.Minute)
+	results, err = g.Do(context.Background(), []int{1, 2}, loader)
+	ast.Nil(err)
+	ast.Equal(map[int]string{1: "val: 1 v1", 2: "val: 2 v1"}, results)
+	ast.Equal(int32(5), loaded)
+}
+
+func TestDoRefreshCache(t *testing.T) {
+	var version, loaded int32
+	loader := countingLoader(&version, &loaded)
+
+	ast := assert.New(t)
+	g := NewGroup(WithTTL[int, string](time.Minute))
+
+	_, err := g.Do(context.Background(), []int{1}, loader)
+	ast.Nil(err)
+
+	// the cached value is stale now
+	atomic.StoreInt32(&version, 1)
+	results, err := g.Do(context.Background(), []int{1}, loader)
+	ast.Nil(err)
+	ast.Equal(map[int]string{1: "val: 1 v0"}, results)
+
+	results, err = g.DoRefresh(context.Background(), []int{1}, loader)
+	ast.Nil(err)
+	ast.Equal(map[int]string{1: "val: 1 v1"}, results)
+	ast.Equal(int32(2), loaded)
+
+	// and the refresh replaced it
+	results, err = g.Do(context.Background(), []int{1}, loader)
+	ast.Nil(err)
+	ast.Equal(map[int]string{1: "val: 1 v1"}, results)
+	ast.Equal(int32(2), loaded)
+}
+
+func TestDoEntries(t *testing.T) {
+	var loaded int32
+	loader := func(ctx context.Context, keys []int) (map[int]Entry[string], error) {
+		atomic.AddInt32(&loaded, int32(len(keys)))
+		resuts := make(map[int]Entry[string], len(keys))
+		for _, k := range keys {
+			e := Entry[string]{Val: fmt.Sprintf("val: %d", k)}
+			switch k {
+			case 1:
+				e.TTL = time.Second
+			case 3:
+				e.TTL = -1
+			}
+			resuts[k] = e
+		}
+		return resuts, nil
+	}
+
+	ast := assert.New(t)
+	clock := newFakeClock()
+	g := NewGroup(WithTTL[int, string](time.Minute))
+	g.cache.now = clock.Now
+
+	keys := []int{1, 2, 3}
+	results, err := g.DoEntries(context.Background(), keys, loader)
+	ast.Nil(err)
+	ast.Equal(map[int]string{1: "val: 1", 2: "val: 2", 3: "val: 3"}, results)
+	ast.Equal(int32(3), loaded)
+
+	// 3 isn't cached
+	_, err = g.DoEntries(context.Background(), keys, loader)
+	ast.Nil(err)
+	ast.Equal(int32(4), loaded)
+
+	// 1 has its own TTL, 2 the group one
+	clock.Advance(time.Second)
+	_, err = g.DoEntries(context.Background(), keys, loader)
+	ast.Nil(err)
+	ast.Equal(int32(6), loaded)
+}
+
+func TestDoEntriesExpires(t *testing.T) {
+	clock := newFakeClock()
+	var loaded int32
+	loader := func(ctx context.Context, keys []int) (map[int]Entry[string], error) {
+		atomic.AddInt32(&loaded, int32(len(keys)))
+		resuts := make(map[int]Entry[string], len(keys))
+		for _, k := range keys {
+			e := Entry[string]{Val: fmt.Sprintf("val: %d", k)}
+			switch k {
+			case 1:
+				e.Expires = clock.Now().Add(time.Second * 2)
+			case 2:
+				e.Expires = clock.Now().Add(-time.Second)
+			}
+			resuts[k] = e
+		}
+		return resuts, nil
+	}
+
+	ast := assert.New(t)
+	g := NewGroup(WithTTL[int, string](time.Second))
+	g.cache.now = clock.Now
+
+	keys := []int{1, 2, 3}
+	_, err := g.DoEntries(context.Background(), keys, loader)
+	ast.Nil(err)
+	ast.Equal(int32(3), loaded)
+
+	// 2 expired already, 3 has the group TTL
+	_, err = g.DoEntries(context.Background(), keys, loader)
+	ast.Nil(err)
+	ast.Equal(int32(4), loaded)
+
+	// 1 expires at its own time
+	clock.Advance(time.Second)
+	_, err = g.DoEntries(context.Background(), []int{1, 3}, loader)
+	ast.Nil(err)
+	ast.Equal(int32(5), loaded)
+	clock.Advance(time.Second)
+	_, err = g.DoEntries(context.Background(), []int{1}, loader)
+	ast.Nil(err)
+	ast.Equal(int32(6), loaded)
+}
+
+func TestMarkNotFound(t *testing.T) {
+	var version, loaded int32
+	loader := countingLoader(&version, &loaded)
+
+	ast := assert.New(t)
+	clock := newFakeClock()
+	g := NewGroup(WithTTL[int, string](time.Minute))
+	g.cache.now = clock.Now
+
+	g.MarkNotFound(1, 2)
+	results, err := g.Do(context.Background(), []int{1, 2, 3}, loader)
+	ast.Nil(err)
+	ast.Equal(map[int]string{3: "val: 3 v0"}, results)
+	ast.Equal(int32(1), loaded)
+
+	// a refresh replaces the record
+	results, err = g.DoRefresh(context.Background(), []int{1}, loader)
+	ast.Nil(err)
+	ast.Equal(map[int]string{1: "val: 1 v0"}, results)
+	results, err = g.Do(context.Background(), []int{1}, loader)
+	ast.Nil(err)
+	ast.Equal(map[int]string{1: "val: 1 v0"}, results)
+	ast.Equal(int32(2), loaded)
+
+	// and so does a load once it expired
+	clock.Advance(time.Minute)
+	results, err = g.Do(context.Background(), []int{2}, loader)
+	ast.Nil(err)
+	ast.Equal(map[int]string{2: "val: 2 v0"}, results)
+	ast.Equal(int32(3), loaded)
+}
+
+func TestScoped(t *testing.T) {
+	var loaded int32
+	release := make(chan struct{})
+	loader := func(ctx context.Context, keys []int) (map[int]string, error) {
+		atomic.AddInt32(&loaded, int32(len(keys)))
+		<-release
+		resuts := make(map[int]string, len(keys))
+		for _, k := range keys {
+			resuts[k] = fmt.Sprintf("val: %d", k)
+		}
+		return resuts, nil
+	}
+
+	ast := assert.New(t)
+	g := NewGroup(WithTTL[int, string](time.Minute))
+	s1, s2 := g.Scoped(), g.Scoped()
+
+	done := make(chan struct{})
+	for _, s := range []*Group[int, string]{s1, s2} {
+		go func(s *Group[int, string]) {
+			results, err := s.Do(context.Background(), []int{1}, loader)
+			ast.Nil(err)
+			ast.Equal(map[int]string{1: "val: 1"}, results)
+			done <- struct{}{}
+		}(s)
+	}
+
+	// the scoped groups don't coalesce
+	ast.Eventually(func() bool { return atomic.LoadInt32(&loaded) == 2 }, time.Second, time.Millisecond)
+	close(release)
+	<-done
+	<-done
+
+	// but they share the cache with each other and with g
+	for _, s := range []*Group[int, string]{g, s1, s2, g.Scoped()} {
+		results, err := s.Do(context.Background(), []int{1}, loader)
+		ast.Nil(err)
+		ast.Equal(map[int]string{1: "val: 1"}, results)
+	}
+	ast.Equal(int32(2), atomic.LoadInt32(&loaded))
+
+	// they are closed along with g
+	s3 := g.Scoped().Scoped()
+	ast.Nil(g.Drain(context.Background()))
+	_, err := s1.Do(context.Background(), []int{2}, loader)
+	ast.ErrorIs(err, ErrDraining)
+	ast.Nil(g.Close(context.Background()))
+	for _, s := range []*Group[int, string]{s1, s3, g.Scoped()} {
+		_, err = s.Do(context.Background(), []int{2}, loader)
+		ast.ErrorIs(err, ErrClosed)
+	}
+	ast.Equal(int32(2), atomic.LoadInt32(&loaded))
+}
+
+func TestTTLJitter(t *testing.T) {
+	const KeysNum = 100
+
+	var version, loaded int32
+	loader := countingLoader(&version, &loaded)
+
+	ast := assert.New(t)
+	clock := newFakeClock()
+	g := NewGroup(
+		WithTTL[int, string](time.Minute),
+		WithTTLJitter[int, string](0.2),
+	)
+	g.cache.now = clock.Now
+
+	keys := make([]int, 0, KeysNum)
+	for i := 0; i < KeysNum; i++ {
+		keys = append(keys, i)
+	}
+	_, err := g.Do(context.Background(), keys, loader)
+	ast.Nil(err)
+
+	expires := make(map[time.Time]struct{}, KeysNum)
+	for _, it := range g.cache.items {
+		ast.False(it.expires.Before(clock.Now().Add(time.Second * 48)))
+		ast.False(it.expires.After(clock.Now().Add(time.Second * 72)))
+		expires[it.expires] = struct{}{}
+	}
+	ast.Greater(len(expires), KeysNum/2)
+
+	// some, but not all, keys expire before the TTL
+	clock.Advance(time.Second * 55)
+	_, err = g.Do(context.Background(), keys, loader)
+	ast.Nil(err)
+	reloaded := atomic.LoadInt32(&loaded) - KeysNum
+	ast.Greater(reloaded, int32(0))
+	ast.Less(reloaded, int32(KeysNum))
+}
+
+func TestTTLJitterEntries(t *testing.T) {
+	loader := func(ctx context.Context, keys []int) (map[int]Entry[string], error) {
+		resuts := make(map[int]Entry[string], len(keys))
+		for _, k := range keys {
+			resuts[k] = Entry[string]{Val: fmt.Sprintf("val: %d", k), TTL: time.Duration(k) * time.Second}
+		}
+		return resuts, nil
+	}
+
+	ast := assert.New(t)
+	clock := newFakeClock()
+	g := NewGroup(
+		WithTTL[int, string](time.Minute),
+		WithTTLJitter[int, string](0.5),
+	)
+	g.cache.now = clock.Now
+
+	// the jitter applies to the TTL of every entry
+	g.cache.rand = func() float64 { return 0 }
+	_, err := g.DoEntries(context.Background(), []int{10}, loader)
+	ast.Nil(err)
+	g.cache.rand = func() float64 { return 0.75 }
+	_, err = g.DoEntries(context.Background(), []int{20}, loader)
+	ast.Nil(err)
+
+	ast.Equal(clock.Now().Add(time.Second*5), g.cache.items[10].expires)
+	ast.Equal(clock.Now().Add(time.Second*25), g.cache.items[20].expires)
+}
+
+func TestTTLConcurrentReload(t *testing.T) {
+	const WorkerNum = 100
+
+	var version, loaded int32
+	loader := countingLoader(&version, &loaded)
+	slowLoader := func(ctx context.Context, keys []int) (map[int]string, error) {
+		time.Sleep(time.Millisecond * 10)
+		return loader(ctx, keys)
+	}
+
+	ast := assert.New(t)
+	clock := newFakeClock()
+	g := NewGroup(WithTTL[int, string](time.Minute))
+	g.cache.now = clock.Now
+
+	_, err := g.Do(context.Background(), []int{1, 2}, slowLoader)
+	ast.Nil(err)
+
+	clock.Advance(time.Minute)
+	atomic.StoreInt32(&version, 1)
+
+	// every caller sees the expiry, but they share a single reload
+	wg := sync.WaitGroup{}
+	for i := 0; i < WorkerNum; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results, err := g.Do(context.Background(), []int{1, 2}, slowLoader)
+			ast.Nil(err)
+			ast.Equal(map[int]string{1: "val: 1 v1", 2: "val: 2 v1"}, results)
+		}()
+	}
+	wg.Wait()
+	ast.Equal(int32(4), atomic.LoadInt32(&loaded))
+	ast.Equal(0, g.Len())
+}
+
+func TestNegativeTTL(t *testing.T) {
+	var loaded int32
+	loader := func(ctx context.Context, keys []int) (map[int]string, error) {
+		atomic.AddInt32(&loaded, int32(len(keys)))
+		resuts := make(map[int]string, len(keys))
+		for _, k := range keys {
+			if k%2 == 0 {
+				resuts[k] = fmt.Sprintf("val: %d", k)
+			}
+		}
+		return resuts, nil
+	}
+
+	ast := assert.New(t)
+	clock := newFakeClock()
+	g := NewGroup(WithNegativeTTL[int, string](time.Second))
+	g.cache.now = clock.Now
+
+	results, err := g.Do(context.Background(), []int{1, 2}, loader)
+	ast.Nil(err)
+	ast.Equal(map[int]string{2: "val: 2"}, results)
+	ast.Equal(int32(2), loaded)
+
+	// only 2 is loaded again, values aren't cached without WithTTL
+	results, err = g.Do(context.Background(), []int{1, 2}, loader)
+	ast.Nil(err)
+	ast.Equal(map[int]string{2: "val: 2"}, results)
+	ast.Equal(int32(3), loaded)
+
+	clock.Advance(time.Second)
+	_, err = g.Do(context.Background(), []int{1}, loader)
+	ast.Nil(err)
+	ast.Equal(int32(4), loaded)
+
+	// MarkNotFound follows the negative TTL
+	g.MarkNotFound(4)
+	_, err = g.Do(context.Background(), []int{4}, loader)
+	ast.Nil(err)
+	ast.Equal(int32(4), loaded)
+	clock.Advance(time.Second)
+	_, err = g.Do(context.Background(), []int{4}, loader)
+	ast.Nil(err)
+	ast.Equal(int32(5), loaded)
+}
+
+func TestErrorTTL(t *testing.T) {
+	errBoom := errors.New("boom")
+	errOther := errors.New("other")
+	var calls int32
+	loader := func(ctx context.Context, keys []int) (map[int]string, error) {
+		atomic.AddInt32(&calls, 1)
+		if keys[0] == 3 {
+			return nil, errOther
+		}
+		return nil, errBoom
+	}
+
+	ast := assert.New(t)
+	clock := newFakeClock()
+	g := NewGroup(WithErrorTTL[int, string](time.Second, func(err error) bool {
+		return errors.Is(err, errBoom)
+	}))
+	g.cache.now = clock.Now
+
+	// callers retrying in a tight loop don't load the key again
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				_, err := g.Do(context.Background(), []int{1, 2}, loader)
+				ast.ErrorIs(err, errBoom)
+			}
+		}()
+	}
+	wg.Wait()
+	ast.Equal(int32(1), atomic.LoadInt32(&calls))
+
+	// the error expires with its own TTL
+	clock.Advance(time.Second)
+	_, err := g.Do(context.Background(), []int{1}, loader)
+	ast.ErrorIs(err, errBoom)
+	ast.Equal(int32(2), atomic.LoadInt32(&calls))
+
+	// Forget and DoRefresh don't use the cached error
+	g.Forget(1)
+	_, err = g.Do(context.Background(), []int{1}, loader)
+	ast.ErrorIs(err, errBoom)
+	ast.Equal(int32(3), atomic.LoadInt32(&calls))
+	_, err = g.DoRefresh(context.Background(), []int{1}, loader)
+	ast.ErrorIs(err, errBoom)
+	ast.Equal(int32(4), atomic.LoadInt32(&calls))
+
+	// errors that aren't cacheable are loaded every time
+	for i := 0; i < 3; i++ {
+		_, err = g.Do(context.Background(), []int{3}, loader)
+		ast.ErrorIs(err, errOther)
+	}
+	ast.Equal(int32(7), atomic.LoadInt32(&calls))
+}
+
+func TestLRU(t *testing.T) {
+	var version, loaded int32
+	loader := countingLoader(&version, &loaded)
+
+	ast := assert.New(t)
+	g := NewGroup(WithLRU[int, string](2))
+
+	_, err := g.Do(context.Background(), []int{1, 2}, loader)
+	ast.Nil(err)
+	// 1 becomes the most recently used, so 2 is evicted for 3
+	_, err = g.Do(context.Background(), []int{1}, loader)
+	ast.Nil(err)
+	_, err = g.Do(context.Background(), []int{3}, loader)
+	ast.Nil(err)
+	ast.Equal(int32(3), atomic.LoadInt32(&loaded))
+	ast.Equal(uint64(1), g.Stats().Evictions)
+
+	_, err = g.Do(context.Background(), []int{1, 3}, loader)
+	ast.Nil(err)
+	ast.Equal(int32(3), atomic.LoadInt32(&loaded))
+	_, err = g.Do(context.Background(), []int{2}, loader)
+	ast.Nil(err)
+	ast.Equal(int32(4), atomic.LoadInt32(&loaded))
+	ast.Equal(uint64(2), g.Stats().Evictions)
+
+	// with a TTL values expire before being evicted
+	clock := newFakeClock()
+	g = NewGroup(WithLRU[int, string](2), WithTTL[int, string](time.Second))
+	g.cache.now = clock.Now
+	_, err = g.Do(context.Background(), []int{1}, loader)
+	ast.Nil(err)
+	clock.Advance(time.Second)
+	_, err = g.Do(context.Background(), []int{1}, loader)
+	ast.Nil(err)
+	ast.Equal(int32(6), atomic.LoadInt32(&loaded))
+	ast.Equal(uint64(0), g.Stats().Evictions)
+}
+
+func TestMaxCacheBytes(t *testing.T) {
+	const MaxBytes = 100
+
+	ast := assert.New(t)
+	clock := newFakeClock()
+	size := func(key int, val string) int64 { return int64(len(val)) }
+	g := NewGroup(
+		WithMaxCacheBytes[int, string](MaxBytes, size),
+		WithTTL[int, string](time.Minute),
+		WithTTLJitter[int, string](0.5),
+	)
+	g.cache.now = clock.Now
+
+	// values too large for the cache are still returned
+	big := strings.Repeat("x", MaxBytes+1)
+	vals, err := g.Do(context.Background(), []int{1}, func(ctx context.Context, keys []int) (map[int]string, error) {
+		return map[int]string{1: big}, nil
+	})
+	ast.Nil(err)
+	ast.Equal(big, vals[1])
+	ast.Equal(0, len(g.Snapshot()))
+
+	// the accounted size always matches what is cached and stays bounded,
+	// whatever adds and removes values
+	r := rand.New(rand.NewSource(1))
+	loader := func(ctx context.Context, keys []int) (map[int]string, error) {
+		vals := make(map[int]string, len(keys))
+		for _, k := range keys {
+			vals[k] = strings.Repeat("v", r.Intn(MaxBytes/2))
+		}
+		return vals, nil
+	}
+	for i := 0; i < 10000; i++ {
+		key := r.Intn(20)
+		switch r.Intn(6) {
+		case 0:
+			g.Set(key, strings.Repeat("s", r.Intn(MaxBytes+10)))
+		case 1:
+			g.Invalidate(key)
+		case 2:
+			g.MarkNotFound(key)
+		case 3:
+			clock.Advance(time.Duration(r.Intn(30)) * time.Second)
+			g.cache.sweep()
+		default:
+			_, err := g.Do(context.Background(), []int{key, r.Intn(20)}, loader)
+			ast.Nil(err)
+		}
+
+		g.cache.mu.Lock()
+		var total int64
+		for k, it := range g.cache.items {
+			total += it.size
+			if !it.notFound {
+				ast.Equal(size(k, it.val), it.size)
+			}
+		}
+		ast.Equal(total, g.cache.bytes)
+		ast.LessOrEqual(g.cache.bytes, int64(MaxBytes))
+		ast.Equal(len(g.cache.items), g.cache.lru.Len())
+		g.cache.mu.Unlock()
+	}
+	ast.NotZero(g.Stats().Evictions)
+}
+
+func TestOnEvict(t *testing.T) {
+	var version, loaded int32
+	loader := countingLoader(&version, &loaded)
+
+	ast := assert.New(t)
+	clock := newFakeClock()
+	var (
+		g       *Group[int, string]
+		evicted map[int]EvictReason
+	)
+	onEvict := func(key int, val string, reason EvictReason) {
+		ast.Equal(fmt.Sprintf("val: %d v%d", key, atomic.LoadInt32(&version)), val)
+		evicted[key] = reason
+		// the callback may use the group
+		g.TryDo(context.Background(), []int{key})
+	}
+	g = NewGroup(
+		WithLRU[int, string](3),
+		WithTTL[int, string](time.Minute),
+		WithNegativeTTL[int, string](time.Minute),
+		WithOnEvict(onEvict),
+	)
+	g.cache.now = clock.Now
+
+	// LRU eviction
+	evicted = map[int]EvictReason{}
+	_, err := g.Do(context.Background(), []int{1, 2, 3, 4}, loader)
+	ast.Nil(err)
+	ast.Len(evicted, 1)
+
+	// Forget and Invalidate, and not found records don't count
+	evicted = map[int]EvictReason{}
+	g.MarkNotFound(5)
+	g.Forget(3, 5)
+	g.Invalidate(4)
+	ast.Equal(map[int]EvictReason{2: Evicted, 3: Invalidated, 4: Invalidated}, evicted)
+
+	// replaced by a newer value
+	evicted = map[int]EvictReason{}
+	_, err = g.Do(context.Background(), []int{6}, loader)
+	ast.Nil(err)
+	_, err = g.DoRefresh(context.Background(), []int{6}, loader)
+	ast.Nil(err)
+	ast.Equal(map[int]EvictReason{6: Replaced}, evicted)
+
+	// invalidated by a load finding the key missing
+	evicted = map[int]EvictReason{}
+	_, err = g.DoRefresh(context.Background(), []int{6}, func(ctx context.Context, keys []int) (map[int]string, error) {
+		return nil, nil
+	})
+	ast.Nil(err)
+	ast.Equal(map[int]EvictReason{6: Invalidated}, evicted)
+	_, err = g.DoRefresh(context.Background(), []int{6}, loader)
+	ast.Nil(err)
+
+	// expiry on read and by the janitor
+	evicted = map[int]EvictReason{}
+	_, err = g.Do(context.Background(), []int{8, 9}, loader)
+	ast.Nil(err)
+	clock.Advance(time.Minute)
+	_, _ = g.TryDo(context.Background(), []int{6})
+	ast.Equal(map[int]EvictReason{6: Expired}, evicted)
+	g.cache.sweep()
+	ast.Equal(map[int]EvictReason{6: Expired, 8: Expired, 9: Expired}, evicted)
+
+	// ForgetAll
+	evicted = map[int]EvictReason{}
+	_, err = g.Do(context.Background(), []int{6, 7}, loader)
+	ast.Nil(err)
+	g.ForgetAll()
+	ast.Equal(map[int]EvictReason{6: Invalidated, 7: Invalidated}, evicted)
+	ast.Equal("invalidated", Invalidated.String())
+}
+
+func TestResultIsolation(t *testing.T) {
+	loader := func(ctx context.Context, keys []int) (map[int][]int, error) {
+		results := make(map[int][]int, len(keys))
+		for _, k := range keys {
+			results[k] = []int{k}
+		}
+		return results, nil
+	}
+
+	ast := assert.New(t)
+
+	// the map is the caller's own even when served from the cache
+	g := NewGroup(WithTTL[int, []int](time.Minute))
+	for i := 0; i < 2; i++ {
+		results, err := g.Do(context.Background(), []int{1, 2}, loader)
+		ast.Nil(err)
+		ast.Equal(map[int][]int{1: {1}, 2: {2}}, results)
+		delete(results, 1)
+		results[3] = []int{3}
+	}
+
+	// cloned values are the caller's own too
+	clone := func(v []int) []int { return append([]int(nil), v...) }
+	g = NewGroup(WithTTL[int, []int](time.Minute), WithValueClone[int, []int](clone))
+	for i := 0; i < 2; i++ {
+		results, err := g.Do(context.Background(), []int{1}, loader)
+		ast.Nil(err)
+		ast.Equal(map[int][]int{1: {1}}, results)
+		results[1][0] = 100
+	}
+	g.Set(2, []int{2})
+	results, _ := g.TryDo(context.Background(), []int{2})
+	results[2][0] = 100
+	ast.Equal(map[int]Entry[[]int]{1: {Val: []int{1}}, 2: {Val: []int{2}}}, stripExpiry(g.Snapshot()))
+}
+
+// stripExpiry drops the expiry of entries for comparisons.
+func stripExpiry[V any](entries map[int]Entry[V]) map[int]Entry[V] {
+	for k, e := range entries {
+		e.Expires = time.Time{}
+		entries[k] = e
+	}
+	return entries
+}
+
+func TestSoftTTL(t *testing.T) {
+	var version, loaded int32
+	loader := countingLoader(&version, &loaded)
+	release := make(chan struct{})
+	slow := func(ctx context.Context, keys []int) (map[int]string, error) {
+		<-release
+		return loader(ctx, keys)
+	}
+
+	ast := assert.New(t)
+	clock := newFakeClock()
+	g := NewGroup(WithTTL[int, string](time.Second*10), WithSoftTTL[int, string](time.Second*5))
+	g.cache.now = clock.Now
+
+	_, err := g.Do(context.Background(), []int{1}, loader)
+	ast.Nil(err)
+
+	// fresh values are served without reloading
+	clock.Advance(time.Second * 4)
+	_, err = g.Do(context.Background(), []int{1}, slow)
+	ast.Nil(err)
+	ast.Equal(0, g.Len())
+
+	// stale values are served right away while one reload runs
+	clock.Advance(time.Second * 2)
+	atomic.StoreInt32(&version, 1)
+	wg := sync.WaitGroup{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results, err := g.Do(context.Background(), []int{1}, slow)
+			ast.Nil(err)
+			ast.Equal(map[int]string{1: "val: 1 v0"}, results)
+		}()
+	}
+	wg.Wait()
+	ast.Equal(1, g.Len())
+	close(release)
+	ast.Eventually(func() bool { return g.Len() == 0 }, time.Second, time.Millisecond)
+	ast.Equal(int32(2), atomic.LoadInt32(&loaded))
+
+	results, err := g.Do(context.Background(), []int{1}, loader)
+	ast.Nil(err)
+	ast.Equal(map[int]string{1: "val: 1 v1"}, results)
+
+	// expired values are loaded before being served
+	clock.Advance(time.Second * 10)
+	atomic.StoreInt32(&version, 2)
+	results, err = g.Do(context.Background(), []int{1}, loader)
+	ast.Nil(err)
+	ast.Equal(map[int]string{1: "val: 1 v2"}, results)
+	ast.Equal(int32(3), atomic.LoadInt32(&loaded))
+}
+
+func TestValueEqual(t *testing.T) {
+	var version, loaded int32
+	loader := countingLoader(&version, &loaded)
+
+	ast := assert.New(t)
+	clock := newFakeClock()
+	var evicted []int
+	onEvict := func(key int, val string, reason EvictReason) {
+		evicted = append(evicted, key)
+	}
+	g := NewGroup(
+		WithTTL[int, string](time.Minute),
+		WithOnEvict(onEvict),
+		WithValueEqual[int, string](func(a, b string) bool { return a == b }),
+	)
+	g.cache.now = clock.Now
+
+	_, err := g.Do(context.Background(), []int{1, 2}, loader)
+	ast.Nil(err)
+
+	// refreshing with equal values keeps them and their expiry
+	clock.Advance(time.Second * 40)
+	_, err = g.DoRefresh(context.Background(), []int{1, 2}, loader)
+	ast.Nil(err)
+	ast.Equal(int32(4), atomic.LoadInt32(&loaded))
+	ast.Empty(evicted)
+	clock.Advance(time.Second * 30)
+	_, err = g.Do(context.Background(), []int{1}, loader)
+	ast.Nil(err)
+	ast.Equal(int32(5), atomic.LoadInt32(&loaded))
+	ast.Equal([]int{1}, evicted) // expired
+
+	// new values replace them
+	evicted = nil
+	atomic.StoreInt32(&version, 1)
+	_, err = g.DoRefresh(context.Background(), []int{1}, loader)
+	ast.Nil(err)
+	ast.Equal([]int{1}, evicted)
+
+	// or the equal values get the new expiry
+	evicted = nil
+	g = NewGroup(
+		WithTTL[int, string](time.Minute),
+		WithOnEvict(onEvict),
+		WithValueEqual[int, string](func(a, b string) bool { return a == b }),
+		WithEqualValueExtendsTTL[int, string](),
+	)
+	g.cache.now = clock.Now
+	_, err = g.Do(context.Background(), []int{1}, loader)
+	ast.Nil(err)
+	clock.Advance(time.Second * 40)
+	g.Set(1, "val: 1 v1")
+	clock.Advance(time.Second * 30)
+	results, err := g.Do(context.Background(), []int{1}, loader)
+	ast.Nil(err)
+	ast.Equal(map[int]string{1: "val: 1 v1"}, results)
+	ast.Equal(int32(7), atomic.LoadInt32(&loaded))
+	ast.Empty(evicted)
+
+	// the equal values are fresh again, extended or not
+	g = NewGroup(
+		WithTTL[int, string](time.Minute),
+		WithSoftTTL[int, string](time.Second*20),
+		WithValueEqual[int, string](func(a, b string) bool { return a == b }),
+	)
+	g.cache.now = clock.Now
+	stale := func() bool {
+		g.cache.mu.Lock()
+		defer g.cache.mu.Unlock()
+		return g.cache.isStale(*g.cache.items[1])
+	}
+	_, err = g.Do(context.Background(), []int{1}, loader)
+	ast.Nil(err)
+	clock.Advance(time.Second * 30)
+	ast.True(stale())
+	_, err = g.DoRefresh(context.Background(), []int{1}, loader)
+	ast.Nil(err)
+	ast.False(stale())
+	clock.Advance(time.Second * 20)
+	ast.True(stale())
+}
+
+func TestOnChange(t *testing.T) {
+	var version, loaded int32
+	loader := countingLoader(&version, &loaded)
+
+	ast := assert.New(t)
+	type changed struct {
+		key      int
+		old, new string
+	}
+	var (
+		g       *Group[int, string]
+		changes []changed
+	)
+	onChange := func(key int, oldVal, newVal string) {
+		changes = append(changes, changed{key, oldVal, newVal})
+		// the callback may use the group
+		g.TryDo(context.Background(), []int{key})
+	}
+	g = NewGroup(WithTTL[int, string](time.Minute), WithOnChange(onChange))
+
+	// neither first loads nor equal values are changes
+	_, err := g.Do(context.Background(), []int{1, 2}, loader)
+	ast.Nil(err)
+	_, err = g.DoRefresh(context.Background(), []int{1}, loader)
+	ast.Nil(err)
+	g.Set(2, "set")
+	ast.Empty(changes)
+
+	atomic.StoreInt32(&version, 1)
+	_, err = g.DoRefresh(context.Background(), []int{1, 3}, loader)
+	ast.Nil(err)
+	ast.Equal([]changed{{1, "val: 1 v0", "val: 1 v1"}}, changes)
+
+	// values that can't be compared with == always differ
+	var calls int
+	h := NewGroup(
+		WithTTL[int, []byte](time.Minute),
+		WithOnChange(func(key int, oldVal, newVal []byte) { calls++ }),
+	)
+	bytes := func(ctx context.Context, keys []int) (map[int][]byte, error) {
+		return map[int][]byte{1: []byte("1")}, nil
+	}
+	_, err = h.Do(context.Background(), []int{1}, bytes)
+	ast.Nil(err)
+	_, err = h.DoRefresh(context.Background(), []int{1}, bytes)
+	ast.Nil(err)
+	ast.Equal(1, calls)
+
+	// nor do values holding interfaces, whatever their dynamic values
+	type blob struct{ Data any }
+	calls = 0
+	b := NewGroup(
+		WithTTL[int, blob](time.Minute),
+		WithOnChange(func(key int, oldVal, newVal blob) { calls++ }),
+	)
+	blobs := func(ctx context.Context, keys []int) (map[int]blob, error) {
+		return map[int]blob{1: {Data: []byte("1")}}, nil
+	}
+	_, err = b.Do(context.Background(), []int{1}, blobs)
+	ast.Nil(err)
+	_, err = b.DoRefresh(context.Background(), []int{1}, blobs)
+	ast.Nil(err)
+	ast.Equal(1, calls)
+	ast.True(isComparable[struct{ A [2]int }]())
+	ast.False(isComparable[[2]any]())
+}
+
+func TestStaleWhileRevalidate(t *testing.T) {
+	var version, loaded int32
+	loader := countingLoader(&version, &loaded)
+	release := make(chan struct{})
+	slow := func(ctx context.Context, keys []int) (map[int]string, error) {
+		<-release
+		return loader(ctx, keys)
+	}
+
+	ast := assert.New(t)
+	clock := newFakeClock()
+	g := NewGroup(WithTTL[int, string](time.Second*10), WithStaleWhileRevalidate[int, string](time.Second*5))
+	g.cache.now = clock.Now
+
+	_, err := g.Do(context.Background(), []int{1}, loader)
+	ast.Nil(err)
+
+	// expired values within the grace are served right away while one
+	// reload runs
+	clock.Advance(time.Second * 12)
+	atomic.StoreInt32(&version, 1)
+	for i := 0; i < 10; i++ {
+		results, err := g.Do(context.Background(), []int{1}, slow)
+		ast.Nil(err)
+		ast.Equal(map[int]string{1: "val: 1 v0"}, results)
+	}
+	ast.Equal(1, g.Len())
+	close(release)
+	ast.Eventually(func() bool { return g.Len() == 0 }, time.Second, time.Millisecond)
+	ast.Equal(int32(2), atomic.LoadInt32(&loaded))
+	results, err := g.Do(context.Background(), []int{1}, loader)
+	ast.Nil(err)
+	ast.Equal(map[int]string{1: "val: 1 v1"}, results)
+	ast.Equal(int32(2), atomic.LoadInt32(&loaded))
+
+	// values expired past the grace are loaded before being served
+	clock.Advance(time.Second * 16)
+	atomic.StoreInt32(&version, 2)
+	results, err = g.Do(context.Background(), []int{1}, loader)
+	ast.Nil(err)
+	ast.Equal(map[int]string{1: "val: 1 v2"}, results)
+	ast.Equal(int32(3), atomic.LoadInt32(&loaded))
+}
+
+func TestStaleWhileRevalidateSnapshot(t *testing.T) {
+	var version, loaded int32
+	loader := countingLoader(&version, &loaded)
+
+	ast := assert.New(t)
+	clock := newFakeClock()
+	newGroup := func() *Group[int, string] {
+		g := NewGroup(WithTTL[int, string](time.Second*10), WithStaleWhileRevalidate[int, string](time.Second*5))
+		g.cache.now = clock.Now
+		return g
+	}
+	g := newGroup()
+	_, err := g.Do(context.Background(), []int{1, 2}, loader)
+	ast.Nil(err)
+
+	// snapshots carry the TTL without the grace, round trip after round
+	// trip
+	expires := clock.Now().Add(time.Second * 10)
+	for i := 0; i < 3; i++ {
+		entries := g.Snapshot()
+		ast.Equal(map[int]Entry[string]{
+			1: {Val: "val: 1 v0", Expires: expires},
+			2: {Val: "val: 2 v0", Expires: expires},
+		}, entries)
+		g = newGroup()
+		g.Restore(entries)
+	}
+
+	// stale values are left out, and reloaded rather than restored
+	clock.Advance(time.Second * 8)
+	_, err = g.DoRefresh(context.Background(), []int{2}, loader)
+	ast.Nil(err)
+	clock.Advance(time.Second * 4)
+	entries := g.Snapshot()
+	ast.Equal(map[int]Entry[string]{
+		2: {Val: "val: 2 v0", Expires: clock.Now().Add(time.Second * 6)},
+	}, entries)
+	g = newGroup()
+	g.Restore(map[int]Entry[string]{1: {Val: "val: 1 v0", Expires: expires}})
+	atomic.StoreInt32(&version, 1)
+	results, err := g.Do(context.Background(), []int{1}, loader)
+	ast.Nil(err)
+	ast.Equal(map[int]string{1: "val: 1 v1"}, results)
+}
+
+func TestEarlyExpiration(t *testing.T) {
+	var version, loaded int32
+	counting := countingLoader(&version, &loaded)
+	loader := func(ctx context.Context, keys []int) (map[int]string, error) {
+		time.Sleep(time.Millisecond * 2)
+		return counting(ctx, keys)
+	}
+
+	ast := assert.New(t)
+	clock := newFakeClock()
+	var draw atomic.Value
+	draw.Store(0.0)
+	g := NewGroup(WithTTL[int, string](time.Minute), WithEarlyExpiration[int, string](1))
+	g.cache.now = clock.Now
+	g.cache.rand = func() float64 { return draw.Load().(float64) }
+
+	_, err := g.Do(context.Background(), []int{1}, loader)
+	ast.Nil(err)
+
+	// far from expiry even an unlucky draw serves the cached value
+	draw.Store(0.99999999)
+	_, err = g.Do(context.Background(), []int{1}, loader)
+	ast.Nil(err)
+	ast.Equal(int32(1), atomic.LoadInt32(&loaded))
+
+	// close to expiry a lucky draw still serves it, an unlucky one reloads
+	clock.Advance(time.Minute - time.Millisecond*10)
+	atomic.StoreInt32(&version, 1)
+	draw.Store(0.0)
+	results, err := g.Do(context.Background(), []int{1}, loader)
+	ast.Nil(err)
+	ast.Equal(map[int]string{1: "val: 1 v0"}, results)
+	draw.Store(0.99999999)
+	results, err = g.Do(context.Background(), []int{1}, loader)
+	ast.Nil(err)
+	ast.Equal(map[int]string{1: "val: 1 v1"}, results)
+	ast.Equal(int32(2), atomic.LoadInt32(&loaded))
+}
+
+func TestSet(t *testing.T) {
+	var version, loaded int32
+	loader := countingLoader(&version, &loaded)
+	release := make(chan struct{})
+	slow := func(ctx context.Context, keys []int) (map[int]string, error) {
+		<-release
+		return loader(ctx, keys)
+	}
+
+	ast := assert.New(t)
+	g := NewGroup(WithTTL[int, string](time.Minute))
+
+	g.Set(1, "set: 1")
+	g.SetMany(map[int]string{2: "set: 2"})
+	results, err := g.Do(context.Background(), []int{1, 2}, loader)
+	ast.Nil(err)
+	ast.Equal(map[int]string{1: "set: 1", 2: "set: 2"}, results)
+	ast.Equal(int32(0), atomic.LoadInt32(&loaded))
+
+	// Set wins over the load in flight
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		results, err := g.Do(context.Background(), []int{3}, slow)
+		ast.Nil(err)
+		ast.Equal(map[int]string{3: "val: 3 v0"}, results)
+	}()
+	ast.Eventually(func() bool { return g.Len() == 1 }, time.Second, time.Millisecond)
+	g.Set(3, "set: 3")
+	close(release)
+	<-done
+
+	results, err = g.Do(context.Background(), []int{3}, loader)
+	ast.Nil(err)
+	ast.Equal(map[int]string{3: "set: 3"}, results)
+	ast.Equal(int32(1), atomic.LoadInt32(&loaded))
+}
+
+func TestSetReplacesFailures(t *testing.T) {
+	errBoom := errors.New("boom")
+	var calls int32
+	loader := func(ctx context.Context, keys []int) (map[int]string, error) {
+		atomic.AddInt32(&calls, 1)
+		if keys[0] == 2 {
+			return nil, errBoom
+		}
+		return map[int]string{}, nil
+	}
+
+	ast := assert.New(t)
+	g := NewGroup(
+		WithTTL[int, string](time.Minute),
+		WithNegativeTTL[int, string](time.Minute),
+		WithErrorTTL[int, string](time.Minute, nil),
+	)
+
+	// 1 is cached as not found and 2 with its error
+	_, err := g.Do(context.Background(), []int{1}, loader)
+	ast.Nil(err)
+	_, err = g.Do(context.Background(), []int{2}, loader)
+	ast.ErrorIs(err, errBoom)
+
+	g.SetMany(map[int]string{1: "set: 1", 2: "set: 2"})
+	results, err := g.Do(context.Background(), []int{1, 2}, loader)
+	ast.Nil(err)
+	ast.Equal(map[int]string{1: "set: 1", 2: "set: 2"}, results)
+	ast.Equal(int32(2), atomic.LoadInt32(&calls))
+}
+
+func TestInvalidate(t *testing.T) {
+	var version, loaded int32
+	loader := countingLoader(&version, &loaded)
+	release := make(chan struct{})
+	slow := func(ctx context.Context, keys []int) (map[int]string, error) {
+		results, err := loader(ctx, keys)
+		<-release
+		return results, err
+	}
+
+	ast := assert.New(t)
+	store := NewMemoryCache[int, string]()
+	g := NewGroup(
+		WithTTL[int, string](time.Minute),
+		WithCache[int, string](store),
+	)
+
+	_, err := g.Do(context.Background(), []int{1}, loader)
+	ast.Nil(err)
+	g.Invalidate(1)
+	vals, _ := store.Get(context.Background(), []int{1})
+	ast.Empty(vals)
+	atomic.StoreInt32(&version, 1)
+	results, err := g.Do(context.Background(), []int{1}, loader)
+	ast.Nil(err)
+	ast.Equal(map[int]string{1: "val: 1 v1"}, results)
+
+	// a value read before a write is invalidated while its load is in
+	// flight: the callers get it but it isn't cached
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		results, err := g.Do(context.Background(), []int{2}, slow)
+		ast.Nil(err)
+		ast.Equal(map[int]string{2: "val: 2 v1"}, results)
+	}()
+	ast.Eventually(func() bool { return atomic.LoadInt32(&loaded) == 3 }, time.Second, time.Millisecond)
+	atomic.StoreInt32(&version, 2)
+	g.Invalidate(2)
+	ast.Equal(1, g.Len())
+	close(release)
+	<-done
+
+	results, err = g.Do(context.Background(), []int{2}, loader)
+	ast.Nil(err)
+	ast.Equal(map[int]string{2: "val: 2 v2"}, results)
+	ast.Equal(int32(4), atomic.LoadInt32(&loaded))
+}
+
+func TestForgetUnshared(t *testing.T) {
+	var version, loaded int32
+	loader := countingLoader(&version, &loaded)
+	release := make(chan struct{})
+	slow := func(ctx context.Context, keys []int) (map[int]string, error) {
+		<-release
+		return loader(ctx, keys)
+	}
+
+	ast := assert.New(t)
+	g := NewGroup(WithTTL[int, string](time.Minute), WithSoftTTL[int, string](time.Second))
+	clock := newFakeClock()
+	g.cache.now = clock.Now
+	_, err := g.Do(context.Background(), []int{1, 2}, loader)
+	ast.Nil(err)
+
+	// 2 is stale and being reloaded
+	clock.Advance(time.Second)
+	_, err = g.Do(context.Background(), []int{2}, slow)
+	ast.Nil(err)
+	ast.Equal(1, g.Len())
+
+	g.ForgetUnshared()
+	ast.Equal(1, g.Len())
+	results, misses := g.TryDo(context.Background(), []int{1, 2})
+	ast.Equal(map[int]string{2: "val: 2 v0"}, results)
+	ast.Equal([]int{1}, misses)
+
+	close(release)
+	ast.Eventually(func() bool { return g.Len() == 0 }, time.Second, time.Millisecond)
+	_, err = g.Do(context.Background(), []int{1}, loader)
+	ast.Nil(err)
+	ast.Equal(int32(4), atomic.LoadInt32(&loaded))
+}
+
+func TestSnapshotRestore(t *testing.T) {
+	var version, loaded int32
+	loader := countingLoader(&version, &loaded)
+
+	ast := assert.New(t)
+	clock := newFakeClock()
+	g := NewGroup(WithTTL[int, string](time.Minute))
+	g.cache.now = clock.Now
+	_, err := g.Do(context.Background(), []int{1, 2}, loader)
+	ast.Nil(err)
+
+	snapshot := g.Snapshot()
+	ast.Equal(map[int]Entry[string]{
+		1: {Val: "val: 1 v0", Expires: clock.Now().Add(time.Minute)},
+		2: {Val: "val: 2 v0", Expires: clock.Now().Add(time.Minute)},
+	}, snapshot)
+	snapshot[3] = Entry[string]{Val: "val: 3 v0", Expires: clock.Now()}
+
+	restored := NewGroup(WithTTL[int, string](time.Minute))
+	restored.cache.now = clock.Now
+	restored.Set(2, "fresh: 2")
+	clock.Advance(time.Second)
+	restored.Restore(snapshot)
+
+	// 1 is restored, 2 was fresher and 3 had expired
+	atomic.StoreInt32(&loaded, 0)
+	results, err := restored.Do(context.Background(), []int{1, 2, 3}, loader)
+	ast.Nil(err)
+	ast.Equal(map[int]string{1: "val: 1 v0", 2: "fresh: 2", 3: "val: 3 v0"}, results)
+	ast.Equal(int32(1), atomic.LoadInt32(&loaded))
+
+	// restored values keep their expiry
+	clock.Advance(time.Minute - time.Second)
+	_, err = restored.Do(context.Background(), []int{1}, loader)
+	ast.Nil(err)
+	ast.Equal(int32(2), atomic.LoadInt32(&loaded))
+}
+
+func TestExportImport(t *testing.T) {
+	var version, loaded int32
+	loader := countingLoader(&version, &loaded)
+
+	ast := assert.New(t)
+	clock := newFakeClock()
+	g := NewGroup(WithTTL[int, string](time.Minute))
+	g.cache.now = clock.Now
+	_, err := g.Do(context.Background(), []int{1, 2}, loader)
+	ast.Nil(err)
+	g.MarkNotFound(3)
+	exported := g.Export()
+	ast.Equal(map[int]string{1: "val: 1 v0", 2: "val: 2 v0"}, exported)
+
+	// imported values get the TTL from the import
+	clock.Advance(time.Minute)
+	imported := NewGroup(WithTTL[int, string](time.Minute))
+	imported.cache.now = clock.Now
+	imported.Set(2, "fresh: 2")
+	imported.Import(exported)
+	atomic.StoreInt32(&loaded, 0)
+	results, err := imported.Do(context.Background(), []int{1, 2}, loader)
+	ast.Nil(err)
+	ast.Equal(map[int]string{1: "val: 1 v0", 2: "fresh: 2"}, results)
+	ast.Equal(int32(0), atomic.LoadInt32(&loaded))
+	clock.Advance(time.Minute)
+	_, err = imported.Do(context.Background(), []int{1}, loader)
+	ast.Nil(err)
+	ast.Equal(int32(1), atomic.LoadInt32(&loaded))
+
+	ast.Nil(NewGroup[int, string]().Export())
+}
+
+func TestValueInterner(t *testing.T) {
+	type config struct{ name string }
+	loader := func(ctx context.Context, keys []int) (map[int]*config, error) {
+		vals := make(map[int]*config, len(keys))
+		for _, k := range keys {
+			vals[k] = &config{name: fmt.Sprintf("config %d", k%2)}
+		}
+		return vals, nil
+	}
+
+	ast := assert.New(t)
+	g := NewGroup(
+		WithTTL[int, *config](time.Minute),
+		WithValueInterner[int, *config](func(c *config) any { return c.name }),
+	)
+	_, err := g.Do(context.Background(), []int{1, 2, 3}, loader)
+	ast.Nil(err)
+
+	// keys with equal values share the cached one
+	vals, _ := g.TryDo(context.Background(), []int{1, 2, 3})
+	ast.Same(vals[1], vals[3])
+	ast.NotSame(vals[1], vals[2])
+	ast.Equal("config 1", vals[1].name)
+	ast.Len(g.cache.interned, 2)
+
+	// a shared value lives as long as one of its keys is cached
+	g.Invalidate(1)
+	ast.Len(g.cache.interned, 2)
+	_, err = g.Do(context.Background(), []int{5}, loader)
+	ast.Nil(err)
+	vals, _ = g.TryDo(context.Background(), []int{3, 5})
+	ast.Same(vals[3], vals[5])
+	g.Invalidate(3, 5)
+	ast.Len(g.cache.interned, 1)
+	g.Set(2, &config{name: "config 2"})
+	ast.Len(g.cache.interned, 1)
+	g.ForgetAll()
+	ast.Empty(g.cache.interned)
+}
@@ -0,0 +1,52 @@
+package multiflight
+
+import (
+	"context"
+	"errors"
+)
+
+// CancelPolicy is what a call returns when its context ends while it
+// waits for keys.
+type CancelPolicy int
+
+const (
+	// CancelError fails the whole call with the context error. It is the
+	// default.
+	CancelError CancelPolicy = iota
+	// CancelPartial returns the values of the keys completed so far along
+	// with a *KeysError wrapping the context error listing the others.
+	CancelPartial
+)
+
+// WithCancelPolicy sets what a call returns when its context ends while
+// it waits for keys. Whatever the policy, the loads it waits for go on
+// and still complete their keys for the other callers and the cache.
+func WithCancelPolicy[K comparable, V any](policy CancelPolicy) Option[K, V] {
+	return func(o *options[K, V]) {
+		o.cancelPolicy = policy
+	}
+}
+
+// canceled is what a call waiting for ents returns once ctx is done,
+// result holding the values of the keys served so far.
+func (g *Group[K, V]) canceled(ctx context.Context, result map[K]V, ents []*ent[K, V]) (map[K]V, error) {
+	if g.opts.cancelPolicy != CancelPartial {
+		return nil, ctx.Err()
+	}
+	pending := pendingKeys(ents)
+	for _, e := range ents {
+		select {
+		case <-e.done:
+		default:
+			continue
+		}
+		if e.err != nil {
+			if errors.Is(e.err, errResultNotFound) {
+				continue
+			}
+			return nil, e.err
+		}
+		result[e.key] = e.val
+	}
+	return result, &KeysError[K]{Keys: pending, Err: ctx.Err()}
+}
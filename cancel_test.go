@@ -0,0 +1,68 @@
+package multiflight
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCancelPolicy(t *testing.T) {
+	for _, policy := range []CancelPolicy{CancelError, CancelPartial} {
+		t.Run(fmt.Sprint(policy), func(t *testing.T) {
+			release := map[int]chan struct{}{1: make(chan struct{}), 2: make(chan struct{})}
+			loader := func(ctx context.Context, keys []int) (map[int]string, error) {
+				<-release[keys[0]]
+				return map[int]string{keys[0]: fmt.Sprint(keys[0])}, nil
+			}
+
+			ast := assert.New(t)
+			g := NewGroup(
+				WithMaxBatchSize[int, string](1),
+				WithCancelPolicy[int, string](policy),
+			)
+
+			leader := make(chan error, 1)
+			go func() {
+				_, err := g.Do(context.Background(), []int{1, 2}, loader)
+				leader <- err
+			}()
+			ast.Eventually(func() bool { return g.Len() == 2 }, time.Second, time.Millisecond)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			type res struct {
+				vals map[int]string
+				err  error
+			}
+			follower := make(chan res, 1)
+			go func() {
+				vals, err := g.Do(ctx, []int{1, 2}, loader)
+				follower <- res{vals, err}
+			}()
+			ast.Eventually(func() bool { return g.Stats().Waiters == 4 }, time.Second, time.Millisecond)
+
+			// key 1 completes before the follower gives up on key 2
+			close(release[1])
+			ast.Eventually(func() bool { return g.Len() == 1 }, time.Second, time.Millisecond)
+			cancel()
+			r := <-follower
+			ast.ErrorIs(r.err, context.Canceled)
+			if policy == CancelPartial {
+				ast.Equal(map[int]string{1: "1"}, r.vals)
+				var kerr *KeysError[int]
+				ast.ErrorAs(r.err, &kerr)
+				ast.Equal([]int{2}, kerr.Keys)
+			} else {
+				ast.Nil(r.vals)
+				ast.Same(context.Canceled, r.err)
+			}
+
+			// the load goes on for the leader
+			close(release[2])
+			ast.Nil(<-leader)
+			ast.Equal(0, g.Len())
+		})
+	}
+}
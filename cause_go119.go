@@ -0,0 +1,10 @@
+//go:build !go1.20
+
+package multiflight
+
+import "context"
+
+// cause returns why ctx is done, its error before Go 1.20.
+func cause(ctx context.Context) error {
+	return ctx.Err()
+}
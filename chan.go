@@ -0,0 +1,128 @@
+package multiflight
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+// Result is the outcome of a key in the sequence of DoSeq or on a
+// channel of DoChanPerKey.
+type Result[V any] struct {
+	Val V
+	Err error
+}
+
+// DoChanPerKey is like Do but returns right away with a channel per
+// distinct key, which receives the result of its key as soon as it is
+// there and is then closed, so every key can be handed to a consumer of
+// its own. The channels of keys not found are closed without a result,
+// and an error failing the whole call, ctx ending or ErrFollowerTimeout
+// included, is sent on the channels of every key it leaves pending.
+// The channels are buffered: results nobody receives are dropped with
+// the channels.
+func (g *Group[K, V]) DoChanPerKey(ctx context.Context, keys []K, load Loader[K, V], opts ...CallOption) map[K]<-chan Result[V] {
+	if p := g.partitionOf(ctx); p != g {
+		return p.DoChanPerKey(ctx, keys, load, append([]CallOption{pinned}, opts...)...)
+	}
+	chans := make(map[K]chan Result[V], len(keys))
+	for _, key := range keys {
+		chans[key] = make(chan Result[V], 1)
+	}
+	results := make(map[K]<-chan Result[V], len(chans))
+	for key, ch := range chans {
+		results[key] = ch
+	}
+
+	co := newCallOptions(opts)
+	load = g.loaderOf(load, &co)
+	go g.doChan(ctx, keys, load.batch(), co, chans)
+	return results
+}
+
+// doChan runs the call of DoChanPerKey, sending the result of every key
+// on its channel.
+func (g *Group[K, V]) doChan(ctx context.Context, keys []K, load loadFunc[K, V], co callOptions, chans map[K]chan Result[V]) {
+	send := func(key K, r Result[V]) {
+		ch, ok := chans[key]
+		if !ok {
+			return
+		}
+		ch <- r
+		close(ch)
+		delete(chans, key)
+	}
+	c, err := g.begin(ctx, keys, load, co)
+	if err != nil {
+		for key := range chans {
+			send(key, Result[V]{Err: err})
+		}
+		return
+	}
+	defer g.leave(c)
+
+	for k, v := range c.result {
+		send(k, Result[V]{Val: v})
+	}
+	for _, k := range c.shed {
+		send(k, Result[V]{Err: &KeysError[K]{Keys: c.shed, Err: ErrShed}})
+	}
+	for _, k := range c.rejected {
+		send(k, Result[V]{Err: &KeysError[K]{Keys: c.rejected, Err: ErrTooManyWaiters}})
+	}
+
+	// forward the entries as they complete, each on its own
+	follow, cancel := g.followerContext(ctx, c)
+	defer cancel()
+	own := make(map[*ent[K, V]]struct{}, len(c.missEnts))
+	for _, e := range c.missEnts {
+		own[e] = struct{}{}
+	}
+	var wg sync.WaitGroup
+	for _, e := range c.ents {
+		ch, ok := chans[e.key]
+		if !ok {
+			continue
+		}
+		delete(chans, e.key)
+		done := follow.Done()
+		if _, leader := own[e]; leader {
+			done = ctx.Done()
+		}
+		wg.Add(1)
+		go func(e *ent[K, V]) {
+			defer wg.Done()
+			defer close(ch)
+			select {
+			case <-e.done:
+			case <-done:
+				err := ctx.Err()
+				if err == nil {
+					err = ErrFollowerTimeout
+				}
+				ch <- Result[V]{Err: err}
+				return
+			}
+			switch {
+			case errors.Is(e.err, errResultNotFound):
+			case e.err != nil:
+				ch <- Result[V]{Err: e.err}
+			default:
+				ch <- Result[V]{Val: e.val}
+			}
+		}(e)
+	}
+	// keys filtered out
+	for _, ch := range chans {
+		close(ch)
+	}
+
+	if len(c.missEnts) > 0 {
+		if g.opts.batchWindow > 0 {
+			g.enqueue(ctx, c.missEnts, load, co.source, co.priority)
+		} else {
+			g.runLoad(ctx, c.missEnts, load)
+		}
+	}
+	wg.Wait()
+}
@@ -0,0 +1,73 @@
+package multiflight
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDoChanPerKey(t *testing.T) {
+	errBoom := errors.New("boom")
+	release := make(chan struct{})
+	loader := func(ctx context.Context, keys []int) (map[int]string, error) {
+		if keys[0] == 4 {
+			return nil, errBoom
+		}
+		vals := make(map[int]string, len(keys))
+		for _, k := range keys {
+			if k == 2 {
+				<-release
+			}
+			if k != 3 {
+				vals[k] = fmt.Sprint(k)
+			}
+		}
+		return vals, nil
+	}
+
+	ast := assert.New(t)
+	g := NewGroup(WithTTL[int, string](time.Minute), WithMaxBatchSize[int, string](1))
+	_, err := g.Do(context.Background(), []int{1}, loader)
+	ast.Nil(err)
+
+	chans := g.DoChanPerKey(context.Background(), []int{1, 2, 3, 4, 5, 5}, loader)
+	ast.Len(chans, 5)
+	ast.Equal(Result[string]{Val: "1"}, <-chans[1])
+	ast.Equal(Result[string]{Val: "5"}, <-chans[5])
+	r := <-chans[4]
+	ast.ErrorIs(r.Err, errBoom)
+	_, ok := <-chans[3]
+	ast.False(ok) // not found
+
+	// the other keys go on while one is loading
+	select {
+	case <-chans[2]:
+		t.Fatal("key 2 is still loading")
+	default:
+	}
+	close(release)
+	ast.Equal(Result[string]{Val: "2"}, <-chans[2])
+
+	// every channel receives once and is closed
+	for _, ch := range chans {
+		_, ok := <-ch
+		ast.False(ok)
+	}
+	ast.Eventually(func() bool { return g.Stats().Waiters == 0 }, time.Second, time.Millisecond)
+
+	// ctx ending fails the keys left
+	block := make(chan struct{})
+	defer close(block)
+	ctx, cancel := context.WithCancel(context.Background())
+	chans = g.DoChanPerKey(ctx, []int{1, 6}, func(ctx context.Context, keys []int) (map[int]string, error) {
+		<-block
+		return nil, nil
+	})
+	ast.Equal(Result[string]{Val: "1"}, <-chans[1])
+	cancel()
+	ast.Equal(Result[string]{Err: context.Canceled}, <-chans[6])
+}
@@ -0,0 +1,159 @@
+package multiflight
+
+import (
+	"context"
+	"errors"
+)
+
+var (
+	// ErrClosed is returned by calls to a closed group, and for loads
+	// that can't run because the group was closed.
+	ErrClosed = errors.New("multiflight: group closed")
+	// ErrDraining is returned by calls to a group being drained, see
+	// Drain.
+	ErrDraining = errors.New("multiflight: group draining")
+)
+
+// startWorkers starts the background workers the options of g ask for.
+func (g *Group[K, V]) startWorkers() {
+	var workers []func()
+	if d := g.opts.refreshAhead; d > 0 && g.cache != nil {
+		workers = append(workers, func() { g.refreshAhead(d) })
+	}
+	if d := g.opts.janitorInterval; d > 0 && g.cache != nil {
+		workers = append(workers, func() { g.janitor(d) })
+	}
+	if n := g.opts.workerPool; n > 0 {
+		for i := 0; i < n; i++ {
+			workers = append(workers, func() { g.pool.work() })
+		}
+	}
+	if len(workers) == 0 {
+		return
+	}
+
+	g.ctx, g.cancel = context.WithCancel(context.Background())
+	if g.opts.workerPool > 0 {
+		g.pool = &pool{jobs: make(chan func()), done: g.ctx.Done()}
+	}
+	for _, w := range workers {
+		g.workers.Add(1)
+		go func(w func()) {
+			defer g.workers.Done()
+			w()
+		}(w)
+	}
+}
+
+// Close shuts the group down: calls fail with ErrClosed from then on,
+// while the keys being loaded complete for the calls waiting on them.
+// Close waits for these loads, then stops the background workers of the
+// group and waits for them to return, until ctx is done, when it stops
+// the workers right away and returns ctx.Err(). The partitions of the
+// group, see WithContextKeyPartition, are closed along with it, and
+// closing a group more than once is safe.
+func (g *Group[K, V]) Close(ctx context.Context) error {
+	g.closeOnce.Do(func() {
+		if g.closing != nil {
+			close(g.closing)
+		}
+	})
+	g.withLock(func() {
+		g.closed = true
+	})
+	var err error
+	g.eachPartition(func(p *Group[K, V]) {
+		if perr := p.Close(ctx); perr != nil {
+			err = perr
+		}
+	})
+	if derr := g.awaitIdle(ctx); derr != nil {
+		err = derr
+	}
+	if g.cancel != nil {
+		g.cancel()
+	}
+	if err != nil {
+		return err
+	}
+
+	done := make(chan struct{})
+	go func() {
+		g.workers.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Drain stops the group from accepting calls, which fail with
+// ErrDraining from then on, and waits for the keys being loaded to
+// complete for the calls waiting on them, or for ctx to be done. Unlike
+// Close, it leaves the background workers running, and the group can
+// still be closed afterwards. The partitions of the group are drained
+// along with it.
+func (g *Group[K, V]) Drain(ctx context.Context) error {
+	g.withLock(func() {
+		g.draining = true
+	})
+	var err error
+	g.eachPartition(func(p *Group[K, V]) {
+		if perr := p.Drain(ctx); perr != nil {
+			err = perr
+		}
+	})
+	if derr := g.awaitIdle(ctx); derr != nil {
+		err = derr
+	}
+	return err
+}
+
+// rejected returns the error calls fail with once the group, or the
+// group it is scoped to, is closed or draining, nil before. Must be
+// called with g.mu held.
+func (g *Group[K, V]) rejected() error {
+	switch {
+	case g.closed && g.closeErr != nil:
+		return g.closeErr
+	case g.closed:
+		return ErrClosed
+	case g.draining:
+		return ErrDraining
+	case g.parent != nil:
+		g.parent.mu.Lock()
+		defer g.parent.mu.Unlock()
+		return g.parent.rejected()
+	}
+	return nil
+}
+
+// awaitIdle waits until no key is being loaded or ctx is done.
+func (g *Group[K, V]) awaitIdle(ctx context.Context) error {
+	for {
+		var wait chan struct{}
+		g.withLock(func() {
+			for _, e := range g.m {
+				if !e.lingering() {
+					if g.capacity == nil {
+						g.capacity = make(chan struct{})
+					}
+					wait = g.capacity
+					return
+				}
+			}
+		})
+		if wait == nil {
+			return nil
+		}
+
+		select {
+		case <-wait:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
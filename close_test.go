@@ -0,0 +1,187 @@
+package multiflight
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// noLeak fails t if goroutines started since it was called outlive the
+// func it returns, like goleak.
+func noLeak(t *testing.T) func() {
+	before := goroutines()
+	return func() {
+		t.Helper()
+		var leaked []string
+		ok := assert.Eventually(t, func() bool {
+			leaked = leaked[:0]
+			for id, stack := range goroutines() {
+				if _, has := before[id]; !has && !strings.Contains(stack, "noLeak") {
+					leaked = append(leaked, stack)
+				}
+			}
+			return len(leaked) == 0
+		}, time.Second, time.Millisecond)
+		if !ok {
+			t.Logf("leaked goroutines:\n%s", strings.Join(leaked, "\n\n"))
+		}
+	}
+}
+
+// goroutines returns the stacks of the goroutines by ID.
+func goroutines() map[string]string {
+	buf := make([]byte, 1<<20)
+	stacks := make(map[string]string)
+	for _, stack := range strings.Split(string(buf[:runtime.Stack(buf, true)]), "\n\n") {
+		id, _, _ := strings.Cut(strings.TrimPrefix(stack, "goroutine "), " ")
+		stacks[id] = stack
+	}
+	return stacks
+}
+
+func TestCloseDrains(t *testing.T) {
+	defer noLeak(t)()
+	release := make(chan struct{})
+	loader := func(ctx context.Context, keys []int) (map[int]string, error) {
+		<-release
+		vals := make(map[int]string, len(keys))
+		for _, k := range keys {
+			vals[k] = fmt.Sprint(k)
+		}
+		return vals, nil
+	}
+
+	ast := assert.New(t)
+	g := NewGroup(
+		WithTTL[int, string](time.Minute),
+		WithBatchWindow[int, string](time.Millisecond),
+		WithWorkerPool[int, string](2),
+		WithJanitorInterval[int, string](time.Millisecond),
+		WithRefreshAhead[int, string](time.Millisecond),
+	)
+	results := make(chan map[int]string, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			vals, err := g.Do(context.Background(), []int{1, 2}, loader)
+			ast.Nil(err)
+			results <- vals
+		}()
+	}
+	chans := g.DoChanPerKey(context.Background(), []int{3}, loader)
+	ast.Eventually(func() bool { return g.Stats().Waiters == 5 }, time.Second, time.Millisecond)
+
+	closed := make(chan error, 1)
+	go func() { closed <- g.Close(context.Background()) }()
+	ast.Eventually(func() bool {
+		_, err := g.Do(context.Background(), []int{4}, loader)
+		return err == ErrClosed
+	}, time.Second, time.Millisecond)
+	select {
+	case <-closed:
+		t.Fatal("Close returned with loads in flight")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	// the loads in flight complete for their callers
+	close(release)
+	ast.Nil(<-closed)
+	ast.Equal(map[int]string{1: "1", 2: "2"}, <-results)
+	ast.Equal(map[int]string{1: "1", 2: "2"}, <-results)
+	ast.Equal(Result[string]{Val: "3"}, <-chans[3])
+	ast.Nil(g.Close(context.Background()))
+	_, err := g.DoRaw(context.Background(), []int{1}, loader)
+	ast.ErrorIs(err, ErrClosed)
+}
+
+func TestCloseTimeout(t *testing.T) {
+	hung := make(chan struct{})
+	defer noLeak(t)()
+	defer close(hung)
+	loader := func(ctx context.Context, keys []int) (map[int]string, error) {
+		<-hung
+		return nil, nil
+	}
+
+	ast := assert.New(t)
+	g := NewGroup(
+		WithTTL[int, string](time.Minute),
+		WithJanitorInterval[int, string](time.Millisecond),
+		WithContextKeyPartition[int, string](tenantOf),
+	)
+	ctx := context.WithValue(context.Background(), tenantKey{}, "a")
+	chans := g.DoChanPerKey(ctx, []int{1}, loader)
+	ast.Eventually(func() bool { return g.Len() == 0 && g.Partition("a").Len() == 1 }, time.Second, time.Millisecond)
+
+	// the workers are stopped all the same
+	timeout, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	ast.ErrorIs(g.Close(timeout), context.DeadlineExceeded)
+	_, err := g.Do(ctx, []int{2}, loader)
+	ast.ErrorIs(err, ErrClosed)
+	ast.Eventually(func() bool {
+		select {
+		case <-g.ctx.Done():
+			return true
+		default:
+			return false
+		}
+	}, time.Second, time.Millisecond)
+	go func() { <-chans[1] }()
+}
+
+func TestDrain(t *testing.T) {
+	release := make(chan struct{})
+	loader := func(ctx context.Context, keys []int) (map[int]string, error) {
+		<-release
+		vals := make(map[int]string, len(keys))
+		for _, k := range keys {
+			vals[k] = fmt.Sprint(k)
+		}
+		return vals, nil
+	}
+
+	ast := assert.New(t)
+	g := NewGroup(WithTTL[int, string](time.Minute), WithMaxBatchSize[int, string](1))
+	results := make(chan map[int]string, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			vals, err := g.Do(context.Background(), []int{1, 2}, loader)
+			ast.Nil(err)
+			results <- vals
+		}()
+	}
+	ast.Eventually(func() bool { return g.Stats().Waiters == 4 }, time.Second, time.Millisecond)
+
+	// a drain giving up leaves the loads alone
+	timeout, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	ast.ErrorIs(g.Drain(timeout), context.DeadlineExceeded)
+	ast.Equal(2, g.Len())
+
+	drained := make(chan error, 1)
+	go func() { drained <- g.Drain(context.Background()) }()
+	_, err := g.Do(context.Background(), []int{1}, loader)
+	ast.ErrorIs(err, ErrDraining)
+	_, err = g.Do(context.Background(), []int{3}, loader)
+	ast.ErrorIs(err, ErrDraining)
+	select {
+	case <-drained:
+		t.Fatal("Drain returned with loads in flight")
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	close(release)
+	ast.Nil(<-drained)
+	ast.Equal(map[int]string{1: "1", 2: "2"}, <-results)
+	ast.Equal(map[int]string{1: "1", 2: "2"}, <-results)
+	_, err = g.Do(context.Background(), []int{1}, loader)
+	ast.ErrorIs(err, ErrDraining)
+	ast.Nil(g.Close(context.Background()))
+	_, err = g.Do(context.Background(), []int{1}, loader)
+	ast.ErrorIs(err, ErrClosed)
+}
@@ -0,0 +1,77 @@
+package multiflight
+
+import "context"
+
+// closedError is the error of calls to a group closed by its context,
+// see NewGroupWithContext. It is ErrClosed and wraps the cause of the
+// context.
+type closedError struct {
+	cause error
+}
+
+func (e *closedError) Error() string {
+	return ErrClosed.Error() + ": " + e.cause.Error()
+}
+
+func (e *closedError) Is(target error) bool {
+	return target == ErrClosed
+}
+
+func (e *closedError) Unwrap() error {
+	return e.cause
+}
+
+// NewGroupWithContext is NewGroup for a group living as long as ctx,
+// e.g. one per job. Once ctx is done, the group shuts down: calls fail
+// with an error that is ErrClosed and wraps the cause of ctx, and so do
+// the calls waiting for keys being loaded, the loads of the batch window
+// included, right away unless they run the load themselves. The loader
+// calls go on and their results are dropped, while the background
+// workers of the group stop. Close still stops the group early.
+func NewGroupWithContext[K comparable, V any](ctx context.Context, opts ...Option[K, V]) *Group[K, V] {
+	g := NewGroup(opts...)
+	g.closing = make(chan struct{})
+	g.workers.Add(1)
+	go func() {
+		defer g.workers.Done()
+		select {
+		case <-ctx.Done():
+			g.shutdown(&closedError{cause: cause(ctx)})
+		case <-g.closing:
+		}
+	}()
+	return g
+}
+
+// shutdown closes g right away, failing the calls waiting for keys being
+// loaded with err, and stops its background workers without waiting.
+func (g *Group[K, V]) shutdown(err error) {
+	g.withLock(func() {
+		g.closed, g.closeErr = true, err
+		if g.window != nil {
+			g.window.Stop()
+			g.window = nil
+		}
+		g.queue = nil
+
+		ents := make([]*ent[K, V], 0, len(g.m))
+		for key, e := range g.m {
+			if e.lingering() {
+				continue
+			}
+			e.err = err
+			e.completed = true
+			e.skipCache = true
+			delete(g.m, key)
+			ents = append(ents, e)
+		}
+		finish(ents)
+		g.releaseCapacity()
+	})
+	g.eachPartition(func(p *Group[K, V]) {
+		p.shutdown(err)
+	})
+	if g.cancel != nil {
+		g.cancel()
+	}
+}
@@ -0,0 +1,96 @@
+//go:build go1.20
+
+package multiflight
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewGroupWithContext(t *testing.T) {
+	errJobDone := errors.New("job done")
+	hung := make(chan struct{})
+	defer noLeak(t)()
+	defer close(hung)
+	loader := func(ctx context.Context, keys []int) (map[int]string, error) {
+		<-hung
+		return nil, nil
+	}
+
+	ast := assert.New(t)
+	ctx, cancel := context.WithCancelCause(context.Background())
+	g := NewGroupWithContext(ctx,
+		WithTTL[int, string](time.Minute),
+		WithJanitorInterval[int, string](time.Millisecond),
+	)
+	go g.Do(context.Background(), []int{1, 2}, loader)
+	ast.Eventually(func() bool { return g.Len() == 2 }, time.Second, time.Millisecond)
+	errs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			_, err := g.Do(context.Background(), []int{1, 2}, loader)
+			errs <- err
+		}()
+	}
+	ast.Eventually(func() bool { return g.Stats().Waiters == 6 }, time.Second, time.Millisecond)
+
+	// cancelling the context unblocks the waiters of the hung load
+	cancel(errJobDone)
+	for i := 0; i < 2; i++ {
+		err := <-errs
+		ast.ErrorIs(err, ErrClosed)
+		ast.ErrorIs(err, errJobDone)
+	}
+	_, err := g.Do(context.Background(), []int{3}, loader)
+	ast.ErrorIs(err, ErrClosed)
+	ast.ErrorIs(err, errJobDone)
+	ast.Equal("multiflight: group closed: job done", err.Error())
+	ast.Eventually(func() bool {
+		select {
+		case <-g.ctx.Done():
+			return true
+		default:
+			return false
+		}
+	}, time.Second, time.Millisecond)
+	ast.Nil(g.Close(context.Background()))
+	ast.Zero(g.Len())
+}
+
+func TestNewGroupWithContextWindow(t *testing.T) {
+	defer noLeak(t)()
+	loader := func(ctx context.Context, keys []int) (map[int]string, error) {
+		t.Error("the batch window was flushed")
+		return nil, nil
+	}
+
+	ast := assert.New(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	g := NewGroupWithContext(ctx, WithBatchWindow[int, string](time.Minute))
+	errs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func(key int) {
+			_, err := g.Do(context.Background(), []int{key}, loader)
+			errs <- err
+		}(i)
+	}
+	ast.Eventually(func() bool { return g.Len() == 2 }, time.Second, time.Millisecond)
+
+	// the window is aborted
+	cancel()
+	ast.ErrorIs(<-errs, context.Canceled)
+	ast.ErrorIs(<-errs, ErrClosed)
+}
+
+func TestNewGroupWithContextClose(t *testing.T) {
+	defer noLeak(t)()
+	ast := assert.New(t)
+	g := NewGroupWithContext(context.Background(), WithJanitorInterval[int, string](time.Millisecond))
+	ast.Nil(g.Close(context.Background()))
+	_, err := g.Do(context.Background(), []int{1}, nil)
+	ast.Equal(ErrClosed, err)
+}
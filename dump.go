@@ -0,0 +1,66 @@
+package multiflight
+
+import (
+	"sort"
+	"sync/atomic"
+	"time"
+)
+
+// defaultDumpLimit is the most entries DebugDump returns without
+// WithDebugDumpLimit.
+const defaultDumpLimit = 1000
+
+// WithDebugDumpLimit caps the entries DebugDump returns to n.
+func WithDebugDumpLimit[K comparable, V any](n int) Option[K, V] {
+	return func(o *options[K, V]) {
+		o.dumpLimit = n
+	}
+}
+
+// EntryInfo describes a key being loaded, see DebugDump.
+type EntryInfo[K comparable] struct {
+	Key K
+	// Age is how long the key has been in flight.
+	Age time.Duration
+	// Waiters is the number of callers waiting on the key.
+	Waiters int
+	// Dispatched reports whether a loader call was made for the key,
+	// which may still wait for its batch window or a worker otherwise.
+	Dispatched bool
+}
+
+// DebugDump returns the keys being loaded, the oldest first, e.g. to log
+// them when the group seems stuck. It holds the group lock only to copy
+// the entries, and returns at most the number of WithDebugDumpLimit,
+// 1000 by default.
+func (g *Group[K, V]) DebugDump() []EntryInfo[K] {
+	var ents []*ent[K, V]
+	g.withLock(func() {
+		ents = make([]*ent[K, V], 0, len(g.m))
+		for _, e := range g.m {
+			if !e.lingering() {
+				ents = append(ents, e)
+			}
+		}
+	})
+
+	sort.Slice(ents, func(i, j int) bool { return ents[i].started.Before(ents[j].started) })
+	limit := g.opts.dumpLimit
+	if limit <= 0 {
+		limit = defaultDumpLimit
+	}
+	if len(ents) > limit {
+		ents = ents[:limit]
+	}
+	now := time.Now()
+	infos := make([]EntryInfo[K], 0, len(ents))
+	for _, e := range ents {
+		infos = append(infos, EntryInfo[K]{
+			Key:        e.key,
+			Age:        now.Sub(e.started),
+			Waiters:    int(atomic.LoadInt32(&e.waiters)),
+			Dispatched: atomic.LoadUint64(&e.batch) != 0,
+		})
+	}
+	return infos
+}
@@ -0,0 +1,64 @@
+package multiflight
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDebugDump(t *testing.T) {
+	release := make(chan struct{})
+	loader := func(ctx context.Context, keys []int) (map[int]string, error) {
+		<-release
+		return nil, nil
+	}
+
+	ast := assert.New(t)
+	g := NewGroup(
+		WithBatchWindow[int, string](50*time.Millisecond),
+		WithDebugDumpLimit[int, string](3),
+	)
+	ast.Empty(g.DebugDump())
+
+	done := make(chan struct{}, 4)
+	call := func(keys ...int) {
+		go func() {
+			g.Do(context.Background(), keys, loader)
+			done <- struct{}{}
+		}()
+	}
+	call(1)
+	ast.Eventually(func() bool { return g.Len() == 1 }, time.Second, time.Millisecond)
+	time.Sleep(time.Millisecond)
+	call(1, 2)
+	ast.Eventually(func() bool { return g.Stats().Waiters == 3 }, time.Second, time.Millisecond)
+
+	// waiting for the window
+	dump := g.DebugDump()
+	ast.Len(dump, 2)
+	ast.Equal(EntryInfo[int]{Key: 1, Age: dump[0].Age, Waiters: 2}, dump[0])
+	ast.Equal(EntryInfo[int]{Key: 2, Age: dump[1].Age, Waiters: 1}, dump[1])
+	ast.GreaterOrEqual(dump[0].Age, dump[1].Age)
+
+	// loading, the later keys last and the newest left out
+	ast.Eventually(func() bool { return g.DebugDump()[0].Dispatched }, time.Second, time.Millisecond)
+	time.Sleep(time.Millisecond)
+	call(3)
+	ast.Eventually(func() bool { return g.Len() == 3 }, time.Second, time.Millisecond)
+	time.Sleep(time.Millisecond)
+	call(4)
+	ast.Eventually(func() bool { return g.Len() == 4 }, time.Second, time.Millisecond)
+	dump = g.DebugDump()
+	ast.Len(dump, 3)
+	ast.True(dump[0].Dispatched && dump[1].Dispatched)
+	ast.Equal(EntryInfo[int]{Key: 3, Age: dump[2].Age, Waiters: 1}, dump[2])
+	ast.Greater(dump[1].Age, dump[2].Age)
+
+	close(release)
+	for i := 0; i < 4; i++ {
+		<-done
+	}
+	ast.Empty(g.DebugDump())
+}
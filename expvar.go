@@ -0,0 +1,39 @@
+package multiflight
+
+import (
+	"expvar"
+	"sync"
+	"sync/atomic"
+)
+
+var (
+	publishMu sync.Mutex
+	// published holds the stats of the group last published under each
+	// name, as expvar can't unpublish a name to publish it again.
+	published = map[string]*atomic.Value{}
+)
+
+// Var returns an expvar.Var whose value is the JSON of the live Stats
+// of the group.
+func (g *Group[K, V]) Var() expvar.Var {
+	return expvar.Func(func() any { return g.Stats() })
+}
+
+// PublishExpvar publishes the Stats of the group in expvar under name,
+// e.g. to be served on /debug/vars. Publishing a name again, e.g. with a
+// new group, replaces the group published under it. Like expvar.Publish,
+// it panics if name was published by other means.
+func (g *Group[K, V]) PublishExpvar(name string) {
+	publishMu.Lock()
+	defer publishMu.Unlock()
+
+	stats, has := published[name]
+	if !has {
+		stats = new(atomic.Value)
+		expvar.Publish(name, expvar.Func(func() any {
+			return stats.Load().(func() any)()
+		}))
+		published[name] = stats
+	}
+	stats.Store(func() any { return g.Stats() })
+}
@@ -0,0 +1,42 @@
+package multiflight
+
+import (
+	"context"
+	"encoding/json"
+	"expvar"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPublishExpvar(t *testing.T) {
+	loader := func(ctx context.Context, keys []int) (map[int]string, error) {
+		return map[int]string{keys[0]: "v"}, nil
+	}
+	stats := func(name string) Stats {
+		var s Stats
+		assert.NoError(t, json.Unmarshal([]byte(expvar.Get(name).String()), &s))
+		return s
+	}
+
+	ast := assert.New(t)
+	g1 := NewGroup[int, string]()
+	g1.PublishExpvar("multiflight.test.a")
+	g2 := NewGroup[int, string]()
+	g2.PublishExpvar("multiflight.test.b")
+
+	// the published stats are live
+	g1.Do(context.Background(), []int{1}, loader)
+	ast.Equal(uint64(1), stats("multiflight.test.a").Calls)
+	ast.Equal(uint64(0), stats("multiflight.test.b").Calls)
+	ast.Equal(g1.Stats(), stats("multiflight.test.a"))
+
+	// publishing a name again replaces its group
+	g3 := NewGroup[int, string]()
+	ast.NotPanics(func() { g3.PublishExpvar("multiflight.test.a") })
+	ast.Equal(uint64(0), stats("multiflight.test.a").Calls)
+	g1.Do(context.Background(), []int{2}, loader)
+	ast.Equal(uint64(0), stats("multiflight.test.a").Calls)
+
+	ast.Equal(expvar.Get("multiflight.test.b").String(), g2.Var().String())
+}
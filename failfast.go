@@ -0,0 +1,132 @@
+package multiflight
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+)
+
+// WithFailFast fails a call as soon as one of its keys fails, not found
+// aside, without waiting for the others. The loader calls the call
+// started are canceled along with it, unless other callers wait on any
+// of their keys: loads shared with them go on for them. It applies to
+// the calls returning all their keys at once, e.g. Do and DoRaw, not to
+// DoSeq or DoChanPerKey.
+func WithFailFast() CallOption {
+	return func(co *callOptions) {
+		co.failFast = true
+	}
+}
+
+// abort is the loader call of ents, which a fail-fast call can cancel.
+type abort[K comparable, V any] struct {
+	cancel context.CancelFunc
+	ents   []*ent[K, V]
+}
+
+// abortable returns the context of the loader call of ents, which the
+// fail-fast calls owning all of them can cancel, already canceled if
+// they did before the call started, or ctx itself if none of them was
+// registered by a fail-fast call.
+func (g *Group[K, V]) abortable(ctx context.Context, ents []*ent[K, V]) (context.Context, context.CancelFunc) {
+	failFast := false
+	for _, e := range ents {
+		failFast = failFast || e.failFast
+	}
+	if !failFast {
+		return ctx, func() {}
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	a := &abort[K, V]{cancel: cancel, ents: ents}
+	aborted := false
+	g.withLock(func() {
+		for _, e := range ents {
+			if !e.completed {
+				e.abort = a
+			}
+		}
+		aborted = a.aborted()
+	})
+	if aborted {
+		cancel()
+	}
+	return ctx, cancel
+}
+
+// aborted reports whether the entries of a still pending are all
+// aborted. Must be called with g.mu held.
+func (a *abort[K, V]) aborted() bool {
+	for _, e := range a.ents {
+		if !e.completed && !e.aborted {
+			return false
+		}
+	}
+	return true
+}
+
+// firstFailure returns a channel receiving the first entry of c to
+// fail, which the entries signal when they complete.
+func (g *Group[K, V]) firstFailure(c *call[K, V]) <-chan *ent[K, V] {
+	failed := make(chan *ent[K, V], 1)
+	g.withLock(func() {
+		for _, e := range c.ents {
+			if !e.completed {
+				e.failed = append(e.failed, failed)
+			} else if e.fails() {
+				signal(failed, e)
+			}
+		}
+	})
+	return failed
+}
+
+// fails reports whether e failed, not found aside. Must be called with
+// g.mu held or once e is done.
+func (e *ent[K, V]) fails() bool {
+	return e.err != nil && !errors.Is(e.err, errResultNotFound)
+}
+
+// signal sends e on ch unless ch already holds an entry.
+func signal[K comparable, V any](ch chan<- *ent[K, V], e *ent[K, V]) {
+	select {
+	case ch <- e:
+	default:
+	}
+}
+
+// abortOwn aborts the pending entries in own no other caller waits on
+// and cancels the loader calls left with only aborted entries. The
+// entries are unregistered, so that callers coming later start loads of
+// their own, and their results aren't cached.
+func (g *Group[K, V]) abortOwn(own map[*ent[K, V]]struct{}) {
+	var cancels []context.CancelFunc
+	g.withLock(func() {
+		for e := range own {
+			if e.completed || atomic.LoadInt32(&e.waiters) > 1 {
+				continue
+			}
+			e.aborted = true
+			e.skipCache = true
+			g.remove(e)
+		}
+		seen := make(map[*abort[K, V]]struct{})
+		for e := range own {
+			a := e.abort
+			if a == nil || !e.aborted {
+				continue
+			}
+			if _, has := seen[a]; has {
+				continue
+			}
+			seen[a] = struct{}{}
+			if a.aborted() {
+				cancels = append(cancels, a.cancel)
+			}
+		}
+		g.releaseCapacity()
+	})
+	for _, cancel := range cancels {
+		cancel()
+	}
+}
@@ -0,0 +1,91 @@
+package multiflight
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFailFast(t *testing.T) {
+	errBoom := errors.New("boom")
+	release := make(chan struct{})
+	var canceled int32
+	loader := func(ctx context.Context, keys []int) (map[int]string, error) {
+		if keys[0] == 1 {
+			return nil, errBoom
+		}
+		select {
+		case <-release:
+			return map[int]string{keys[0]: fmt.Sprint(keys[0])}, nil
+		case <-ctx.Done():
+			atomic.AddInt32(&canceled, 1)
+			return nil, ctx.Err()
+		}
+	}
+
+	ast := assert.New(t)
+	g := NewGroup(
+		WithTTL[int, string](time.Minute),
+		WithErrorTTL[int, string](time.Minute, nil),
+		WithMaxBatchSize[int, string](1),
+	)
+
+	// another caller waits on key 3
+	shared := make(chan error, 1)
+	go func() {
+		_, err := g.Do(context.Background(), []int{3}, loader)
+		shared <- err
+	}()
+	ast.Eventually(func() bool { return g.Len() == 1 }, time.Second, time.Millisecond)
+
+	start := time.Now()
+	_, err := g.Do(context.Background(), []int{2, 3, 4, 1, 5}, loader, WithFailFast())
+	ast.ErrorIs(err, errBoom)
+	ast.Less(time.Since(start), 500*time.Millisecond)
+
+	// the loads of keys 2, 4 and 5 are canceled, not the shared one
+	ast.Eventually(func() bool { return atomic.LoadInt32(&canceled) == 3 }, time.Second, time.Millisecond)
+	ast.Equal(1, g.Len())
+	close(release)
+	ast.Nil(<-shared)
+	ast.Equal(int32(3), atomic.LoadInt32(&canceled))
+
+	// the canceled keys are neither cached nor joined
+	vals, err := g.Do(context.Background(), []int{2, 3, 4, 5}, loader)
+	ast.Nil(err)
+	ast.Equal(map[int]string{2: "2", 3: "3", 4: "4", 5: "5"}, vals)
+}
+
+func TestFailFastPerCall(t *testing.T) {
+	errBoom := errors.New("boom")
+	release := make(chan struct{})
+	loader := func(ctx context.Context, keys []int) (map[int]string, error) {
+		if keys[0] == 1 {
+			return nil, errBoom
+		}
+		<-release
+		return map[int]string{keys[0]: fmt.Sprint(keys[0])}, nil
+	}
+
+	ast := assert.New(t)
+	g := NewGroup(WithMaxBatchSize[int, string](1))
+
+	// calls without WithFailFast wait for all their keys
+	errs := make(chan error, 1)
+	go func() {
+		_, err := g.Do(context.Background(), []int{2, 1}, loader)
+		errs <- err
+	}()
+	select {
+	case <-errs:
+		t.Fatal("the call failed fast")
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(release)
+	ast.ErrorIs(<-errs, errBoom)
+}
@@ -0,0 +1,63 @@
+package multiflight
+
+import (
+	"context"
+)
+
+// WithFallbackLoader loads the keys a loader call didn't return from
+// fallback before they are reported missing, e.g. to read an
+// authoritative but slower store behind a fast one. Only keys missing
+// from both are left out of the results, and keys fallback fails for
+// get its error. Values from fallback are cached with the group TTL.
+func WithFallbackLoader[K comparable, V any](fallback Loader[K, V]) Option[K, V] {
+	return func(o *options[K, V]) {
+		o.fallback = fallback
+	}
+}
+
+// loadFallback loads the keys of ents missing from vals with the
+// fallback loader, as a loader call of its own, returning all the values
+// and the errors of the keys it failed to load.
+func (g *Group[K, V]) loadFallback(ctx context.Context, attempt, chunk int, ents []*ent[K, V], vals map[K]V) (map[K]V, map[K]error) {
+	var (
+		missing []K
+		lacking []*ent[K, V]
+	)
+	for _, e := range ents {
+		if _, has := vals[e.key]; !has {
+			missing = append(missing, e.key)
+			lacking = append(lacking, e)
+		}
+	}
+	if len(missing) == 0 {
+		return vals, nil
+	}
+
+	var (
+		found map[K]V
+		err   = ErrCircuitOpen
+	)
+	if b := g.opts.breaker; b == nil || b.Allow() {
+		_, found, _, _, err = g.callObserved(ctx, attempt, chunk, lacking, missing, g.opts.fallback.batch())
+	}
+	// vals belongs to the loader, which may still read it
+	all := make(map[K]V, len(vals)+len(found))
+	for k, v := range vals {
+		all[k] = v
+	}
+	for k, v := range found {
+		all[k] = v
+	}
+	vals = all
+	if err == nil {
+		return vals, nil
+	}
+
+	failed := make(map[K]error, len(missing))
+	for _, key := range missing {
+		if _, has := found[key]; !has {
+			failed[key] = err
+		}
+	}
+	return vals, failed
+}
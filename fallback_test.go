@@ -0,0 +1,133 @@
+package multiflight
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFallbackLoader(t *testing.T) {
+	var fellBack int32
+	primary := func(ctx context.Context, keys []int) (map[int]string, error) {
+		resuts := make(map[int]string, len(keys))
+		for _, k := range keys {
+			if k%2 == 0 {
+				resuts[k] = fmt.Sprintf("primary: %d", k)
+			}
+		}
+		return resuts, nil
+	}
+	secondary := func(ctx context.Context, keys []int) (map[int]string, error) {
+		atomic.AddInt32(&fellBack, int32(len(keys)))
+		resuts := make(map[int]string, len(keys))
+		for _, k := range keys {
+			if k < 5 {
+				resuts[k] = fmt.Sprintf("secondary: %d", k)
+			}
+		}
+		return resuts, nil
+	}
+
+	ast := assert.New(t)
+	g := NewGroup(WithFallbackLoader[int, string](secondary))
+
+	// the secondary fills the keys the primary misses, 5 is in neither
+	results, err := g.Do(context.Background(), []int{1, 2, 3, 4, 5}, primary)
+	ast.Nil(err)
+	ast.Equal(map[int]string{
+		1: "secondary: 1",
+		2: "primary: 2",
+		3: "secondary: 3",
+		4: "primary: 4",
+	}, results)
+	ast.Equal(int32(3), atomic.LoadInt32(&fellBack))
+
+	// the secondary isn't called when the primary has every key
+	_, err = g.Do(context.Background(), []int{2, 4}, primary)
+	ast.Nil(err)
+	ast.Equal(int32(3), atomic.LoadInt32(&fellBack))
+}
+
+func TestFallbackLoaderError(t *testing.T) {
+	errBoom := errors.New("boom")
+	primary := func(ctx context.Context, keys []int) (map[int]string, error) {
+		return map[int]string{1: "primary: 1"}, nil
+	}
+	secondary := func(ctx context.Context, keys []int) (map[int]string, error) {
+		return nil, errBoom
+	}
+
+	ast := assert.New(t)
+	g := NewGroup(WithFallbackLoader[int, string](secondary))
+
+	results, err := g.Do(context.Background(), []int{1}, primary)
+	ast.Nil(err)
+	ast.Equal(map[int]string{1: "primary: 1"}, results)
+
+	_, err = g.Do(context.Background(), []int{1, 2}, primary)
+	ast.ErrorIs(err, errBoom)
+}
+
+func TestFallbackLoaderExtraKeys(t *testing.T) {
+	primaryVals := map[int]string{1: "primary: 1", 7: "primary: 7", 8: "primary: 8"}
+	primary := func(ctx context.Context, keys []int) (map[int]string, error) {
+		return primaryVals, nil
+	}
+	secondary := func(ctx context.Context, keys []int) (map[int]string, error) {
+		return map[int]string{2: "secondary: 2"}, nil
+	}
+
+	ast := assert.New(t)
+	g := NewGroup(
+		WithTTL[int, string](time.Minute),
+		WithAcceptExtraKeys[int, string](),
+		WithFallbackLoader[int, string](secondary),
+	)
+
+	// the primary returns more keys than it was asked for
+	results, err := g.Do(context.Background(), []int{1, 2}, primary)
+	ast.Nil(err)
+	ast.Equal(map[int]string{1: "primary: 1", 2: "secondary: 2"}, results)
+	ast.Equal(map[int]string{1: "primary: 1", 7: "primary: 7", 8: "primary: 8"}, primaryVals)
+	results, err = g.Do(context.Background(), []int{7}, func(ctx context.Context, keys []int) (map[int]string, error) {
+		t.Error("the extra key wasn't cached")
+		return nil, nil
+	})
+	ast.Nil(err)
+	ast.Equal(map[int]string{7: "primary: 7"}, results)
+}
+
+func TestFallbackLoaderTimeout(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	primary := func(ctx context.Context, keys []int) (map[int]string, error) {
+		return map[int]string{1: "primary: 1"}, nil
+	}
+	secondary := func(ctx context.Context, keys []int) (map[int]string, error) {
+		<-release
+		return nil, nil
+	}
+
+	ast := assert.New(t)
+	var started [][]int
+	g := NewGroup(
+		WithFallbackLoader[int, string](secondary),
+		WithLoadTimeout[int, string](10*time.Millisecond),
+		WithHooks(Hooks[int, string]{
+			OnLoadStart: func(batch uint64, keys []int) {
+				started = append(started, keys)
+			},
+		}),
+	)
+
+	// the fallback is a loader call like any other
+	_, err := g.Do(context.Background(), []int{1, 2}, primary)
+	ast.ErrorIs(err, ErrLoadTimeout)
+	ast.Equal([][]int{{1, 2}, {2}}, started)
+	ast.Equal(uint64(2), g.Stats().Loads)
+}
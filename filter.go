@@ -0,0 +1,33 @@
+package multiflight
+
+// WithKeyFilter drops the keys keep returns false for from every call
+// before anything else, e.g. keys behind a feature flag: they are never
+// loaded, cached or shared, and are left out of results like keys not
+// found, so callers can't tell filtered keys from missing ones.
+func WithKeyFilter[K comparable, V any](keep func(key K) bool) Option[K, V] {
+	return func(o *options[K, V]) {
+		o.keyFilter = keep
+	}
+}
+
+// filter returns the keys WithKeyFilter keeps, keys itself if it keeps
+// all of them.
+func (g *Group[K, V]) filter(keys []K) []K {
+	keep := g.opts.keyFilter
+	if keep == nil {
+		return keys
+	}
+	for i, key := range keys {
+		if keep(key) {
+			continue
+		}
+		kept := append(make([]K, 0, len(keys)-1), keys[:i]...)
+		for _, key := range keys[i+1:] {
+			if keep(key) {
+				kept = append(kept, key)
+			}
+		}
+		return kept
+	}
+	return keys
+}
@@ -0,0 +1,43 @@
+package multiflight
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeyFilter(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		loaded []int
+	)
+	loader := func(ctx context.Context, keys []int) (map[int]string, error) {
+		mu.Lock()
+		loaded = append(loaded, keys...)
+		mu.Unlock()
+		vals := make(map[int]string, len(keys))
+		for _, k := range keys {
+			vals[k] = fmt.Sprint(k)
+		}
+		return vals, nil
+	}
+
+	ast := assert.New(t)
+	g := NewGroup(WithKeyFilter[int, string](func(key int) bool { return key%2 == 0 }))
+	keys := []int{1, 2, 3, 4, 5, 6}
+	results, err := g.Do(context.Background(), keys, loader)
+	ast.Nil(err)
+	ast.Equal(map[int]string{2: "2", 4: "4", 6: "6"}, results)
+	ast.Equal([]int{2, 4, 6}, loaded)
+	ast.Equal([]int{1, 2, 3, 4, 5, 6}, keys) // the keys of the caller are left alone
+	ast.Equal(uint64(3), g.Stats().Keys)
+
+	// calls of filtered keys only don't load
+	results, err = g.Do(context.Background(), []int{7, 9}, loader)
+	ast.Nil(err)
+	ast.Empty(results)
+	ast.Equal([]int{2, 4, 6}, loaded)
+}
@@ -0,0 +1,63 @@
+package multiflight
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// WithHedging sends up to maxHedges duplicate loader calls for a batch
+// that hasn't completed delay after the previous call. The keys are
+// completed from the first call to succeed, or from the last one to fail
+// when all of them fail, and the others are cancelled through their
+// context and have their results dropped.
+func WithHedging[K comparable, V any](delay time.Duration, maxHedges int) Option[K, V] {
+	return func(o *options[K, V]) {
+		o.hedgeDelay = delay
+		o.maxHedges = maxHedges
+	}
+}
+
+// loadResult is the outcome of one loader call.
+type loadResult[K comparable, V any] struct {
+	vals map[K]V
+	ttls map[K]lifetime
+	err  error
+}
+
+// hedgedLoad calls load for keys, hedging it when it is slow, and
+// returns the result of the first call to succeed. A failed call only
+// wins when no other call is running.
+func (g *Group[K, V]) hedgedLoad(ctx context.Context, keys []K, load loadFunc[K, V]) (map[K]V, map[K]lifetime, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel() // stop the calls that lost
+
+	// buffered for every call so the losers never block
+	results := make(chan loadResult[K, V], g.opts.maxHedges+1)
+	run := func() {
+		atomic.AddUint64(&g.stats.loads, 1)
+		vals, ttls, err := load(ctx, keys)
+		results <- loadResult[K, V]{vals: vals, ttls: ttls, err: err}
+	}
+
+	go run()
+	t := time.NewTimer(g.opts.hedgeDelay)
+	defer t.Stop()
+	for hedges, running := 0, 1; ; {
+		select {
+		case r := <-results:
+			running--
+			if r.err == nil || running == 0 {
+				return r.vals, r.ttls, r.err
+			}
+		case <-t.C:
+			if hedges < g.opts.maxHedges {
+				hedges++
+				running++
+				atomic.AddUint64(&g.stats.hedges, 1)
+				go run()
+				t.Reset(g.opts.hedgeDelay)
+			}
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package multiflight
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHedging(t *testing.T) {
+	var calls, cancelled int32
+	loader := func(ctx context.Context, keys []int) (map[int]string, error) {
+		n := atomic.AddInt32(&calls, 1)
+		if n == 1 {
+			// the slow replica
+			<-ctx.Done()
+			atomic.AddInt32(&cancelled, 1)
+			return nil, ctx.Err()
+		}
+		resuts := make(map[int]string, len(keys))
+		for _, k := range keys {
+			resuts[k] = fmt.Sprintf("val: %d", k)
+		}
+		return resuts, nil
+	}
+
+	ast := assert.New(t)
+	g := NewGroup(WithHedging[int, string](time.Millisecond*10, 2))
+	results, err := g.Do(context.Background(), []int{1, 2}, loader)
+	ast.Nil(err)
+	ast.Equal(map[int]string{1: "val: 1", 2: "val: 2"}, results)
+	ast.Eventually(func() bool { return atomic.LoadInt32(&cancelled) == 1 }, time.Second, time.Millisecond)
+
+	stats := g.Stats()
+	ast.Equal(uint64(1), stats.Hedges)
+	ast.Equal(uint64(2), stats.Loads)
+
+	// fast loads are never hedged
+	results, err = g.Do(context.Background(), []int{3}, loader)
+	ast.Nil(err)
+	ast.Equal(map[int]string{3: "val: 3"}, results)
+	stats = g.Stats()
+	ast.Equal(uint64(1), stats.Hedges)
+	ast.Equal(uint64(3), stats.Loads)
+}
+
+func TestHedgingMaxHedges(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	loader := func(ctx context.Context, keys []int) (map[int]string, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		return map[int]string{1: "val: 1"}, nil
+	}
+
+	ast := assert.New(t)
+	g := NewGroup(WithHedging[int, string](time.Millisecond, 2))
+	go func() {
+		time.Sleep(time.Millisecond * 30)
+		close(release)
+	}()
+	results, err := g.Do(context.Background(), []int{1}, loader)
+	ast.Nil(err)
+	ast.Equal(map[int]string{1: "val: 1"}, results)
+	ast.Equal(int32(3), atomic.LoadInt32(&calls))
+	ast.Equal(uint64(2), g.Stats().Hedges)
+}
+
+func TestHedgingFirstSuccess(t *testing.T) {
+	var calls int32
+	failed := make(chan struct{})
+	loader := func(ctx context.Context, keys []int) (map[int]string, error) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			// the first replica fails once the hedge is running
+			time.Sleep(time.Millisecond * 20)
+			close(failed)
+			return nil, errors.New("replica down")
+		}
+		<-failed
+		return map[int]string{1: "val: 1"}, nil
+	}
+
+	ast := assert.New(t)
+	g := NewGroup(WithHedging[int, string](time.Millisecond, 1))
+	results, err := g.Do(context.Background(), []int{1}, loader)
+	ast.Nil(err)
+	ast.Equal(map[int]string{1: "val: 1"}, results)
+	ast.Equal(uint64(1), g.Stats().Hedges)
+
+	// the last call to fail wins when all of them fail
+	errBoom := errors.New("boom")
+	g = NewGroup(WithHedging[int, string](time.Millisecond, 1))
+	_, err = g.Do(context.Background(), []int{1}, func(ctx context.Context, keys []int) (map[int]string, error) {
+		time.Sleep(time.Millisecond * 10)
+		return nil, errBoom
+	})
+	ast.ErrorIs(err, errBoom)
+	ast.Equal(uint64(1), g.Stats().Hedges)
+}
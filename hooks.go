@@ -0,0 +1,174 @@
+package multiflight
+
+import (
+	"context"
+	"time"
+)
+
+// Hooks are called at the hook points of a group, see WithHooks. Any of
+// them may be nil. They are called without any lock of the group held,
+// from the goroutines of the calls and loads, so possibly concurrently.
+// For every call, OnHit or OnMiss is called with each of its keys, then
+// OnWaiterJoin with the keys it shares with loads in flight. For every
+// loader call, OnLoadStart and OnLoadEnd are called before and after it,
+// before its keys are completed.
+type Hooks[K comparable, V any] struct {
+	// OnHit is called with a key served from the caches.
+	OnHit func(key K)
+	// OnMiss is called with a key not served from the caches, whose
+	// call loads it or joins its load in flight.
+	OnMiss func(key K)
+	// OnLoadStart is called before a loader call of keys, with its ID,
+	// see BatchIDFromContext.
+	OnLoadStart func(batchID uint64, keys []K)
+	// OnLoadEnd is called once the loader call batchID of keys returns,
+	// with its error and how long it took.
+	OnLoadEnd func(batchID uint64, keys []K, err error, d time.Duration)
+	// OnWaiterJoin is called when a call joins the load in flight of
+	// key, with the number of calls then waiting for it.
+	OnWaiterJoin func(key K, waiters int)
+}
+
+// WithHooks calls h at the hook points of the group.
+func WithHooks[K comparable, V any](h Hooks[K, V]) Option[K, V] {
+	return func(o *options[K, V]) {
+		o.hooks = h
+	}
+}
+
+// joined is a load in flight a call joined.
+type joined[K comparable] struct {
+	key     K
+	waiters int
+}
+
+// callHooks calls the hooks of the keys of c, stored being the values
+// served from the external cache.
+func (g *Group[K, V]) callHooks(c *call[K, V], stored map[K]V) {
+	h := &g.opts.hooks
+	if h.OnHit != nil {
+		for key := range stored {
+			h.OnHit(key)
+		}
+		for _, key := range c.hitKeys {
+			h.OnHit(key)
+		}
+	}
+	if h.OnMiss != nil {
+		for _, e := range c.ents {
+			h.OnMiss(e.key)
+		}
+	}
+	if h.OnWaiterJoin != nil {
+		for _, j := range c.joined {
+			h.OnWaiterJoin(j.key, j.waiters)
+		}
+	}
+}
+
+// loadCall is a loader call the hooks of a group are notified of.
+type loadCall[K comparable, V any] struct {
+	ctx     context.Context // to call the loader with, as the hooks leave it
+	batch   uint64          // see BatchIDFromContext
+	attempt int
+	chunk   int // the index of the call in its batch
+	ents    []*ent[K, V]
+	keys    []K
+	end     func(err error) // ends the trace of the call, if traced
+}
+
+// loadHook is notified of the loader calls of a group. Hooks, the
+// observers, the tracer and the logger of the group all are loadHooks,
+// notified in this order when a call starts and in reverse order when
+// it ends.
+type loadHook[K comparable, V any] interface {
+	// started is called before the loader call l, and may change its
+	// context.
+	started(g *Group[K, V], l *loadCall[K, V])
+	// ended is called once the loader call l returned err after d,
+	// before its keys are completed.
+	ended(g *Group[K, V], l *loadCall[K, V], err error, d time.Duration)
+}
+
+// loadHooks returns the hooks of g notified of its loader calls.
+func (g *Group[K, V]) loadHooks() []loadHook[K, V] {
+	hooks := make([]loadHook[K, V], 0, 4)
+	if h := &g.opts.hooks; h.OnLoadStart != nil || h.OnLoadEnd != nil {
+		hooks = append(hooks, h)
+	}
+	if g.opts.observer != nil || g.observers.Load() != nil {
+		hooks = append(hooks, observerHook[K, V]{})
+	}
+	if t := g.opts.tracer; t != nil {
+		hooks = append(hooks, tracerHook[K, V]{t})
+	}
+	if l := g.opts.log; l != nil {
+		hooks = append(hooks, logHook[K, V]{l})
+	}
+	return hooks
+}
+
+// startLoad notifies hooks of the start of l.
+func (g *Group[K, V]) startLoad(hooks []loadHook[K, V], l *loadCall[K, V]) {
+	for _, h := range hooks {
+		h.started(g, l)
+	}
+}
+
+// endLoad notifies hooks of the end of l.
+func (g *Group[K, V]) endLoad(hooks []loadHook[K, V], l *loadCall[K, V], err error, d time.Duration) {
+	for i := len(hooks) - 1; i >= 0; i-- {
+		hooks[i].ended(g, l, err, d)
+	}
+}
+
+func (h *Hooks[K, V]) started(_ *Group[K, V], l *loadCall[K, V]) {
+	if h.OnLoadStart != nil {
+		h.OnLoadStart(l.batch, l.keys)
+	}
+}
+
+func (h *Hooks[K, V]) ended(_ *Group[K, V], l *loadCall[K, V], err error, d time.Duration) {
+	if h.OnLoadEnd != nil {
+		h.OnLoadEnd(l.batch, l.keys, err, d)
+	}
+}
+
+// observerHook notifies the observers of the group.
+type observerHook[K comparable, V any] struct{}
+
+func (observerHook[K, V]) started(g *Group[K, V], l *loadCall[K, V]) {
+	g.observe(func(o Observer) { o.OnBatch(len(l.keys)) })
+}
+
+func (observerHook[K, V]) ended(g *Group[K, V], l *loadCall[K, V], err error, d time.Duration) {
+	g.observe(func(o Observer) { o.OnLoad(len(l.keys), d, err) })
+}
+
+// tracerHook traces the loader calls with t.
+type tracerHook[K comparable, V any] struct {
+	t Tracer
+}
+
+func (h tracerHook[K, V]) started(g *Group[K, V], l *loadCall[K, V]) {
+	l.ctx, l.end = g.traceLoad(l.ctx, h.t, l.chunk, l.ents)
+}
+
+func (h tracerHook[K, V]) ended(_ *Group[K, V], l *loadCall[K, V], err error, _ time.Duration) {
+	l.end(err)
+}
+
+// logHook logs the loader calls to l.
+type logHook[K comparable, V any] struct {
+	l eventLog[K]
+}
+
+func (h logHook[K, V]) started(g *Group[K, V], l *loadCall[K, V]) {
+	h.l.dispatched(l.ctx, l.keys, g.trigger(l.ents, l.attempt))
+}
+
+func (h logHook[K, V]) ended(_ *Group[K, V], l *loadCall[K, V], err error, d time.Duration) {
+	if err != nil {
+		h.l.failed(l.ctx, l.keys, d, err)
+	}
+}
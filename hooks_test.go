@@ -0,0 +1,152 @@
+package multiflight
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// hookEvents records the hooks called, in order.
+type hookEvents struct {
+	mu     sync.Mutex
+	events []string
+}
+
+func (h *hookEvents) add(format string, args ...any) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.events = append(h.events, fmt.Sprintf(format, args...))
+}
+
+func (h *hookEvents) take() []string {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	events := h.events
+	h.events = nil
+	return events
+}
+
+func (h *hookEvents) hooks(g **Group[int, string]) Hooks[int, string] {
+	return Hooks[int, string]{
+		OnHit:       func(key int) { h.add("hit %d", key) },
+		OnMiss:      func(key int) { h.add("miss %d", key) },
+		OnLoadStart: func(id uint64, keys []int) { h.add("start %d %v", id, keys) },
+		OnLoadEnd: func(id uint64, keys []int, err error, d time.Duration) {
+			h.add("end %d %v %v in flight %d", id, keys, err, (*g).Len()) // the group isn't locked
+		},
+		OnWaiterJoin: func(key int, waiters int) { h.add("join %d %d", key, waiters) },
+	}
+}
+
+func TestHooks(t *testing.T) {
+	errBoom := errors.New("boom")
+	release := make(chan struct{})
+	loader := func(ctx context.Context, keys []int) (map[int]string, error) {
+		if keys[0] == 3 {
+			<-release
+			return nil, errBoom
+		}
+		return map[int]string{1: "val: 1"}, nil
+	}
+
+	ast := assert.New(t)
+	events := &hookEvents{}
+	var g *Group[int, string]
+	g = NewGroup(WithTTL[int, string](time.Minute), WithHooks(events.hooks(&g)))
+
+	_, err := g.Do(context.Background(), []int{1, 2}, loader)
+	ast.Nil(err)
+	ast.Equal([]string{"miss 1", "miss 2", "start 1 [1 2]", "end 1 [1 2] <nil> in flight 2"}, events.take())
+	g.MarkNotFound(2)
+	_, err = g.Do(context.Background(), []int{1, 2}, loader)
+	ast.Nil(err)
+	ast.Equal([]string{"hit 1", "hit 2"}, events.take())
+
+	// callers joining a load in flight
+	errs := make(chan error, 3)
+	go func() {
+		_, err := g.Do(context.Background(), []int{3}, loader)
+		errs <- err
+	}()
+	ast.Eventually(func() bool { return g.Len() == 1 }, time.Second, time.Millisecond)
+	for i := 0; i < 2; i++ {
+		go func() {
+			_, err := g.Do(context.Background(), []int{1, 3}, loader)
+			errs <- err
+		}()
+		ast.Eventually(func() bool { return g.Stats().Waiters == int64(i+2) }, time.Second, time.Millisecond)
+	}
+	close(release)
+	for i := 0; i < 3; i++ {
+		ast.ErrorIs(<-errs, errBoom)
+	}
+	ast.Equal([]string{
+		"miss 3", "start 2 [3]",
+		"hit 1", "miss 3", "join 3 2",
+		"hit 1", "miss 3", "join 3 3",
+		"end 2 [3] boom in flight 1",
+	}, events.take())
+
+	// nil hooks are skipped
+	g = NewGroup(WithHooks(Hooks[int, string]{OnMiss: func(key int) { events.add("miss %d", key) }}))
+	_, err = g.Do(context.Background(), []int{1}, loader)
+	ast.Nil(err)
+	ast.Equal([]string{"miss 1"}, events.take())
+}
+
+func TestHooksConcurrency(t *testing.T) {
+	loader := func(ctx context.Context, keys []int) (map[int]string, error) {
+		time.Sleep(time.Millisecond)
+		vals := make(map[int]string, len(keys))
+		for _, k := range keys {
+			vals[k] = fmt.Sprint(k)
+		}
+		return vals, nil
+	}
+
+	ast := assert.New(t)
+	var hits, misses, loaded, joins int64
+	starts := sync.Map{}
+	g := NewGroup(WithTTL[int, string](time.Minute), WithHooks(Hooks[int, string]{
+		OnHit:  func(key int) { atomic.AddInt64(&hits, 1) },
+		OnMiss: func(key int) { atomic.AddInt64(&misses, 1) },
+		OnLoadStart: func(id uint64, keys []int) {
+			_, started := starts.LoadOrStore(id, len(keys))
+			ast.False(started)
+		},
+		OnLoadEnd: func(id uint64, keys []int, err error, d time.Duration) {
+			n, started := starts.Load(id)
+			ast.True(started)
+			ast.Equal(len(keys), n)
+			atomic.AddInt64(&loaded, int64(len(keys)))
+		},
+		OnWaiterJoin: func(key int, waiters int) {
+			ast.GreaterOrEqual(waiters, 2)
+			atomic.AddInt64(&joins, 1)
+		},
+	}))
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			_, err := g.Do(context.Background(), []int{i % 10, i%10 + 1, i%10 + 2}, loader)
+			ast.Nil(err)
+		}(i)
+	}
+	wg.Wait()
+
+	s := g.Stats()
+	ast.Equal(int64(150), hits+misses)
+	ast.Equal(int64(s.CacheHits), hits)
+	ast.Equal(int64(s.SharedKeys), joins)
+	ast.Equal(int64(s.LoadedKeys), loaded)
+	ast.Equal(misses, loaded+joins)
+}
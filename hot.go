@@ -0,0 +1,144 @@
+package multiflight
+
+import (
+	"sort"
+	"sync"
+)
+
+// WithHotKeyTracking tracks the most requested keys, see HotKeys, with
+// capacity counters shared by all the keys requested, so counts are
+// approximate. Every key making up more than 1/capacity of the requests
+// is tracked.
+func WithHotKeyTracking[K comparable, V any](capacity int) Option[K, V] {
+	return func(o *options[K, V]) {
+		o.hotKeys = capacity
+	}
+}
+
+// KeyCount is the approximate number of times a key was requested.
+type KeyCount[K comparable] struct {
+	Key   K
+	Count uint64
+}
+
+// HotKeys returns the n most requested keys since the group was created
+// or ResetHotKeys was last called, the most requested first, e.g. to
+// pick the keys to keep warm. Counts may be overestimated by as much as
+// the count of the least requested key tracked. HotKeys returns nil
+// without WithHotKeyTracking or for n <= 0.
+func (g *Group[K, V]) HotKeys(n int) []KeyCount[K] {
+	if g.hot == nil || n <= 0 {
+		return nil
+	}
+	return g.hot.top(n)
+}
+
+// ResetHotKeys forgets the keys requested so far.
+func (g *Group[K, V]) ResetHotKeys() {
+	if g.hot != nil {
+		g.hot.reset()
+	}
+}
+
+// hotKeys tracks the most requested keys with the Space-Saving
+// algorithm: a key that isn't tracked when the counters are all used
+// takes over the counter of the least requested key, count included.
+type hotKeys[K comparable] struct {
+	mu    sync.Mutex    // protects the fields below
+	heap  []KeyCount[K] // min-heap by count
+	index map[K]int     // position of the tracked keys in heap
+	cap   int
+}
+
+func newHotKeys[K comparable](capacity int) *hotKeys[K] {
+	return &hotKeys[K]{
+		heap:  make([]KeyCount[K], 0, capacity),
+		index: make(map[K]int, capacity),
+		cap:   capacity,
+	}
+}
+
+// record counts a request of each of keys.
+func (h *hotKeys[K]) record(keys []K) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, key := range keys {
+		if i, has := h.index[key]; has {
+			h.heap[i].Count++
+			h.down(i)
+			continue
+		}
+		if len(h.heap) < h.cap {
+			h.heap = append(h.heap, KeyCount[K]{Key: key, Count: 1})
+			h.index[key] = len(h.heap) - 1
+			h.up(len(h.heap) - 1)
+			continue
+		}
+		delete(h.index, h.heap[0].Key)
+		h.heap[0].Key = key
+		h.heap[0].Count++
+		h.index[key] = 0
+		h.down(0)
+	}
+}
+
+// top returns the n keys with the highest counts, highest first.
+func (h *hotKeys[K]) top(n int) []KeyCount[K] {
+	h.mu.Lock()
+	top := append([]KeyCount[K](nil), h.heap...)
+	h.mu.Unlock()
+
+	sort.Slice(top, func(i, j int) bool { return top[i].Count > top[j].Count })
+	if len(top) > n {
+		top = top[:n]
+	}
+	return top
+}
+
+// reset forgets every key.
+func (h *hotKeys[K]) reset() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.heap = h.heap[:0]
+	h.index = make(map[K]int, h.cap)
+}
+
+// up moves the counter at i up the heap while lower than its parent.
+// Must be called with h.mu held.
+func (h *hotKeys[K]) up(i int) {
+	for i > 0 {
+		parent := (i - 1) / 2
+		if h.heap[parent].Count <= h.heap[i].Count {
+			return
+		}
+		h.swap(i, parent)
+		i = parent
+	}
+}
+
+// down moves the counter at i down the heap while higher than one of
+// its children. Must be called with h.mu held.
+func (h *hotKeys[K]) down(i int) {
+	for {
+		least := i
+		if l := 2*i + 1; l < len(h.heap) && h.heap[l].Count < h.heap[least].Count {
+			least = l
+		}
+		if r := 2*i + 2; r < len(h.heap) && h.heap[r].Count < h.heap[least].Count {
+			least = r
+		}
+		if least == i {
+			return
+		}
+		h.swap(i, least)
+		i = least
+	}
+}
+
+// swap swaps the counters at i and j. Must be called with h.mu held.
+func (h *hotKeys[K]) swap(i, j int) {
+	h.heap[i], h.heap[j] = h.heap[j], h.heap[i]
+	h.index[h.heap[i].Key] = i
+	h.index[h.heap[j].Key] = j
+}
@@ -0,0 +1,50 @@
+package multiflight
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHotKeys(t *testing.T) {
+	loader := func(ctx context.Context, keys []int) (map[int]string, error) {
+		return nil, nil
+	}
+
+	ast := assert.New(t)
+	g := NewGroup(WithHotKeyTracking[int, string](16))
+	ast.Empty(g.HotKeys(3))
+
+	// keys 1 to 3 are hot among many cold ones
+	for i := 0; i < 100; i++ {
+		keys := []int{1, 100 + i}
+		if i%2 == 0 {
+			keys = append(keys, 2)
+		}
+		if i%4 == 0 {
+			keys = append(keys, 3)
+		}
+		_, err := g.Do(context.Background(), keys, loader)
+		ast.Nil(err)
+	}
+	g.Scoped().Do(context.Background(), []int{1}, loader)
+
+	top := g.HotKeys(3)
+	if ast.Len(top, 3) {
+		ast.Equal([]int{1, 2, 3}, []int{top[0].Key, top[1].Key, top[2].Key})
+		ast.Equal(uint64(101), top[0].Count)
+		ast.GreaterOrEqual(top[1].Count, uint64(50))
+		ast.GreaterOrEqual(top[2].Count, uint64(25))
+	}
+	ast.Len(g.HotKeys(100), 16)
+	ast.Nil(g.HotKeys(0))
+	ast.Nil(g.HotKeys(-1))
+
+	// counting tracked keys doesn't allocate
+	ast.Zero(testing.AllocsPerRun(100, func() { g.hot.record([]int{1, 2}) }))
+
+	g.ResetHotKeys()
+	ast.Empty(g.HotKeys(3))
+	ast.Nil(NewGroup[int, string]().HotKeys(3))
+}
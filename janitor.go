@@ -0,0 +1,122 @@
+package multiflight
+
+import (
+	"container/heap"
+	"sync/atomic"
+	"time"
+)
+
+// sweepBatch is the most items the janitor removes per cache lock.
+const sweepBatch = 1024
+
+// WithJanitorInterval removes the expired results from the cache every
+// d, so keys that are never read again don't hold memory until they are.
+// The janitor runs until Close.
+func WithJanitorInterval[K comparable, V any](d time.Duration) Option[K, V] {
+	return func(o *options[K, V]) {
+		o.janitorInterval = d
+	}
+}
+
+// janitor is the janitor worker.
+func (g *Group[K, V]) janitor(interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-g.ctx.Done():
+			return
+		case <-t.C:
+			g.cache.sweep()
+			g.eachPartition(func(p *Group[K, V]) {
+				p.cache.sweep()
+			})
+		}
+	}
+}
+
+// sweep removes the expired items, the soonest expired first and a batch
+// at a time, so readers aren't locked out for the whole sweep of a large
+// cache.
+func (c *cache[K, V]) sweep() {
+	for {
+		if c.sweepBatch() < sweepBatch {
+			break
+		}
+	}
+	c.notifyEvicted()
+}
+
+// sweepBatch removes up to sweepBatch expired items and returns how many
+// it removed. It only looks at the items it removes, and the next one.
+func (c *cache[K, V]) sweepBatch() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	n := 0
+	for ; n < sweepBatch && len(c.expiries) > 0; n++ {
+		next := c.expiries[0]
+		if now.Before(next.it.expires) {
+			break
+		}
+		c.remove(next.key, next.it, Expired)
+	}
+	atomic.AddUint64(&c.swept, uint64(n))
+	return n
+}
+
+// expiries is a heap of the cached items that expire, by expiry.
+type expiries[K comparable, V any] []expiring[K, V]
+
+// expiring is an item in the expiry heap.
+type expiring[K comparable, V any] struct {
+	key K
+	it  *item[V]
+}
+
+func (h expiries[K, V]) Len() int           { return len(h) }
+func (h expiries[K, V]) Less(i, j int) bool { return h[i].it.expires.Before(h[j].it.expires) }
+
+func (h expiries[K, V]) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].it.index, h[j].it.index = i, j
+}
+
+func (h *expiries[K, V]) Push(x any) {
+	e := x.(expiring[K, V])
+	e.it.index = len(*h)
+	*h = append(*h, e)
+}
+
+func (h *expiries[K, V]) Pop() any {
+	old := *h
+	e := old[len(old)-1]
+	old[len(old)-1] = expiring[K, V]{}
+	*h = old[:len(old)-1]
+	return e
+}
+
+// has reports whether it is in the heap.
+func (h expiries[K, V]) has(it *item[V]) bool {
+	return it.index < len(h) && h[it.index].it == it
+}
+
+// update schedules it, cached for key, for its expiry, if any.
+func (h *expiries[K, V]) update(key K, it *item[V]) {
+	switch {
+	case it.expires.IsZero():
+		h.remove(it)
+	case h.has(it):
+		heap.Fix(h, it.index)
+	default:
+		heap.Push(h, expiring[K, V]{key: key, it: it})
+	}
+}
+
+// remove unschedules it.
+func (h *expiries[K, V]) remove(it *item[V]) {
+	if h.has(it) {
+		heap.Remove(h, it.index)
+	}
+}
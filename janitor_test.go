@@ -0,0 +1,76 @@
+package multiflight
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJanitor(t *testing.T) {
+	const KeysNum = sweepBatch*2 + 10
+
+	var version, loaded int32
+	loader := countingLoader(&version, &loaded)
+
+	ast := assert.New(t)
+	clock := newFakeClock()
+	g := NewGroup(
+		WithTTL[int, string](time.Minute),
+		WithNegativeTTL[int, string](time.Second),
+	)
+	// start the janitor once the clock is injected
+	g.cache.now = clock.Now
+	g.opts.janitorInterval = time.Millisecond
+	g.startWorkers()
+
+	keys := make([]int, 0, KeysNum)
+	for i := 0; i < KeysNum; i++ {
+		keys = append(keys, i)
+	}
+	_, err := g.Do(context.Background(), keys, loader)
+	ast.Nil(err)
+	g.MarkNotFound(-1, -2)
+
+	// expired not found records go first, then the expired values
+	clock.Advance(time.Second)
+	ast.Eventually(func() bool { return g.Stats().Swept == 2 }, time.Second, time.Millisecond)
+	clock.Advance(time.Minute)
+	ast.Eventually(func() bool { return g.Stats().Swept == KeysNum+2 }, time.Second, time.Millisecond)
+	g.cache.mu.Lock()
+	ast.Empty(g.cache.items)
+	g.cache.mu.Unlock()
+
+	ast.Nil(g.Close(context.Background()))
+}
+
+func TestSweepBatch(t *testing.T) {
+	ast := assert.New(t)
+	clock := newFakeClock()
+	c := newCache(&options[int, string]{maxEntries: 100})
+	c.now = clock.Now
+
+	// keys expire one second apart, in reverse order, and 0 never does
+	for i := 1; i <= 10; i++ {
+		c.set(i, "val", lifetime{ttl: time.Duration(11-i) * time.Second}, 0)
+	}
+	c.set(0, "val", lifetime{}, 0)
+	c.delete(5)
+	c.set(9, "val", lifetime{ttl: time.Hour}, 0)
+	ast.Len(c.expiries, 9)
+
+	// only the expired items are removed, the soonest expired first
+	clock.Advance(time.Second * 3)
+	ast.Equal(2, c.sweepBatch())
+	ast.NotContains(c.items, 10)
+	ast.NotContains(c.items, 8)
+	ast.Contains(c.items, 9)
+	clock.Advance(time.Minute)
+	ast.Equal(6, c.sweepBatch())
+	ast.Len(c.items, 2)
+	ast.Len(c.expiries, 1)
+
+	c.clear()
+	ast.Empty(c.expiries)
+}
@@ -0,0 +1,39 @@
+package multiflight
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrNoLoader is returned by DoDefault when the group has no loader.
+var ErrNoLoader = errors.New("multiflight: no default loader")
+
+// WithDefaultLoader sets the loader used by DoDefault.
+func WithDefaultLoader[K comparable, V any](load Loader[K, V]) Option[K, V] {
+	return func(o *options[K, V]) {
+		o.defaultLoader = load
+	}
+}
+
+// SetLoader replaces the loader used by DoDefault. Loads already started
+// keep the loader they started with.
+func (g *Group[K, V]) SetLoader(load Loader[K, V]) {
+	g.loader.Store(&load)
+}
+
+// DoDefault is like Do with the loader WithLoaderResolver resolves for
+// ctx, or the loader set by WithDefaultLoader or SetLoader. It fails
+// with ErrNoLoader if there is none. The calls of the default loader
+// share loader calls in a batch window unless they pass WithBatchKey.
+func (g *Group[K, V]) DoDefault(ctx context.Context, keys []K, opts ...CallOption) (map[K]V, error) {
+	if resolve := g.opts.resolver; resolve != nil {
+		if load := resolve(ctx); load != nil {
+			return g.Do(ctx, keys, load, opts...)
+		}
+	}
+	load := g.loader.Load()
+	if load == nil || *load == nil {
+		return nil, ErrNoLoader
+	}
+	return g.Do(ctx, keys, *load, append([]CallOption{WithBatchKey(load)}, opts...)...)
+}
@@ -0,0 +1,75 @@
+package multiflight
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func prefixLoader(prefix string) Loader[int, string] {
+	return func(ctx context.Context, keys []int) (map[int]string, error) {
+		resuts := make(map[int]string, len(keys))
+		for _, k := range keys {
+			resuts[k] = fmt.Sprintf("%s: %d", prefix, k)
+		}
+		return resuts, nil
+	}
+}
+
+func TestDefaultLoader(t *testing.T) {
+	ast := assert.New(t)
+
+	_, err := NewGroup[int, string]().DoDefault(context.Background(), []int{1})
+	ast.ErrorIs(err, ErrNoLoader)
+
+	g := NewGroup(WithDefaultLoader(prefixLoader("old")))
+	results, err := g.DoDefault(context.Background(), []int{1})
+	ast.Nil(err)
+	ast.Equal(map[int]string{1: "old: 1"}, results)
+
+	// an explicit loader still wins
+	results, err = g.Do(context.Background(), []int{1}, prefixLoader("explicit"))
+	ast.Nil(err)
+	ast.Equal(map[int]string{1: "explicit: 1"}, results)
+
+	g.SetLoader(prefixLoader("new"))
+	results, err = g.DoDefault(context.Background(), []int{1})
+	ast.Nil(err)
+	ast.Equal(map[int]string{1: "new: 1"}, results)
+}
+
+func TestSetLoaderConcurrently(t *testing.T) {
+	const WorkerNum = 20
+
+	ast := assert.New(t)
+	g := NewGroup(WithDefaultLoader(prefixLoader("old")))
+
+	var swapped int32
+	wg := sync.WaitGroup{}
+	for i := 0; i < WorkerNum; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				if i == 0 && j == 50 {
+					g.SetLoader(prefixLoader("new"))
+					atomic.StoreInt32(&swapped, 1)
+				}
+				// keys are not shared between workers, so no call can
+				// join a load started with the old loader
+				key := i*1000 + j
+				after := atomic.LoadInt32(&swapped) == 1
+				results, err := g.DoDefault(context.Background(), []int{key})
+				ast.Nil(err)
+				if after {
+					ast.Equal(fmt.Sprintf("new: %d", key), results[key])
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+}
@@ -0,0 +1,56 @@
+package multiflight
+
+import (
+	"context"
+	"time"
+)
+
+// eventLog receives the debug events of a group, see WithLogger. Its
+// methods must return quickly when the events aren't logged.
+type eventLog[K comparable] interface {
+	// dispatched is called before a loader call of keys started by
+	// trigger, see trigger.
+	dispatched(ctx context.Context, keys []K, trigger string)
+	// completed is called once a loader call of keys returned found
+	// values and missing keys not found after d.
+	completed(ctx context.Context, keys []K, d time.Duration, found, missing int)
+	// failed is called once a loader call of keys failed with err
+	// after d.
+	failed(ctx context.Context, keys []K, d time.Duration, err error)
+	// stuck is called when a loader call of keys is given up on after d.
+	stuck(ctx context.Context, keys []K, d time.Duration)
+	// canceled is called when a call stops waiting for keys with err.
+	canceled(ctx context.Context, keys []K, err error)
+	// logsCanceled reports whether canceled logs anything for ctx, so
+	// that the keys aren't collected for nothing.
+	logsCanceled(ctx context.Context) bool
+}
+
+// trigger names what started the loader call of ents: a call, the
+// batch window, a retry, or the revalidation or prefetch of values.
+func (g *Group[K, V]) trigger(ents []*ent[K, V], attempt int) string {
+	switch {
+	case attempt > 1:
+		return "retry"
+	case ents[0].prefetch:
+		return "prefetch"
+	case ents[0].stale:
+		return "revalidate"
+	case g.opts.batchWindow > 0:
+		return "window"
+	}
+	return "call"
+}
+
+// pendingKeys returns the keys of ents that aren't completed yet.
+func pendingKeys[K comparable, V any](ents []*ent[K, V]) []K {
+	var keys []K
+	for _, e := range ents {
+		select {
+		case <-e.done:
+		default:
+			keys = append(keys, e.key)
+		}
+	}
+	return keys
+}
@@ -0,0 +1,39 @@
+package multiflight
+
+import "context"
+
+// Request is a key to load along with metadata for the loader, e.g.
+// hints on how to load it, that plays no part in sharing loads.
+type Request[K comparable, M any] struct {
+	Key  K
+	Meta M
+}
+
+// MetaLoader is a Loader also getting the metadata of the keys.
+type MetaLoader[K comparable, V, M any] func(ctx context.Context, keys []K, metas map[K]M) (map[K]V, error)
+
+// DoWithMeta is like g.Do for the keys of reqs, load getting the
+// metadata of the keys along with them. Loads are still shared by key:
+// a key joining a load in flight gets its result whatever metadata it
+// was loaded with, so the metadata of the caller that started the load
+// wins. Of duplicate keys in reqs, the first one's metadata is used.
+// With WithBatchWindow and WithBatchKey, the keys of other calls
+// sharing the loader call have no metadata in metas.
+//
+// DoWithMeta is a function rather than a method of Group since methods
+// can't have type parameters of their own.
+func DoWithMeta[K comparable, V, M any](ctx context.Context, g *Group[K, V], reqs []Request[K, M], load MetaLoader[K, V, M], opts ...CallOption) (map[K]V, error) {
+	keys := make([]K, 0, len(reqs))
+	metas := make(map[K]M, len(reqs))
+	for _, r := range reqs {
+		if _, has := metas[r.Key]; has {
+			continue
+		}
+		keys = append(keys, r.Key)
+		metas[r.Key] = r.Meta
+	}
+
+	return g.Do(ctx, keys, func(ctx context.Context, keys []K) (map[K]V, error) {
+		return load(ctx, keys, metas)
+	}, opts...)
+}
@@ -0,0 +1,52 @@
+package multiflight
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDoWithMeta(t *testing.T) {
+	var calls int32
+	release := make(chan struct{})
+	loader := func(ctx context.Context, keys []int, metas map[int]string) (map[int]string, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		results := make(map[int]string, len(keys))
+		for _, k := range keys {
+			results[k] = fmt.Sprintf("val: %d %s", k, metas[k])
+		}
+		return results, nil
+	}
+
+	ast := assert.New(t)
+	g := NewGroup[int, string]()
+
+	type res struct {
+		vals map[int]string
+		err  error
+	}
+	do := func(reqs ...Request[int, string]) chan res {
+		ch := make(chan res, 1)
+		go func() {
+			vals, err := DoWithMeta(context.Background(), g, reqs, loader)
+			ch <- res{vals, err}
+		}()
+		return ch
+	}
+
+	leader := do(Request[int, string]{1, "leader"}, Request[int, string]{2, "leader"}, Request[int, string]{1, "dup"})
+	ast.Eventually(func() bool { return g.Len() == 2 }, time.Second, time.Millisecond)
+	// the follower shares the load of 1 and loads 3 with its own metadata
+	follower := do(Request[int, string]{1, "follower"}, Request[int, string]{3, "follower"})
+	ast.Eventually(func() bool { return atomic.LoadInt32(&calls) == 2 }, time.Second, time.Millisecond)
+	close(release)
+
+	ast.Equal(res{vals: map[int]string{1: "val: 1 leader", 2: "val: 2 leader"}}, <-leader)
+	ast.Equal(res{vals: map[int]string{1: "val: 1 leader", 3: "val: 3 follower"}}, <-follower)
+	ast.Equal(int32(2), atomic.LoadInt32(&calls))
+}
@@ -3,125 +3,1182 @@ package multiflight
 import (
 	"context"
 	"errors"
+	"fmt"
 	"sync"
+	"sync/atomic"
+	"time"
 )
 
 var (
 	// errResultNotFound result not found
 	errResultNotFound = errors.New("result not found")
+
+	// ErrOverCapacity is returned when registering new keys would exceed
+	// the in-flight cap and WithFailOverCapacity is set.
+	ErrOverCapacity = errors.New("multiflight: too many keys in flight")
+
+	// ErrTooManyWaiters is reported for keys that already have the
+	// maximum number of callers waiting on them.
+	ErrTooManyWaiters = errors.New("multiflight: too many waiters")
+
+	// ErrForgotten is returned to the callers waiting for loads when
+	// ForgetAll is called.
+	ErrForgotten = errors.New("multiflight: forgotten")
+
+	// ErrKeyFailed is returned to the callers waiting for loads failed
+	// by FailKey with a nil error.
+	ErrKeyFailed = errors.New("multiflight: key failed")
+
+	// ErrFollowerTimeout is returned to callers that waited for loads of
+	// other callers longer than WithMaxFollowerWait allows.
+	ErrFollowerTimeout = errors.New("multiflight: follower wait timed out")
+
+	// ErrLoadTimeout is wrapped by the errors of keys whose loader call
+	// took longer than WithLoadTimeout allows.
+	ErrLoadTimeout = errors.New("multiflight: load timed out")
 )
 
+// KeysError reports the keys of a call that failed with Err while the
+// other keys of the call were served as usual.
+type KeysError[K comparable] struct {
+	Keys []K
+	Err  error
+}
+
+func (e *KeysError[K]) Error() string {
+	return fmt.Sprintf("%v: %d keys", e.Err, len(e.Keys))
+}
+
+func (e *KeysError[K]) Unwrap() error {
+	return e.Err
+}
+
+// loadTimeoutError is the error of a loader call that took longer than
+// the load timeout. It is both ErrLoadTimeout and
+// context.DeadlineExceeded.
+type loadTimeoutError time.Duration
+
+func (d loadTimeoutError) Error() string {
+	return fmt.Sprintf("%v after %v", ErrLoadTimeout, time.Duration(d))
+}
+
+func (d loadTimeoutError) Is(target error) bool {
+	return target == ErrLoadTimeout || target == context.DeadlineExceeded
+}
+
 // Loader load values for multiple keys
 type Loader[K comparable, V any] func(ctx context.Context, keys []K) (map[K]V, error)
 
-// ent is an in-flight or completed request for one key
+// loadFunc is what the group calls to load a batch: the values and,
+// optionally, how long they are cached.
+type loadFunc[K comparable, V any] func(ctx context.Context, keys []K) (map[K]V, map[K]lifetime, error)
+
+func (l Loader[K, V]) batch() loadFunc[K, V] {
+	return func(ctx context.Context, keys []K) (map[K]V, map[K]lifetime, error) {
+		vals, err := l(ctx, keys)
+		return vals, nil, err
+	}
+}
+
+// ent is an in-flight or completed request for one key. The load that
+// created it always completes it and removes it from the in-flight keys,
+// whether callers still wait for it or all gave up, so no entry outlives
+// its load.
 type ent[K comparable, V any] struct {
-	wg  sync.WaitGroup
-	key K
+	done    chan struct{} // closed once the entry is completed
+	key     K
+	started time.Time // when the entry was registered
+	waiters int32     // callers attached to the entry, updated atomically
 
-	// These fields are written once before the WaitGroup is done
-	// and are only read after the WaitGroup is done.
+	// These fields are written once, with the group lock held, before
+	// done is closed, and are only read after done is closed: closing a
+	// channel happens before a receive that returns because it is
+	// closed, so every waiter, however late it joined, reads the same
+	// result.
 	val V
 	err error
+
+	completed bool // protected by the group lock
+	skipCache bool // the result of the entry isn't cached, protected by the group lock
+	stale     bool // the entry reloads a stale value, which callers are served meanwhile
+	prefetch  bool // the entry was registered by prefetch, not by a caller
+	aborted   bool // the entry was given up on by its fail-fast caller, protected by the group lock
+
+	trace    *loadTrace          // the traced load of the entry, written before done is closed like val
+	batch    uint64              // the ID of the last loader call of the entry, updated atomically
+	abort    *abort[K, V]        // the loader call of the entry with WithFailFast, protected by the group lock
+	failFast bool                // the entry was registered by a call with WithFailFast
+	failed   []chan<- *ent[K, V] // of the calls with WithFailFast to signal if the entry fails, protected by the group lock
+
+	source any // the loader of the entry in the batch window, see WithBatchKey, written by enqueue
+}
+
+func newEnt[K comparable, V any](key K) *ent[K, V] {
+	return &ent[K, V]{key: key, done: make(chan struct{}), started: time.Now()}
 }
 
-// Group multi group
+// Group multi group. A Group must not be copied after first use: keep
+// it behind a pointer, e.g. the one NewGroup returns.
 type Group[K comparable, V any] struct {
-	mu sync.Mutex       // protects m
-	m  map[K]*ent[K, V] // lazily initialized
+	noCopy noCopy
+
+	mu       sync.Mutex       // protects m, capacity and the batch window state
+	m        map[K]*ent[K, V] // lazily initialized
+	capacity chan struct{}    // closed when in-flight keys complete, lazily initialized
+	closed   bool             // no calls are accepted, by Close
+	closeErr error            // what calls fail with once closed by the context, nil for ErrClosed
+	draining bool             // no calls are accepted, by Drain
+	parent   *Group[K, V]     // the group of a scoped group, whose calls it rejects too
+
+	// batch window state, protected by mu
+	queue    []*queued[K, V]
+	queueSeq uint64
+	window   *time.Timer // armed while keys are queued
+
+	opts   options[K, V]
+	cache  *cache[K, V] // nil unless caching is enabled
+	keySem *weighted    // nil unless the concurrent keys are bounded
+	pool   *pool        // nil unless loads run on a worker pool
+	hot    *hotKeys[K]  // nil unless hot keys are tracked
+
+	partitions  sync.Map     // partition name to *Group, by WithContextKeyPartition
+	npartitions int          // the number of partitions, under mu
+	used        int64        // when a partition was last called, in unix nanoseconds, updated atomically
+	owner       *Group[K, V] // the group of a partition
+	pins        int          // calls redirected to a partition yet to register their keys, under the owner's mu
+
+	// background workers, stopped by Close
+	ctx       context.Context // nil without workers
+	cancel    context.CancelFunc
+	workers   sync.WaitGroup
+	closing   chan struct{} // closed by Close, nil unless NewGroupWithContext
+	closeOnce sync.Once
+	loader    atomic.Pointer[Loader[K, V]]
+	observers atomic.Pointer[[]Observer] // added by AddObserver
+	batches   uint64                     // loader calls numbered for the hooks, updated atomically
+	stats     stats
+}
+
+// noCopy makes go vet report copies of the struct embedding it.
+type noCopy struct{}
+
+func (*noCopy) Lock()   {}
+func (*noCopy) Unlock() {}
+
+// call is the registration state of one Do call.
+type call[K comparable, V any] struct {
+	result   map[K]V      // values served from the cache
+	ents     []*ent[K, V] // entries the call waits on
+	missEnts []*ent[K, V] // entries the call created and must load
+	hits     int          // keys served from the caches
+	rejected []K          // keys rejected with ErrTooManyWaiters
+	shed     []K          // keys rejected with ErrShed
+	stale    []*ent[K, V] // entries the call created to reload stale values in the background
+	hitKeys  []K          // keys served from the cache, for OnHit
+	joined   []joined[K]  // loads in flight the call joined, for OnWaiterJoin
 }
 
 // Do executes and returns the results of the given function, making
 // sure that only one execution is in-flight for every given key at a
 // time. If a duplicate comes in, the duplicate caller waits for the
-// original to complete and receives the same results.
-func (g *Group[K, V]) Do(ctx context.Context, keys []K, load Loader[K, V]) (map[K]V, error) {
-	ents := make([]*ent[K, V], 0, len(keys))
-	missEnts := make([]*ent[K, V], 0, len(keys))
+// original to complete and receives the same results. If ctx ends
+// while it waits, Do returns ctx.Err() unless WithCancelPolicy says
+// otherwise. The returned map is always the caller's own, but the values
+// in it are shared with other callers and the cache, see WithValueClone.
+func (g *Group[K, V]) Do(ctx context.Context, keys []K, load Loader[K, V], opts ...CallOption) (map[K]V, error) {
+	co := newCallOptions(opts)
+	load = g.loaderOf(load, &co)
+	return g.do(ctx, keys, load.batch(), co)
+}
 
-	g.withLock(func() {
-		if g.m == nil {
-			g.m = make(map[K]*ent[K, V], 1024) // 预分配一下
+// DoRefresh is like Do but never serves keys from the result cache: the
+// loader always runs for keys that aren't already being loaded, and its
+// results replace whatever was cached. Concurrent refreshes of the same
+// keys still share one load.
+func (g *Group[K, V]) DoRefresh(ctx context.Context, keys []K, load Loader[K, V], opts ...CallOption) (map[K]V, error) {
+	co := newCallOptions(opts)
+	load = g.loaderOf(load, &co)
+	co.refresh = true
+	return g.do(ctx, keys, load.batch(), co)
+}
+
+// ForceRefresh is like DoRefresh but never joins a load already in
+// flight either: it always loads keys afresh, and callers arriving
+// meanwhile join its load instead. The results of older loads of the
+// keys still go to their own callers, but the results of ForceRefresh
+// win in the cache whatever the order the loads complete in. It is Do
+// with WithNoCache and WithNoShare.
+func (g *Group[K, V]) ForceRefresh(ctx context.Context, keys []K, load Loader[K, V], opts ...CallOption) (map[K]V, error) {
+	co := newCallOptions(opts)
+	load = g.loaderOf(load, &co)
+	co.refresh = true
+	co.force = true
+	return g.do(ctx, keys, load.batch(), co)
+}
+
+// WithNoCache makes a call skip the result cache and the external cache
+// when reading, like DoRefresh: keys that aren't being loaded are loaded
+// and their results still replace whatever was cached. The call still
+// joins loads in flight unless combined with WithNoShare.
+func WithNoCache() CallOption {
+	return func(co *callOptions) {
+		co.refresh = true
+	}
+}
+
+// WithNoShare makes a call load its keys itself rather than join loads
+// in flight, which go on for their own callers. Callers arriving
+// meanwhile join the load of the call, whose results win in the cache.
+// Keys cached are still served from the cache unless combined with
+// WithNoCache, which together always load, like ForceRefresh.
+func WithNoShare() CallOption {
+	return func(co *callOptions) {
+		co.force = true
+	}
+}
+
+// DoLeader is like Do but also returns the keys whose loads this call
+// started, as opposed to keys it shared with other callers or got from
+// the cache, e.g. to run side effects only once per load.
+func (g *Group[K, V]) DoLeader(ctx context.Context, keys []K, load Loader[K, V], opts ...CallOption) (map[K]V, []K, error) {
+	co := newCallOptions(opts)
+	load = g.loaderOf(load, &co)
+	return g.doCall(ctx, keys, load.batch(), co)
+}
+
+// TryDo returns the values of keys that can be served right away from
+// the caches, without ever calling a loader, along with the keys that
+// would need a load. Keys being loaded and not cached are among the
+// latter since their values aren't there yet, and keys cached as not
+// found are in neither.
+// TryDo registers nothing, so it doesn't start or join loads.
+func (g *Group[K, V]) TryDo(ctx context.Context, keys []K) (map[K]V, []K) {
+	result := make(map[K]V, len(keys))
+	if g.opts.store != nil {
+		var stored map[K]V
+		stored, keys = g.lookup(ctx, keys)
+		for k, v := range stored {
+			result[k] = v
 		}
+	}
 
-		for _, key := range keys {
-			if e, has := g.m[key]; has {
-				ents = append(ents, e)
+	var misses []K
+	for _, key := range keys {
+		if g.cache != nil {
+			if it, ok := g.cache.get(key); ok && it.err == nil {
+				if !it.notFound {
+					result[key] = g.cache.copy(it.val)
+				}
 				continue
 			}
-			e := new(ent[K, V])
-			e.key = key
-			e.wg.Add(1)
-			g.m[key] = e // for share
-			ents = append(ents, e)
-			missEnts = append(missEnts, e)
 		}
+		misses = append(misses, key)
+	}
+	if g.cache != nil {
+		g.cache.notifyEvicted()
+	}
+	return result, misses
+}
+
+func (g *Group[K, V]) do(ctx context.Context, keys []K, load loadFunc[K, V], co callOptions) (map[K]V, error) {
+	result, _, err := g.doCall(ctx, keys, load, co)
+	return result, err
+}
+
+// doCall is do also returning the keys whose loads the call started.
+func (g *Group[K, V]) doCall(ctx context.Context, keys []K, load loadFunc[K, V], co callOptions) (map[K]V, []K, error) {
+	if p := g.partitionOf(ctx); p != g {
+		co.pinned = true
+		return p.doCall(ctx, keys, load, co)
+	}
+	c, err := g.begin(ctx, keys, load, co)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer g.leave(c)
+	leaders := make([]K, 0, len(c.missEnts))
+	for _, e := range c.missEnts {
+		leaders = append(leaders, e.key)
+	}
+
+	result := c.result
+	var failed error
+	pending, err := g.await(ctx, c, load, co, func(e *ent[K, V]) bool {
+		switch {
+		case errors.Is(e.err, errResultNotFound):
+			// result not found, skip
+		case e.err != nil:
+			failed = e.err // return the first err
+			return false
+		default:
+			result[e.key] = e.val
+		}
+		return true
 	})
+	switch {
+	case failed != nil:
+		return nil, leaders, failed
+	case pending != nil:
+		// the entries are completed by their loads all the same
+		result, err := g.canceled(ctx, result, pending)
+		return result, leaders, err
+	case err != nil:
+		return nil, leaders, err
+	}
+
+	if len(c.shed) > 0 {
+		return result, leaders, &KeysError[K]{Keys: c.shed, Err: ErrShed}
+	}
+	if len(c.rejected) > 0 {
+		return result, leaders, &KeysError[K]{Keys: c.rejected, Err: ErrTooManyWaiters}
+	}
+	return result, leaders, nil
+}
+
+// await loads the missing entries of the call c and waits for each of
+// its entries in turn, passing them to each once completed, until each
+// returns false. It stops early with the entries it didn't wait for and
+// ctx.Err() once ctx is done, with ErrFollowerTimeout, or with the error
+// of the first load of the call failing with WithFailFast.
+func (g *Group[K, V]) await(ctx context.Context, c *call[K, V], load loadFunc[K, V], co callOptions, each func(e *ent[K, V]) bool) ([]*ent[K, V], error) {
+	if cs := co.stats; cs != nil {
+		cs.CacheHits = c.hits
+		cs.SharedKeys = len(c.ents) - len(c.missEnts)
+		cs.LoadedKeys = len(c.missEnts)
+		start := time.Now()
+		defer func() {
+			cs.Slowest = time.Since(start)
+			cs.BatchIDs = batchIDs(c.ents)
+		}()
+	}
 
 	// load keys
-	if len(missEnts) > 0 {
-		g.doLoad(ctx, missEnts, load)
+	if len(c.missEnts) > 0 {
+		start := co.timings.now()
+		switch {
+		case g.opts.batchWindow > 0:
+			g.enqueue(ctx, c.missEnts, load, co.source, co.priority)
+		case co.failFast:
+			go g.runLoad(ctx, c.missEnts, load)
+		default:
+			g.runLoad(ctx, c.missEnts, load)
+		}
+		if co.timings != nil {
+			co.timings.Load += time.Since(start)
+		}
 	}
 
-	result := make(map[K]V, len(keys))
-	for _, e := range ents {
-		e.wg.Wait()
-		if e.err != nil {
-			// result not found, skip
-			if errors.Is(e.err, errResultNotFound) {
-				continue
+	var own map[*ent[K, V]]struct{}
+	if co.timings != nil || g.opts.maxFollowerWait > 0 || co.failFast {
+		own = make(map[*ent[K, V]]struct{}, len(c.missEnts))
+		for _, e := range c.missEnts {
+			own[e] = struct{}{}
+		}
+	}
+	follow, cancel := g.followerContext(ctx, c)
+	defer cancel()
+	if t := g.opts.tracer; t != nil && len(c.ents) > len(c.missEnts) {
+		defer g.traceWait(ctx, t, c, time.Now())
+	}
+	var failed <-chan *ent[K, V]
+	if co.failFast {
+		failed = g.firstFailure(c)
+	}
+	for i, e := range c.ents {
+		start := co.timings.now()
+		_, leader := own[e]
+		done := follow.Done()
+		if leader {
+			done = ctx.Done()
+		}
+		select {
+		case <-e.done:
+		case f := <-failed:
+			g.abortOwn(own)
+			return nil, f.err
+		case <-done:
+			if l := g.opts.log; l != nil && l.logsCanceled(ctx) {
+				err := ctx.Err()
+				if err == nil {
+					err = ErrFollowerTimeout
+				}
+				l.canceled(ctx, pendingKeys(c.ents[i:]), err)
+			}
+			if ctx.Err() == nil {
+				return nil, ErrFollowerTimeout
+			}
+			return c.ents[i:], ctx.Err()
+		}
+		if co.timings != nil && !leader {
+			co.timings.FollowerWait += time.Since(start)
+		}
+		if !each(e) {
+			if co.failFast {
+				g.abortOwn(own)
+			}
+			return nil, nil
+		}
+	}
+	return nil, nil
+}
+
+// begin registers a call for keys, serving what it can from the caches
+// and reloading stale values in the background. The caller must load
+// the missing entries of the call and leave it once done.
+func (g *Group[K, V]) begin(ctx context.Context, keys []K, load loadFunc[K, V], co callOptions) (*call[K, V], error) {
+	if co.pinned {
+		defer g.unpin()
+	}
+	keys = g.filter(keys)
+	if g.hot != nil {
+		g.hot.record(keys)
+	}
+	atomic.AddUint64(&g.stats.calls, 1)
+	atomic.AddUint64(&g.stats.keys, uint64(len(keys)))
+	// don't register keys nobody will wait for
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	var stored map[K]V
+	if g.opts.store != nil && !co.refresh {
+		stored, keys = g.lookup(ctx, keys)
+		atomic.AddUint64(&g.stats.cacheHits, uint64(len(stored)))
+	}
+
+	c, err := g.register(ctx, keys, co)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range stored {
+		c.result[k] = v
+	}
+	c.hits += len(stored)
+	atomic.AddUint64(&g.stats.cacheMisses, uint64(len(c.missEnts)))
+	g.callHooks(c, stored)
+	if len(c.stale) > 0 {
+		g.revalidate(ctx, c.stale, load, co.source, co.priority)
+	}
+	return c, nil
+}
+
+// followerContext returns the context c waits for the loads of other
+// callers with, ctx bounded by the max follower wait.
+func (g *Group[K, V]) followerContext(ctx context.Context, c *call[K, V]) (context.Context, context.CancelFunc) {
+	if d := g.opts.maxFollowerWait; d > 0 && len(c.ents) > len(c.missEnts) {
+		return context.WithTimeout(ctx, d)
+	}
+	return ctx, func() {}
+}
+
+// register looks up or creates the entries for keys and attaches the
+// call to them, serving cached keys unless it refreshes them. It blocks
+// while the in-flight cap would be exceeded.
+func (g *Group[K, V]) register(ctx context.Context, keys []K, co callOptions) (c *call[K, V], err error) {
+	refresh := co.refresh
+	for {
+		var wait chan struct{}
+		start := co.timings.now()
+		g.withLock(func() {
+			if co.timings != nil {
+				co.timings.LockWait += time.Since(start)
+			}
+			if err = g.rejected(); err != nil {
+				return
+			}
+			if g.m == nil {
+				g.m = make(map[K]*ent[K, V], 1024) // 预分配一下
+			}
+
+			if !refresh {
+				if err = g.cachedErr(keys); err != nil {
+					return
+				}
+			}
+			if g.overCapacity(keys, refresh) {
+				if g.opts.failOverCap {
+					err = ErrOverCapacity
+					return
+				}
+				if g.capacity == nil {
+					g.capacity = make(chan struct{})
+				}
+				wait = g.capacity
+				return
 			}
 
-			return nil, e.err // return the first err
+			shed := g.shouldShed(keys, refresh)
+			c = &call[K, V]{
+				result:   make(map[K]V, len(keys)),
+				ents:     make([]*ent[K, V], 0, len(keys)),
+				missEnts: make([]*ent[K, V], 0, len(keys)),
+			}
+			var forced map[K]bool // keys the call loads afresh
+			if co.force {
+				forced = make(map[K]bool, len(keys))
+			}
+			for _, key := range keys {
+				e, has := g.m[key]
+				var replaced *ent[K, V]
+				if has && co.force && !forced[key] {
+					replaced, has = e, false
+				}
+				if has && refresh && e.lingering() {
+					has = false
+				}
+				if has && e.stale && !refresh {
+					if hit, _ := g.serveCached(c, key); hit {
+						continue
+					}
+				}
+				if has {
+					if max := g.opts.maxWaitersPerKey; max > 0 && atomic.LoadInt32(&e.waiters) >= int32(max) {
+						c.rejected = append(c.rejected, key)
+						atomic.AddUint64(&g.stats.rejectedWaiters, 1)
+						continue
+					}
+					g.attach(e)
+					c.ents = append(c.ents, e)
+					atomic.AddUint64(&g.stats.sharedKeys, 1)
+					if g.opts.hooks.OnWaiterJoin != nil {
+						c.joined = append(c.joined, joined[K]{key: key, waiters: int(atomic.LoadInt32(&e.waiters))})
+					}
+					continue
+				}
+				early := false
+				if !refresh && g.cache != nil {
+					var hit bool
+					if hit, early = g.serveCached(c, key); hit {
+						continue
+					}
+				}
+				if shed {
+					c.shed = append(c.shed, key)
+					atomic.AddUint64(&g.stats.shed, 1)
+					continue
+				}
+				if replaced != nil {
+					// the older load still completes its callers
+					replaced.skipCache = true
+				}
+				e = newEnt[K, V](key)
+				e.stale = early
+				e.failFast = co.failFast
+				if forced != nil {
+					forced[key] = true
+				}
+				g.m[key] = e // for share
+				g.attach(e)
+				c.ents = append(c.ents, e)
+				c.missEnts = append(c.missEnts, e)
+			}
+		})
+		if wait == nil {
+			return c, err
+		}
+
+		select {
+		case <-wait:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// serveCached adds the cached value of key to the result of c, and
+// reports whether it was cached. A stale value not being reloaded yet
+// gets an entry for c to reload it, and a value expiring early is not
+// served but reported for c to reload it. Must be called with g.mu held.
+func (g *Group[K, V]) serveCached(c *call[K, V], key K) (hit, early bool) {
+	it, ok := g.cache.get(key)
+	if !ok || it.err != nil {
+		return false, false
+	}
+	if _, has := g.m[key]; !has && g.cache.expiresEarly(it) {
+		return false, true
+	}
+	if !it.notFound {
+		c.result[key] = g.cache.copy(it.val)
+	}
+	if _, has := g.m[key]; !has && g.cache.isStale(it) {
+		e := newEnt[K, V](key)
+		e.stale = true
+		g.m[key] = e
+		c.stale = append(c.stale, e)
+	}
+	atomic.AddUint64(&g.stats.cacheHits, 1)
+	c.hits++
+	if g.opts.hooks.OnHit != nil {
+		c.hitKeys = append(c.hitKeys, key)
+	}
+	return true, false
+}
+
+// cachedErr returns the cached error of the first key of keys that
+// isn't being loaded and failed recently. Must be called with g.mu held.
+func (g *Group[K, V]) cachedErr(keys []K) error {
+	if g.cache == nil || g.cache.errorTTL <= 0 {
+		return nil
+	}
+	for _, key := range keys {
+		if _, has := g.m[key]; has {
+			continue
+		}
+		if it, ok := g.cache.peek(key); ok && it.err != nil {
+			return it.err
 		}
-		result[e.key] = e.val
+	}
+	return nil
+}
+
+// attach counts the caller as a waiter of e.
+func (g *Group[K, V]) attach(e *ent[K, V]) {
+	atomic.AddInt32(&e.waiters, 1)
+	atomic.AddInt64(&g.stats.waiters, 1)
+}
+
+// leave detaches the call from all the entries it waited on.
+func (g *Group[K, V]) leave(c *call[K, V]) {
+	for _, e := range c.ents {
+		atomic.AddInt32(&e.waiters, -1)
+	}
+	atomic.AddInt64(&g.stats.waiters, -int64(len(c.ents)))
+}
+
+// overCapacity reports whether registering keys would push the number
+// of in-flight keys over the cap. Must be called with g.mu held.
+func (g *Group[K, V]) overCapacity(keys []K, refresh bool) bool {
+	if g.opts.maxInFlightKeys <= 0 || len(g.m) == 0 {
+		return false
 	}
 
-	return result, nil
+	n := g.countNew(keys, refresh)
+	return n > 0 && len(g.m)+n > g.opts.maxInFlightKeys
+}
+
+// countNew returns the number of distinct keys that registering keys
+// would start loading. Must be called with g.mu held.
+func (g *Group[K, V]) countNew(keys []K, refresh bool) int {
+	misses := make(map[K]struct{}, len(keys))
+	for _, key := range keys {
+		if _, has := g.m[key]; has {
+			continue
+		}
+		if !refresh && g.cache != nil {
+			if it, ok := g.cache.peek(key); ok && it.err == nil {
+				continue
+			}
+		}
+		misses[key] = struct{}{}
+	}
+	return len(misses)
 }
 
 // doLoad load for miss keys.
-func (g *Group[K, V]) doLoad(ctx context.Context, ents []*ent[K, V], load Loader[K, V]) {
+func (g *Group[K, V]) doLoad(ctx context.Context, ents []*ent[K, V], load loadFunc[K, V]) {
+	if g.keySem != nil {
+		n, err := g.keySem.acquire(ctx, int64(len(ents)))
+		if err != nil {
+			g.failAll(ents, err)
+			return
+		}
+		defer g.keySem.release(n)
+	}
+
+	if l := g.opts.limiter; l != nil && !g.opts.limitPerChunk {
+		if err := l.Wait(ctx); err != nil {
+			g.failAll(ents, err)
+			return
+		}
+	}
+
+	chunks := g.chunk(ents)
+	wg := sync.WaitGroup{}
+	for i, chunk := range chunks[1:] {
+		wg.Add(1)
+		go func(i int, chunk []*ent[K, V]) {
+			defer wg.Done()
+			g.loadChunk(ctx, i, chunk, load)
+		}(i+1, chunk)
+	}
+	g.loadChunk(ctx, 0, chunks[0], load)
+	wg.Wait()
+}
+
+// chunk splits ents into batches of at most the max batch size.
+func (g *Group[K, V]) chunk(ents []*ent[K, V]) [][]*ent[K, V] {
+	size := g.opts.maxBatchSize
+	if size <= 0 || len(ents) <= size {
+		return [][]*ent[K, V]{ents}
+	}
+
+	chunks := make([][]*ent[K, V], 0, (len(ents)+size-1)/size)
+	for len(ents) > size {
+		chunks = append(chunks, ents[:size:size])
+		ents = ents[size:]
+	}
+	return append(chunks, ents)
+}
+
+// loadChunk calls the loader for ents and completes them, retrying
+// failed attempts for the keys that are still missing. chunk is the
+// index of ents in their batch.
+func (g *Group[K, V]) loadChunk(ctx context.Context, chunk int, ents []*ent[K, V], load loadFunc[K, V]) {
+	ctx, cancel := g.abortable(ctx, ents)
+	defer cancel()
+	for attempt := 1; ; attempt++ {
+		left, err := g.loadAttempt(ctx, attempt, chunk, ents, load)
+		if err == nil || len(left) == 0 {
+			return
+		}
+
+		ents = left
+		if err = g.retry(ctx, attempt, err); err != nil {
+			g.failAll(ents, err)
+			return
+		}
+	}
+}
+
+// loadAttempt makes attempt to call the loader for ents. It completes the entries
+// it got an answer for and returns the others with the error that
+// failed them.
+func (g *Group[K, V]) loadAttempt(ctx context.Context, attempt, chunk int, ents []*ent[K, V], load loadFunc[K, V]) ([]*ent[K, V], error) {
+	if l := g.opts.limiter; l != nil && g.opts.limitPerChunk {
+		if err := l.Wait(ctx); err != nil {
+			return ents, err
+		}
+	}
+
 	keys := make([]K, 0, len(ents))
 	for _, e := range ents {
 		keys = append(keys, e.key)
 	}
 
-	vals, err := load(ctx, keys)
-	if err != nil {
-		g.withLock(func() {
-			for _, e := range ents {
-				g.setCallErr(e, err)
-			}
-		})
-		return
+	if b := g.opts.breaker; b != nil && !b.Allow() {
+		return ents, ErrCircuitOpen
 	}
 
+	g.stats.batchSizes.record(g.opts.batchBounds(), len(keys))
+	atomic.AddUint64(&g.stats.attemptedKeys, uint64(len(keys)))
+	if attempt == 1 {
+		atomic.AddUint64(&g.stats.fetchedKeys, uint64(len(keys)))
+	}
+	ctx, vals, ttls, cost, err := g.callObserved(ctx, attempt, chunk, ents, keys, load)
+	if err != nil && (vals == nil || !g.opts.partialOnError) {
+		return ents, err
+	}
+
+	var invalid map[K]error
+	if g.opts.fallback != nil && err == nil {
+		vals, invalid = g.loadFallback(ctx, attempt, chunk, ents, vals)
+	}
+	if g.opts.processor != nil {
+		var rejected map[K]error
+		vals, rejected = g.process(ctx, vals)
+		if invalid == nil {
+			invalid = rejected
+		}
+		for k, perr := range rejected {
+			invalid[k] = perr
+		}
+	}
+
+	var (
+		left    []*ent[K, V]
+		done    = make([]*ent[K, V], 0, len(ents))
+		stored  map[K]V
+		related map[K]V // values to prefetch the related keys of
+
+		found, missing int
+	)
 	g.withLock(func() {
+		if g.opts.store != nil {
+			stored = make(map[K]V, len(vals))
+		}
+		if g.opts.prefetch != nil && g.cache != nil {
+			related = make(map[K]V, len(vals))
+		}
 		for _, e := range ents {
-			if v, has := vals[e.key]; has {
-				g.setCallResult(e, v)
-			} else {
+			if e.completed {
+				continue // by ForgetAll or FailKey
+			}
+			v, loaded := vals[e.key]
+			if perr, has := invalid[e.key]; has {
+				g.setCallErr(e, perr)
+			} else if loaded && g.isNotFound(e.key, v) {
+				g.setCallErr(e, errResultNotFound)
+			} else if loaded {
+				if stored != nil && !e.skipCache {
+					stored[e.key] = v
+				}
+				if related != nil && !e.prefetch {
+					related[e.key] = v
+				}
+				g.setCallResult(e, v, ttls[e.key], cost)
+				found++
+			} else if err == nil {
 				g.setCallErr(e, errResultNotFound)
+				missing++
+			} else {
+				left = append(left, e)
+				continue
 			}
+			done = append(done, e)
+		}
+		if g.opts.acceptExtraKeys {
+			done = g.acceptExtra(keys, vals, ttls, cost, stored, done)
 		}
+		finish(done)
+		g.releaseCapacity()
+	})
+	if len(stored) > 0 {
+		g.opts.store.Set(ctx, stored)
+	}
+	if len(related) > 0 {
+		g.prefetch(ctx, related, load, ents[0].source)
+	}
+	if l := g.opts.log; l != nil && err == nil {
+		l.completed(ctx, keys, cost, found, missing)
+	}
+	return left, err
+}
+
+// acceptExtra caches the values of vals for keys that weren't asked
+// for, completing their entries in flight, and returns done with these
+// entries added. Must be called with g.mu held.
+func (g *Group[K, V]) acceptExtra(keys []K, vals map[K]V, ttls map[K]lifetime, cost time.Duration, stored map[K]V, done []*ent[K, V]) []*ent[K, V] {
+	asked := make(map[K]struct{}, len(keys))
+	for _, key := range keys {
+		asked[key] = struct{}{}
+	}
+	for k, v := range vals {
+		if _, has := asked[k]; has || g.isNotFound(k, v) {
+			continue
+		}
+		if e, has := g.m[k]; has && e.lingering() {
+			g.remove(e)
+		} else if has {
+			if stored != nil && !e.skipCache {
+				stored[k] = v
+			}
+			g.setCallResult(e, v, ttls[k], cost)
+			done = append(done, e)
+			continue
+		}
+		if stored != nil {
+			stored[k] = v
+		}
+		if g.cache != nil {
+			g.cache.setLoaded(k, v, ttls[k], cost)
+		}
+	}
+	return done
+}
+
+// isNotFound reports whether the loader returned val for key to tell
+// that key doesn't exist.
+func (g *Group[K, V]) isNotFound(key K, val V) bool {
+	return g.opts.notFound != nil && g.opts.notFound(key, val)
+}
+
+// process runs the value processor on freshly loaded vals, returning
+// the processed values and the errors of the rejected keys.
+func (g *Group[K, V]) process(ctx context.Context, vals map[K]V) (map[K]V, map[K]error) {
+	processed := make(map[K]V, len(vals))
+	var invalid map[K]error
+	for k, v := range vals {
+		v, err := g.opts.processor(ctx, k, v)
+		if err != nil {
+			if invalid == nil {
+				invalid = make(map[K]error)
+			}
+			invalid[k] = err
+			continue
+		}
+		processed[k] = v
+	}
+	return processed, invalid
+}
+
+// callLoader calls load for keys, hedging the call if configured.
+func (g *Group[K, V]) callLoader(ctx context.Context, keys []K, load loadFunc[K, V]) (map[K]V, map[K]lifetime, error) {
+	if g.opts.hedgeDelay > 0 && g.opts.maxHedges > 0 {
+		return g.hedgedLoad(ctx, keys, load)
+	}
+
+	atomic.AddUint64(&g.stats.loads, 1)
+	return load(ctx, keys)
+}
+
+// callObserved calls load for keys, the keys of ents, as attempt of
+// the loader call chunk of their batch: the hooks of the group are
+// notified of the call, which is bounded by the load timeout, profiled
+// and recorded by the stats and the circuit breaker. It returns the
+// context of the batch along with the results of the call and its
+// duration.
+func (g *Group[K, V]) callObserved(ctx context.Context, attempt, chunk int, ents []*ent[K, V], keys []K, load loadFunc[K, V]) (context.Context, map[K]V, map[K]lifetime, time.Duration, error) {
+	ctx, batch := g.nextBatch(ctx, ents)
+	hooks := g.loadHooks()
+	call := &loadCall[K, V]{ctx: ctx, batch: batch, attempt: attempt, chunk: chunk, ents: ents, keys: keys}
+	g.startLoad(hooks, call)
+	start := time.Now()
+	slow := g.watchSlow(keys, start)
+	vals, ttls, err := g.timedLoad(call.ctx, keys, g.labeled(load))
+	cost := time.Since(start)
+	if slow != nil {
+		slow(cost)
+	}
+	g.endLoad(hooks, call, err, cost)
+	g.stats.observeLatency(cost)
+	g.recordOutcome(err)
+	if b := g.opts.breaker; b != nil {
+		b.Record(err)
+	}
+	return ctx, vals, ttls, cost, err
+}
+
+// timedLoad is callLoader bounded by the load timeout. A loader still
+// running past the timeout is given up on, its results dropped, so that
+// one ignoring its context can't hang the keys.
+func (g *Group[K, V]) timedLoad(ctx context.Context, keys []K, load loadFunc[K, V]) (map[K]V, map[K]lifetime, error) {
+	d := g.opts.loadTimeout
+	if d <= 0 {
+		return g.callLoader(ctx, keys, load)
+	}
+
+	loadCtx, cancel := context.WithTimeout(ctx, d)
+	defer cancel()
+	results := make(chan loadResult[K, V], 1) // never blocks a loader given up on
+	go func() {
+		vals, ttls, err := g.callLoader(loadCtx, keys, load)
+		results <- loadResult[K, V]{vals: vals, ttls: ttls, err: err}
+	}()
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case r := <-results:
+		if r.err != nil && ctx.Err() == nil && errors.Is(loadCtx.Err(), context.DeadlineExceeded) {
+			r.err = loadTimeoutError(d)
+		}
+		return r.vals, r.ttls, r.err
+	case <-t.C:
+		if err := ctx.Err(); err != nil {
+			return nil, nil, err
+		}
+		if l := g.opts.log; l != nil {
+			l.stuck(ctx, keys, d)
+		}
+		return nil, nil, loadTimeoutError(d)
+	}
+}
+
+// failAll completes ents with err.
+func (g *Group[K, V]) failAll(ents []*ent[K, V], err error) {
+	g.withLock(func() {
+		done := make([]*ent[K, V], 0, len(ents))
+		for _, e := range ents {
+			if !e.completed {
+				g.setCallErr(e, err)
+				done = append(done, e)
+			}
+		}
+		finish(done)
+		g.releaseCapacity()
+	})
+}
+
+// Len returns the number of keys currently being loaded, the not found
+// results WithNotFoundCoalesce keeps included. It only holds the group
+// lock briefly, and is cheap enough for health checks to poll.
+func (g *Group[K, V]) Len() int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return len(g.m)
+}
+
+// InFlight reports whether key is currently being loaded. Like Len, it
+// only holds the group lock briefly.
+func (g *Group[K, V]) InFlight(key K) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	e, has := g.m[key]
+	return has && !e.lingering()
+}
+
+// Forget tells the group to forget about keys: later calls load them
+// again instead of joining loads in flight or being served whatever is
+// cached for them, errors included, and they are deleted from the
+// external cache. Callers already waiting for a forgotten load still get
+// its result, which isn't cached.
+func (g *Group[K, V]) Forget(keys ...K) {
+	g.forget(keys)
+	g.eachPartition(func(p *Group[K, V]) {
+		p.forget(keys)
+	})
+	if s := g.opts.store; s != nil {
+		s.Delete(context.Background(), keys)
+	}
+}
+
+// forget is Forget without the external cache.
+func (g *Group[K, V]) forget(keys []K) {
+	g.withLock(func() {
+		for _, key := range keys {
+			if e, has := g.m[key]; has {
+				e.skipCache = true
+				delete(g.m, key)
+			}
+			if g.cache != nil {
+				g.cache.delete(key)
+			}
+		}
+		g.releaseCapacity()
+	})
+}
+
+// FailKey fails the loads in flight of keys with err: their callers get
+// err right away, unless they run the load themselves, and the keys are
+// no longer in flight, so later calls load them again. The loader calls
+// go on and their results for keys are dropped. Whichever completes a
+// key first, FailKey or its load, wins: keys already completed are left
+// alone, and so are keys completed meanwhile by FailKey for their load.
+// A nil err fails the loads with ErrKeyFailed.
+func (g *Group[K, V]) FailKey(err error, keys ...K) {
+	if err == nil {
+		err = ErrKeyFailed
+	}
+	g.withLock(func() {
+		ents := make([]*ent[K, V], 0, len(keys))
+		for _, key := range keys {
+			e, has := g.m[key]
+			if !has || e.completed {
+				continue
+			}
+			e.err = err
+			e.completed = true
+			e.skipCache = true
+			delete(g.m, key)
+			ents = append(ents, e)
+		}
+		finish(ents)
+		g.releaseCapacity()
+	})
+	g.eachPartition(func(p *Group[K, V]) {
+		p.FailKey(err, keys...)
+	})
+}
+
+// ForgetAll resets the group: the callers of loads in flight get
+// ErrForgotten, right away unless they run the load themselves, the
+// loads are forgotten, their results being dropped when they complete,
+// and the cache is emptied. The external cache is left alone.
+func (g *Group[K, V]) ForgetAll() {
+	g.withLock(func() {
+		ents := make([]*ent[K, V], 0, len(g.m))
+		for _, e := range g.m {
+			if e.lingering() {
+				continue
+			}
+			e.err = ErrForgotten
+			e.completed = true
+			ents = append(ents, e)
+		}
+		g.m = nil
+		finish(ents)
+		if g.cache != nil {
+			g.cache.clear()
+		}
+		g.releaseCapacity()
+	})
+	g.eachPartition(func(p *Group[K, V]) {
+		p.ForgetAll()
 	})
 }
 
 func (g *Group[K, V]) withLock(f func()) {
+	if g.cache != nil {
+		defer g.cache.notifyEvicted()
+	}
 	g.mu.Lock()
 	defer g.mu.Unlock()
 	f()
 }
 
-func (g *Group[K, V]) setCallResult(e *ent[K, V], v V) {
+func (g *Group[K, V]) setCallResult(e *ent[K, V], v V, life lifetime, cost time.Duration) {
+	if g.cache != nil && !e.skipCache {
+		g.cache.setLoaded(e.key, v, life, cost)
+	}
+	atomic.AddUint64(&g.stats.loadedKeys, 1)
 	e.val = v
-	e.wg.Done()
-	delete(g.m, e.key)
+	e.completed = true
+	g.remove(e)
 }
 
 func (g *Group[K, V]) setCallErr(e *ent[K, V], err error) {
+	if g.cache != nil && !e.skipCache {
+		switch {
+		case err == errResultNotFound && g.cache.negativeTTL > 0:
+			g.cache.setNotFound(e.key)
+		case err == errResultNotFound:
+			g.cache.delete(e.key)
+		case g.cache.errorTTL > 0 && g.errCacheable(err):
+			g.cache.setErr(e.key, err)
+		}
+	}
+	if err == errResultNotFound {
+		atomic.AddUint64(&g.stats.notFound, 1)
+	} else {
+		atomic.AddUint64(&g.stats.errors, 1)
+	}
 	e.err = err
-	e.wg.Done()
-	delete(g.m, e.key)
-}
\ No newline at end of file
+	e.completed = true
+	if err == errResultNotFound && g.opts.notFoundCoalesce > 0 && !e.skipCache {
+		g.linger(e)
+		return
+	}
+	g.remove(e)
+}
+
+// finish releases the waiters of ents once all of them are completed,
+// so callers waiting on several entries of a batch see all its results,
+// and signals the fail-fast calls of those that failed. Must be called
+// with g.mu held.
+func finish[K comparable, V any](ents []*ent[K, V]) {
+	for _, e := range ents {
+		close(e.done)
+	}
+	for _, e := range ents {
+		if e.fails() {
+			for _, ch := range e.failed {
+				signal(ch, e)
+			}
+		}
+	}
+}
+
+// errCacheable reports whether err may be cached for the error TTL.
+func (g *Group[K, V]) errCacheable(err error) bool {
+	if g.opts.errorCacheable != nil {
+		return g.opts.errorCacheable(err)
+	}
+	return !errors.Is(err, context.Canceled)
+}
+
+// remove deletes e from the in-flight keys unless it was forgotten and
+// replaced already. Must be called with g.mu held.
+func (g *Group[K, V]) remove(e *ent[K, V]) {
+	if g.m[e.key] == e {
+		delete(g.m, e.key)
+	}
+}
+
+// releaseCapacity wakes callers blocked on the in-flight cap.
+// Must be called with g.mu held.
+func (g *Group[K, V]) releaseCapacity() {
+	if g.capacity != nil {
+		close(g.capacity)
+		g.capacity = nil
+	}
+}
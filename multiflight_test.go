@@ -2,8 +2,10 @@ package multiflight
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"math/rand"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"testing"
@@ -44,7 +46,7 @@ func TestMultiflight(t *testing.T) {
 	}
 
 	wg := sync.WaitGroup{}
-	g := Group[int, string]{}
+	g := &Group[int, string]{}
 	ast := assert.New(t)
 	for i := 0; i < WorkerNum; i++ {
 		wg.Add(1)
@@ -67,7 +69,937 @@ func TestMultiflight(t *testing.T) {
 	}
 
 	wg.Wait()
-	ast.Equal(0, len(g.m))
+	ast.Equal(0, g.Len())
 	t.Logf("load times: %d", stats.total)
 	t.Log(stats.timesByBatchSize)
 }
+
+func TestMaxInFlightKeys(t *testing.T) {
+	release := make(chan struct{})
+	var calls int32
+	loader := func(ctx context.Context, keys []int) (map[int]string, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		resuts := make(map[int]string, len(keys))
+		for _, k := range keys {
+			resuts[k] = fmt.Sprintf("val: %d", k)
+		}
+		return resuts, nil
+	}
+
+	ast := assert.New(t)
+	g := NewGroup(WithMaxInFlightKeys[int, string](4))
+
+	wg := sync.WaitGroup{}
+	do := func(keys ...int) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results, err := g.Do(context.Background(), keys, loader)
+			ast.Nil(err)
+			ast.Len(results, len(keys))
+		}()
+	}
+
+	do(1, 2, 3)
+	ast.Eventually(func() bool { return atomic.LoadInt32(&calls) == 1 }, time.Second, time.Millisecond)
+
+	// joining in-flight keys doesn't count against the cap
+	do(1, 2, 3)
+	// 2 new keys would exceed the cap, so this one blocks
+	do(3, 4, 5)
+	time.Sleep(time.Millisecond * 20)
+	ast.Equal(int32(1), atomic.LoadInt32(&calls))
+
+	// a blocked caller gives up with its context
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+	defer cancel()
+	_, err := g.Do(ctx, []int{6, 7}, loader)
+	ast.ErrorIs(err, context.DeadlineExceeded)
+
+	close(release)
+	wg.Wait()
+	ast.Equal(int32(2), atomic.LoadInt32(&calls))
+	ast.Equal(0, g.Len())
+}
+
+func TestFailOverCapacity(t *testing.T) {
+	release := make(chan struct{})
+	loader := func(ctx context.Context, keys []int) (map[int]string, error) {
+		<-release
+		return map[int]string{}, nil
+	}
+
+	ast := assert.New(t)
+	g := NewGroup(
+		WithMaxInFlightKeys[int, string](2),
+		WithFailOverCapacity[int, string](),
+	)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, err := g.Do(context.Background(), []int{1, 2}, loader)
+		ast.Nil(err)
+	}()
+	ast.Eventually(func() bool { return g.Len() == 2 }, time.Second, time.Millisecond)
+
+	_, err := g.Do(context.Background(), []int{2, 3}, loader)
+	ast.ErrorIs(err, ErrOverCapacity)
+
+	close(release)
+	<-done
+}
+
+func TestDoRefresh(t *testing.T) {
+	const WorkerNum = 10
+
+	release := make(chan struct{})
+	var calls int32
+	loader := func(ctx context.Context, keys []int) (map[int]string, error) {
+		atomic.AddInt32(&calls, 1)
+		<-release
+		resuts := make(map[int]string, len(keys))
+		for _, k := range keys {
+			resuts[k] = fmt.Sprintf("val: %d", k)
+		}
+		return resuts, nil
+	}
+
+	ast := assert.New(t)
+	g := NewGroup[int, string]()
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < WorkerNum; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results, err := g.DoRefresh(context.Background(), []int{1, 2}, loader)
+			ast.Nil(err)
+			ast.Equal(map[int]string{1: "val: 1", 2: "val: 2"}, results)
+		}()
+	}
+
+	ast.Eventually(func() bool { return g.Stats().Waiters == WorkerNum*2 }, time.Second, time.Millisecond)
+	close(release)
+	wg.Wait()
+	ast.Equal(int32(1), atomic.LoadInt32(&calls))
+}
+
+func TestForceRefresh(t *testing.T) {
+	blocking := func(version string, release chan struct{}) Loader[int, string] {
+		return func(ctx context.Context, keys []int) (map[int]string, error) {
+			<-release
+			return map[int]string{1: version}, nil
+		}
+	}
+	oldRelease, newRelease := make(chan struct{}), make(chan struct{})
+	oldLoader, newLoader := blocking("old", oldRelease), blocking("new", newRelease)
+
+	ast := assert.New(t)
+	g := NewGroup(WithTTL[int, string](time.Minute))
+	g.Set(1, "cached")
+
+	type res struct {
+		vals map[int]string
+		err  error
+	}
+	do := func(f func(context.Context, []int, Loader[int, string], ...CallOption) (map[int]string, error), load Loader[int, string]) chan res {
+		ch := make(chan res, 1)
+		go func() {
+			vals, err := f(context.Background(), []int{1}, load)
+			ch <- res{vals, err}
+		}()
+		return ch
+	}
+
+	// an older load in flight, with a follower
+	old := do(g.DoRefresh, oldLoader)
+	ast.Eventually(func() bool { return g.Len() == 1 }, time.Second, time.Millisecond)
+	oldFollower := do(g.DoRefresh, oldLoader)
+	ast.Eventually(func() bool { return g.Stats().Waiters == 2 }, time.Second, time.Millisecond)
+
+	// ForceRefresh loads afresh, and later callers join it
+	forced := do(g.ForceRefresh, newLoader)
+	ast.Eventually(func() bool { return g.Stats().Waiters == 3 }, time.Second, time.Millisecond)
+	follower := do(g.DoRefresh, oldLoader)
+	ast.Eventually(func() bool { return g.Stats().Waiters == 4 }, time.Second, time.Millisecond)
+
+	// its result wins in the cache even when the older load completes last
+	close(newRelease)
+	ast.Equal(res{vals: map[int]string{1: "new"}}, <-forced)
+	ast.Equal(res{vals: map[int]string{1: "new"}}, <-follower)
+	close(oldRelease)
+	ast.Equal(res{vals: map[int]string{1: "old"}}, <-old)
+	ast.Equal(res{vals: map[int]string{1: "old"}}, <-oldFollower)
+	ast.Equal(0, g.Len())
+	vals, _ := g.TryDo(context.Background(), []int{1})
+	ast.Equal(map[int]string{1: "new"}, vals)
+}
+
+func TestNoCacheNoShare(t *testing.T) {
+	var version, loaded int32
+	loader := countingLoader(&version, &loaded)
+	release := make(chan struct{})
+	blocking := func(ctx context.Context, keys []int) (map[int]string, error) {
+		<-release
+		return loader(ctx, keys)
+	}
+
+	ast := assert.New(t)
+	g := NewGroup(WithTTL[int, string](time.Minute))
+	g.Set(1, "cached")
+	do := func(opts ...CallOption) map[int]string {
+		results, err := g.Do(context.Background(), []int{1}, loader, opts...)
+		ast.Nil(err)
+		return results
+	}
+
+	// a load of 1 in flight
+	errs := make(chan error, 2)
+	go func() {
+		_, err := g.DoRefresh(context.Background(), []int{1}, blocking)
+		errs <- err
+	}()
+	ast.Eventually(func() bool { return g.Len() == 1 }, time.Second, time.Millisecond)
+
+	// WithNoShare alone still reads the cache
+	ast.Equal(map[int]string{1: "cached"}, do(WithNoShare()))
+	ast.Equal(int32(0), atomic.LoadInt32(&loaded))
+
+	// WithNoCache alone joins the load in flight
+	go func() {
+		_, err := g.Do(context.Background(), []int{1}, loader, WithNoCache())
+		errs <- err
+	}()
+	ast.Eventually(func() bool { return g.Stats().Waiters == 2 }, time.Second, time.Millisecond)
+	ast.Equal(int32(0), atomic.LoadInt32(&loaded))
+
+	// together they load right away, and their result wins in the cache
+	atomic.StoreInt32(&version, 1)
+	ast.Equal(map[int]string{1: "val: 1 v1"}, do(WithNoCache(), WithNoShare()))
+	ast.Equal(int32(1), atomic.LoadInt32(&loaded))
+	atomic.StoreInt32(&version, 2)
+	close(release)
+	ast.Nil(<-errs)
+	ast.Nil(<-errs)
+	ast.Equal(map[int]string{1: "val: 1 v1"}, do())
+
+	// WithNoCache writes back what it loads
+	atomic.StoreInt32(&version, 3)
+	ast.Equal(map[int]string{1: "val: 1 v3"}, do(WithNoCache()))
+	ast.Equal(map[int]string{1: "val: 1 v3"}, do())
+	ast.Equal(int32(3), atomic.LoadInt32(&loaded))
+}
+
+func TestMaxWaitersPerKey(t *testing.T) {
+	release := make(chan struct{})
+	loader := func(ctx context.Context, keys []int) (map[int]string, error) {
+		<-release
+		resuts := make(map[int]string, len(keys))
+		for _, k := range keys {
+			resuts[k] = fmt.Sprintf("val: %d", k)
+		}
+		return resuts, nil
+	}
+
+	ast := assert.New(t)
+	g := NewGroup(WithMaxWaitersPerKey[int, string](2))
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results, err := g.Do(context.Background(), []int{1}, loader)
+			ast.Nil(err)
+			ast.Equal(map[int]string{1: "val: 1"}, results)
+		}()
+	}
+	ast.Eventually(func() bool { return g.Stats().Waiters == 2 }, time.Second, time.Millisecond)
+	ast.Equal(int64(2), g.Stats().MaxKeyWaiters)
+
+	go func() {
+		time.Sleep(time.Millisecond * 10)
+		close(release)
+	}()
+	results, err := g.Do(context.Background(), []int{1, 2}, loader)
+	ast.ErrorIs(err, ErrTooManyWaiters)
+	var keysErr *KeysError[int]
+	ast.ErrorAs(err, &keysErr)
+	ast.Equal([]int{1}, keysErr.Keys)
+	ast.Equal(map[int]string{2: "val: 2"}, results)
+
+	wg.Wait()
+	stats := g.Stats()
+	ast.Equal(int64(0), stats.Waiters)
+	ast.Equal(uint64(1), stats.RejectedWaiters)
+}
+
+func TestMaxBatchSize(t *testing.T) {
+	var mu sync.Mutex
+	var sizes []int
+	loader := func(ctx context.Context, keys []int) (map[int]string, error) {
+		mu.Lock()
+		sizes = append(sizes, len(keys))
+		mu.Unlock()
+		resuts := make(map[int]string, len(keys))
+		for _, k := range keys {
+			resuts[k] = fmt.Sprintf("val: %d", k)
+		}
+		return resuts, nil
+	}
+
+	ast := assert.New(t)
+	g := NewGroup(WithMaxBatchSize[int, string](3))
+	results, err := g.Do(context.Background(), []int{1, 2, 3, 4, 5, 6, 7}, loader)
+	ast.Nil(err)
+	ast.Len(results, 7)
+	ast.ElementsMatch([]int{3, 3, 1}, sizes)
+	ast.Equal(0, g.Len())
+}
+
+func TestPartialOnError(t *testing.T) {
+	errPartial := errors.New("partial failure")
+	loader := func(ctx context.Context, keys []int) (map[int]string, error) {
+		return map[int]string{1: "val: 1", 2: "val: 2"}, errPartial
+	}
+
+	ast := assert.New(t)
+
+	// by default the error fails every key
+	g := NewGroup[int, string]()
+	results, err := g.Do(context.Background(), []int{1, 2}, loader)
+	ast.ErrorIs(err, errPartial)
+	ast.Nil(results)
+
+	g = NewGroup(WithPartialOnError[int, string]())
+	results, err = g.Do(context.Background(), []int{1, 2}, loader)
+	ast.Nil(err)
+	ast.Equal(map[int]string{1: "val: 1", 2: "val: 2"}, results)
+
+	// keys missing from the partial result get the error
+	results, err = g.Do(context.Background(), []int{1, 2, 3}, loader)
+	ast.ErrorIs(err, errPartial)
+	ast.Nil(results)
+	ast.Equal(0, g.Len())
+}
+
+func TestAcceptExtraKeys(t *testing.T) {
+	var loaded int32
+	release := make(chan struct{})
+	// a parent key pulls its children along
+	loader := func(ctx context.Context, keys []int) (map[int]string, error) {
+		atomic.AddInt32(&loaded, int32(len(keys)))
+		if keys[0] != 1 {
+			<-release
+		}
+		results := map[int]string{}
+		for _, k := range keys {
+			results[k] = fmt.Sprintf("val: %d", k)
+			results[k*10] = fmt.Sprintf("child: %d", k*10)
+		}
+		return results, nil
+	}
+
+	ast := assert.New(t)
+
+	// by default extra keys are dropped
+	g := NewGroup(WithTTL[int, string](time.Minute))
+	results, err := g.Do(context.Background(), []int{1}, loader)
+	ast.Nil(err)
+	ast.Equal(map[int]string{1: "val: 1"}, results)
+	misses := []int{10}
+	_, misses = g.TryDo(context.Background(), misses)
+	ast.Equal([]int{10}, misses)
+
+	g = NewGroup(WithTTL[int, string](time.Minute), WithAcceptExtraKeys[int, string]())
+	errs := make(chan error, 2)
+	doChild := func() {
+		results, err := g.Do(context.Background(), []int{10}, loader)
+		ast.Equal(map[int]string{10: "child: 10"}, results)
+		errs <- err
+	}
+	go doChild()
+	ast.Eventually(func() bool { return g.Len() == 1 }, time.Second, time.Millisecond)
+	go doChild()
+	ast.Eventually(func() bool { return g.Stats().Waiters == 2 }, time.Second, time.Millisecond)
+
+	// the extra key completes the load in flight for its followers, and
+	// is cached
+	results, err = g.Do(context.Background(), []int{1}, loader)
+	ast.Nil(err)
+	ast.Equal(map[int]string{1: "val: 1"}, results)
+	ast.Nil(<-errs)
+	ast.Equal(0, g.Len())
+	results, misses = g.TryDo(context.Background(), []int{1, 10})
+	ast.Equal(map[int]string{1: "val: 1", 10: "child: 10"}, results)
+	ast.Empty(misses)
+
+	// the load completed early doesn't replace the extra value
+	close(release)
+	ast.Nil(<-errs)
+	results, _ = g.TryDo(context.Background(), []int{10, 100})
+	ast.Equal(map[int]string{10: "child: 10", 100: "child: 100"}, results)
+}
+
+func TestNotFoundFunc(t *testing.T) {
+	const tombstone = "deleted"
+	var loaded int32
+	loader := func(ctx context.Context, keys []int) (map[int]string, error) {
+		atomic.AddInt32(&loaded, int32(len(keys)))
+		resuts := make(map[int]string, len(keys))
+		for _, k := range keys {
+			resuts[k] = fmt.Sprintf("val: %d", k)
+			if k%2 == 1 {
+				resuts[k] = tombstone
+			}
+		}
+		return resuts, nil
+	}
+
+	ast := assert.New(t)
+	g := NewGroup(
+		WithTTL[int, string](time.Minute),
+		WithNegativeTTL[int, string](time.Minute),
+		WithNotFoundFunc(func(key int, val string) bool { return val == tombstone }),
+	)
+
+	// tombstones are left out like missing keys
+	results, err := g.Do(context.Background(), []int{1, 2, 3}, loader)
+	ast.Nil(err)
+	ast.Equal(map[int]string{2: "val: 2"}, results)
+
+	// and cached as not found rather than as values
+	results, err = g.Do(context.Background(), []int{1, 2, 3}, loader)
+	ast.Nil(err)
+	ast.Equal(map[int]string{2: "val: 2"}, results)
+	ast.Equal(int32(3), atomic.LoadInt32(&loaded))
+	ast.Len(g.Snapshot(), 1)
+}
+
+func TestMaxFollowerWait(t *testing.T) {
+	release := make(chan struct{})
+	loader := func(ctx context.Context, keys []int) (map[int]string, error) {
+		<-release
+		return map[int]string{1: "val: 1"}, nil
+	}
+
+	ast := assert.New(t)
+	g := NewGroup(WithMaxFollowerWait[int, string](time.Millisecond * 20))
+
+	leader := make(chan error, 1)
+	go func() {
+		_, err := g.Do(context.Background(), []int{1}, loader)
+		leader <- err
+	}()
+	ast.Eventually(func() bool { return g.Len() == 1 }, time.Second, time.Millisecond)
+
+	// the follower gives up, the leader keeps waiting for its own load
+	_, err := g.Do(context.Background(), []int{1}, loader)
+	ast.ErrorIs(err, ErrFollowerTimeout)
+	ast.Equal(1, g.Len())
+	close(release)
+	ast.Nil(<-leader)
+}
+
+func TestLoadTimeout(t *testing.T) {
+	var calls int32
+	loader := func(ctx context.Context, keys []int) (map[int]string, error) {
+		if atomic.AddInt32(&calls, 1) == 1 {
+			<-ctx.Done()
+			return nil, ctx.Err()
+		}
+		return map[int]string{1: "val: 1"}, nil
+	}
+
+	ast := assert.New(t)
+	g := NewGroup(WithLoadTimeout[int, string](time.Millisecond * 10))
+	_, err := g.Do(context.Background(), []int{1}, loader)
+	ast.ErrorIs(err, context.DeadlineExceeded)
+	ast.Equal(0, g.Len())
+
+	// every attempt gets its own timeout
+	atomic.StoreInt32(&calls, 0)
+	g = NewGroup(
+		WithLoadTimeout[int, string](time.Millisecond*10),
+		WithRetry[int, string](2, nil, nil),
+	)
+	results, err := g.Do(context.Background(), []int{1}, loader)
+	ast.Nil(err)
+	ast.Equal(map[int]string{1: "val: 1"}, results)
+	ast.Equal(int32(2), atomic.LoadInt32(&calls))
+
+	// a hung loader is given up on
+	hang := make(chan struct{})
+	defer close(hang)
+	g = NewGroup(
+		WithLoadTimeout[int, string](time.Millisecond*10),
+		WithTTL[int, string](time.Minute),
+	)
+	errs := make(chan error, 3)
+	for i := 0; i < 3; i++ {
+		go func() {
+			_, err := g.Do(context.Background(), []int{1}, func(ctx context.Context, keys []int) (map[int]string, error) {
+				<-hang
+				return map[int]string{1: "late"}, nil
+			})
+			errs <- err
+		}()
+	}
+	for i := 0; i < 3; i++ {
+		err := <-errs
+		ast.ErrorIs(err, ErrLoadTimeout)
+		ast.ErrorIs(err, context.DeadlineExceeded)
+	}
+	ast.Equal(0, g.Len())
+	ast.Equal(int64(0), g.Stats().Waiters)
+}
+
+func TestValueProcessor(t *testing.T) {
+	errInvalid := errors.New("invalid value")
+	var loaded int32
+	loader := func(ctx context.Context, keys []int) (map[int]string, error) {
+		atomic.AddInt32(&loaded, int32(len(keys)))
+		resuts := make(map[int]string, len(keys))
+		for _, k := range keys {
+			resuts[k] = fmt.Sprintf("val: %d", k)
+		}
+		return resuts, nil
+	}
+
+	ast := assert.New(t)
+	var processed int32
+	g := NewGroup(
+		WithTTL[int, string](time.Minute),
+		WithValueProcessor(func(ctx context.Context, key int, val string) (string, error) {
+			atomic.AddInt32(&processed, 1)
+			if key == 2 {
+				return "", errInvalid
+			}
+			return strings.ToUpper(val), nil
+		}),
+	)
+
+	results, err := g.Do(context.Background(), []int{1, 2, 3}, loader)
+	ast.ErrorIs(err, errInvalid)
+	ast.Nil(results)
+	ast.Equal(int32(3), atomic.LoadInt32(&processed))
+
+	// the other keys of the batch were not affected
+	results, err = g.Do(context.Background(), []int{1, 3}, loader)
+	ast.Nil(err)
+	ast.Equal(map[int]string{1: "VAL: 1", 3: "VAL: 3"}, results)
+	ast.Equal(int32(3), atomic.LoadInt32(&loaded))
+	ast.Equal(int32(3), atomic.LoadInt32(&processed))
+}
+
+func TestLen(t *testing.T) {
+	release := make(chan struct{})
+	loader := func(ctx context.Context, keys []int) (map[int]string, error) {
+		<-release
+		return map[int]string{}, nil
+	}
+
+	ast := assert.New(t)
+	g := NewGroup(WithMaxBatchSize[int, string](2))
+	ast.Equal(0, g.Len())
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, err := g.Do(context.Background(), []int{1, 2, 3, 4, 5}, loader)
+		ast.Nil(err)
+	}()
+	ast.Eventually(func() bool { return g.Len() == 5 }, time.Second, time.Millisecond)
+	ast.True(g.InFlight(1))
+	ast.True(g.InFlight(5))
+	ast.False(g.InFlight(6))
+
+	close(release)
+	<-done
+	ast.Equal(0, g.Len())
+	ast.False(g.InFlight(1))
+
+	// not found results kept for a while aren't in flight
+	g = NewGroup(WithNotFoundCoalesce[int, string](time.Minute))
+	_, err := g.Do(context.Background(), []int{1}, loader)
+	ast.Nil(err)
+	ast.Equal(1, g.Len())
+	ast.False(g.InFlight(1))
+}
+
+func TestDoCanceledContext(t *testing.T) {
+	var calls int32
+	loader := func(ctx context.Context, keys []int) (map[int]string, error) {
+		atomic.AddInt32(&calls, 1)
+		return map[int]string{}, nil
+	}
+
+	ast := assert.New(t)
+	g := NewGroup[int, string]()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	results, err := g.Do(ctx, []int{1, 2}, loader)
+	ast.ErrorIs(err, context.Canceled)
+	ast.Nil(results)
+
+	ctx, cancel = context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	results, err = g.Do(ctx, []int{1, 2}, loader)
+	ast.ErrorIs(err, context.DeadlineExceeded)
+	ast.Nil(results)
+
+	ast.Equal(int32(0), atomic.LoadInt32(&calls))
+	ast.Equal(0, g.Len())
+}
+
+func TestForget(t *testing.T) {
+	var version, loaded int32
+	loader := countingLoader(&version, &loaded)
+	release := make(chan struct{})
+	slow := func(ctx context.Context, keys []int) (map[int]string, error) {
+		<-release
+		return loader(ctx, keys)
+	}
+
+	ast := assert.New(t)
+	g := NewGroup(WithTTL[int, string](time.Minute))
+
+	_, err := g.Do(context.Background(), []int{1}, loader)
+	ast.Nil(err)
+	g.Forget(1)
+	atomic.StoreInt32(&version, 1)
+	results, err := g.Do(context.Background(), []int{1}, loader)
+	ast.Nil(err)
+	ast.Equal(map[int]string{1: "val: 1 v1"}, results)
+	ast.Equal(int32(2), atomic.LoadInt32(&loaded))
+
+	// a forgotten load still serves its callers but isn't shared or cached
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		results, err := g.Do(context.Background(), []int{2}, slow)
+		ast.Nil(err)
+		ast.Equal(map[int]string{2: "val: 2 v1"}, results)
+	}()
+	ast.Eventually(func() bool { return g.Len() == 1 }, time.Second, time.Millisecond)
+	g.Forget(2)
+	ast.Equal(0, g.Len())
+	close(release)
+	<-done
+
+	atomic.StoreInt32(&version, 2)
+	results, err = g.Do(context.Background(), []int{2}, loader)
+	ast.Nil(err)
+	ast.Equal(map[int]string{2: "val: 2 v2"}, results)
+	ast.Equal(int32(4), atomic.LoadInt32(&loaded))
+}
+
+func TestTryDo(t *testing.T) {
+	var version, loaded int32
+	loader := countingLoader(&version, &loaded)
+	release := make(chan struct{})
+	slow := func(ctx context.Context, keys []int) (map[int]string, error) {
+		<-release
+		return loader(ctx, keys)
+	}
+
+	ast := assert.New(t)
+	g := NewGroup(WithTTL[int, string](time.Minute))
+	_, err := g.Do(context.Background(), []int{1, 2}, loader)
+	ast.Nil(err)
+	g.MarkNotFound(3)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, err := g.Do(context.Background(), []int{4}, slow)
+		ast.Nil(err)
+	}()
+	ast.Eventually(func() bool { return g.Len() == 1 }, time.Second, time.Millisecond)
+
+	// cached, not found, in-flight and cold keys
+	results, misses := g.TryDo(context.Background(), []int{1, 2, 3, 4, 5})
+	ast.Equal(map[int]string{1: "val: 1 v0", 2: "val: 2 v0"}, results)
+	ast.Equal([]int{4, 5}, misses)
+	ast.Equal(int32(2), atomic.LoadInt32(&loaded))
+	ast.Equal(1, g.Len())
+
+	close(release)
+	<-done
+	results, misses = g.TryDo(context.Background(), []int{4, 5})
+	ast.Equal(map[int]string{4: "val: 4 v0"}, results)
+	ast.Equal([]int{5}, misses)
+	ast.Equal(int32(3), atomic.LoadInt32(&loaded))
+}
+
+func TestDoLeader(t *testing.T) {
+	var version, loaded int32
+	loader := countingLoader(&version, &loaded)
+	release := make(chan struct{})
+	slow := func(ctx context.Context, keys []int) (map[int]string, error) {
+		<-release
+		return loader(ctx, keys)
+	}
+
+	ast := assert.New(t)
+	g := NewGroup(WithTTL[int, string](time.Minute))
+	_, err := g.Do(context.Background(), []int{1}, loader)
+	ast.Nil(err)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_, leaders, err := g.DoLeader(context.Background(), []int{2}, slow)
+		ast.Nil(err)
+		ast.Equal([]int{2}, leaders)
+	}()
+	ast.Eventually(func() bool { return g.Len() == 1 }, time.Second, time.Millisecond)
+
+	// 1 is cached and 2 is shared, only 3 is loaded by this call
+	go func() {
+		ast.Eventually(func() bool { return g.Stats().Waiters == 3 }, time.Second, time.Millisecond)
+		close(release)
+	}()
+	results, leaders, err := g.DoLeader(context.Background(), []int{1, 2, 3}, slow)
+	ast.Nil(err)
+	ast.Equal([]int{3}, leaders)
+	ast.Len(results, 3)
+	<-done
+}
+
+func TestLateJoinerError(t *testing.T) {
+	errBoom := errors.New("boom")
+	joined := make(chan struct{})
+	loader := func(ctx context.Context, keys []int) (map[int]string, error) {
+		<-joined
+		return nil, fmt.Errorf("load %v: %w", keys, errBoom)
+	}
+
+	ast := assert.New(t)
+	g := NewGroup[int, string]()
+
+	errs := make(chan error, 2)
+	go func() {
+		_, err := g.Do(context.Background(), []int{1, 2}, loader)
+		errs <- err
+	}()
+	ast.Eventually(func() bool { return g.Len() == 2 }, time.Second, time.Millisecond)
+	go func() {
+		_, err := g.Do(context.Background(), []int{2, 1}, loader)
+		errs <- err
+	}()
+	ast.Eventually(func() bool { return g.Stats().Waiters == 4 }, time.Second, time.Millisecond)
+	close(joined)
+
+	// both callers see the error of the one load
+	err1, err2 := <-errs, <-errs
+	ast.ErrorIs(err1, errBoom)
+	ast.Same(err1, err2)
+	ast.Equal(0, g.Len())
+}
+
+func TestCancelStress(t *testing.T) {
+	const (
+		WorkerNum = 50
+		LoopTimes = 20
+	)
+
+	loader := func(ctx context.Context, keys []int) (map[int]string, error) {
+		// half of the loads ignore cancellation
+		d := time.Duration(rand.Intn(3)) * time.Millisecond
+		if keys[0]%2 == 0 {
+			time.Sleep(d)
+		} else {
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(d):
+			}
+		}
+		resuts := make(map[int]string, len(keys))
+		for _, k := range keys {
+			resuts[k] = fmt.Sprintf("val: %d", k)
+		}
+		return resuts, nil
+	}
+
+	ast := assert.New(t)
+	g := NewGroup[int, string]()
+	wg := sync.WaitGroup{}
+	for i := 0; i < WorkerNum; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < LoopTimes; j++ {
+				ctx, cancel := context.WithTimeout(context.Background(), time.Duration(rand.Intn(2000))*time.Microsecond)
+				from := rand.Intn(20)
+				results, err := g.Do(ctx, []int{from, from + 1, from + 2}, loader)
+				if err != nil {
+					ast.ErrorIs(err, context.DeadlineExceeded)
+				} else {
+					ast.Len(results, 3)
+				}
+				cancel()
+			}
+		}()
+	}
+	wg.Wait()
+
+	// every entry is completed and removed, waited for or not
+	ast.Eventually(func() bool { return g.Len() == 0 }, time.Second, time.Millisecond)
+	ast.Equal(int64(0), g.Stats().Waiters)
+}
+
+func TestForgetAll(t *testing.T) {
+	var version, loaded int32
+	loader := countingLoader(&version, &loaded)
+	release := make(chan struct{})
+	slow := func(ctx context.Context, keys []int) (map[int]string, error) {
+		<-release
+		return loader(ctx, keys)
+	}
+
+	ast := assert.New(t)
+	g := NewGroup(WithTTL[int, string](time.Minute))
+	_, err := g.Do(context.Background(), []int{1}, loader)
+	ast.Nil(err)
+
+	errs := make(chan error, 2)
+	go func() {
+		_, err := g.Do(context.Background(), []int{2, 3}, slow)
+		errs <- err
+	}()
+	ast.Eventually(func() bool { return g.Len() == 2 }, time.Second, time.Millisecond)
+	go func() {
+		_, err := g.Do(context.Background(), []int{3}, slow)
+		errs <- err
+	}()
+	ast.Eventually(func() bool { return g.Stats().Waiters == 3 }, time.Second, time.Millisecond)
+
+	// the caller waiting for the load is released right away
+	g.ForgetAll()
+	ast.ErrorIs(<-errs, ErrForgotten)
+	ast.Equal(0, g.Len())
+
+	// the forgotten load completes without caching its results
+	close(release)
+	ast.ErrorIs(<-errs, ErrForgotten)
+	_, misses := g.TryDo(context.Background(), []int{1, 2, 3})
+	ast.Equal([]int{1, 2, 3}, misses)
+
+	results, err := g.Do(context.Background(), []int{1, 2}, loader)
+	ast.Nil(err)
+	ast.Len(results, 2)
+	ast.Equal(int32(5), atomic.LoadInt32(&loaded))
+}
+
+func TestFailKey(t *testing.T) {
+	errDown := errors.New("down")
+	var version, loaded int32
+	loader := countingLoader(&version, &loaded)
+	release := make(chan struct{})
+	slow := func(ctx context.Context, keys []int) (map[int]string, error) {
+		<-release
+		return loader(ctx, keys)
+	}
+
+	ast := assert.New(t)
+	g := NewGroup(WithTTL[int, string](time.Minute))
+	errs := make(chan error, 2)
+	go func() {
+		_, err := g.Do(context.Background(), []int{1, 2}, slow)
+		errs <- err
+	}()
+	ast.Eventually(func() bool { return g.Len() == 2 }, time.Second, time.Millisecond)
+	go func() {
+		_, err := g.Do(context.Background(), []int{1}, slow)
+		errs <- err
+	}()
+	ast.Eventually(func() bool { return g.Stats().Waiters == 3 }, time.Second, time.Millisecond)
+
+	// FailKey first: the waiters are released and the load dropped
+	g.FailKey(errDown, 1, 1, 5)
+	ast.ErrorIs(<-errs, errDown)
+	ast.Equal(1, g.Len())
+	ast.False(g.InFlight(1))
+	close(release)
+	ast.ErrorIs(<-errs, errDown)
+	results, misses := g.TryDo(context.Background(), []int{1, 2})
+	ast.Equal(map[int]string{2: "val: 2 v0"}, results)
+	ast.Equal([]int{1}, misses)
+
+	// the load first: FailKey leaves the completed key alone
+	results, err := g.Do(context.Background(), []int{1}, loader)
+	ast.Nil(err)
+	ast.Equal(map[int]string{1: "val: 1 v0"}, results)
+	g.FailKey(errDown, 1)
+	results, misses = g.TryDo(context.Background(), []int{1})
+	ast.Equal(map[int]string{1: "val: 1 v0"}, results)
+	ast.Empty(misses)
+	ast.Equal(int32(3), atomic.LoadInt32(&loaded))
+
+	// a nil error fails the keys all the same
+	release = make(chan struct{})
+	go func() {
+		_, err := g.Do(context.Background(), []int{3}, slow)
+		errs <- err
+	}()
+	go func() {
+		ast.Eventually(func() bool { return g.Stats().Waiters == 1 }, time.Second, time.Millisecond)
+		_, err := g.Do(context.Background(), []int{3}, slow)
+		errs <- err
+	}()
+	ast.Eventually(func() bool { return g.Stats().Waiters == 2 }, time.Second, time.Millisecond)
+	g.FailKey(nil, 3)
+	ast.ErrorIs(<-errs, ErrKeyFailed)
+	close(release)
+	ast.ErrorIs(<-errs, ErrKeyFailed)
+}
+
+func TestFailKeyRace(t *testing.T) {
+	errDown := errors.New("down")
+	var version, loaded int32
+	loader := countingLoader(&version, &loaded)
+
+	ast := assert.New(t)
+	for i := 0; i < 100; i++ {
+		g := NewGroup(WithTTL[int, string](time.Minute))
+		start := make(chan struct{})
+		var wg sync.WaitGroup
+		errs := make([]error, 2)
+		results := make([]map[int]string, 2)
+		for i := range errs {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				<-start
+				results[i], errs[i] = g.Do(context.Background(), []int{1}, loader)
+			}(i)
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			<-start
+			g.FailKey(errDown, 1)
+		}()
+		close(start)
+		wg.Wait()
+
+		// whichever completes the key first, the callers get either its
+		// value or the error, and only the value is cached
+		cached, _ := g.TryDo(context.Background(), []int{1})
+		for i, err := range errs {
+			if err != nil {
+				ast.ErrorIs(err, errDown)
+				continue
+			}
+			ast.Equal(map[int]string{1: "val: 1 v0"}, results[i])
+		}
+		if len(cached) > 0 {
+			ast.Equal(map[int]string{1: "val: 1 v0"}, cached)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package multiflightotel
+
+import (
+	"context"
+	"time"
+
+	"github.com/ymcvalu/multiflight"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// GroupKey is the attribute naming the group of a metric.
+const GroupKey = attribute.Key("multiflight.group")
+
+// Option configures Instrument.
+type Option func(*config)
+
+type config struct {
+	provider metric.MeterProvider
+	attrs    []attribute.KeyValue
+}
+
+// WithMeterProvider makes Instrument create its instruments with p
+// rather than the global meter provider.
+func WithMeterProvider(p metric.MeterProvider) Option {
+	return func(c *config) {
+		c.provider = p
+	}
+}
+
+// WithAttributes adds attrs to every measurement.
+func WithAttributes(attrs ...attribute.KeyValue) Option {
+	return func(c *config) {
+		c.attrs = append(c.attrs, attrs...)
+	}
+}
+
+// Instrument measures the loads of g with OpenTelemetry instruments:
+//
+//   - multiflight.loads, a counter of the loader calls, with their
+//     outcome, "ok" or "error";
+//   - multiflight.batch.size, a histogram of the keys of the loader calls;
+//   - multiflight.load.duration, a histogram of the loader latency, in
+//     seconds;
+//   - multiflight.in_flight_keys, an up-down counter of the keys being
+//     loaded.
+//
+// Every measurement has a multiflight.group attribute set to name. The
+// instruments are fed through g.AddObserver, alongside the other
+// observers of g, e.g. the Prometheus collector of multiflightprom.
+func Instrument[K comparable, V any](g *multiflight.Group[K, V], name string, opts ...Option) error {
+	c := config{provider: otel.GetMeterProvider()}
+	for _, opt := range opts {
+		opt(&c)
+	}
+	attrs := append([]attribute.KeyValue{GroupKey.String(name)}, c.attrs...)
+	meter := c.provider.Meter("github.com/ymcvalu/multiflight/multiflightotel")
+
+	loads, err := meter.Int64Counter("multiflight.loads",
+		metric.WithDescription("Loader calls, retries and hedges included."))
+	if err != nil {
+		return err
+	}
+	sizes, err := meter.Int64Histogram("multiflight.batch.size",
+		metric.WithDescription("Keys of the loader calls."))
+	if err != nil {
+		return err
+	}
+	latency, err := meter.Float64Histogram("multiflight.load.duration",
+		metric.WithDescription("Latency of the loader calls."), metric.WithUnit("s"))
+	if err != nil {
+		return err
+	}
+	set := attribute.NewSet(attrs...)
+	_, err = meter.Int64ObservableUpDownCounter("multiflight.in_flight_keys",
+		metric.WithDescription("Keys being loaded."),
+		metric.WithInt64Callback(func(ctx context.Context, o metric.Int64Observer) error {
+			o.Observe(int64(g.Len()), metric.WithAttributeSet(set))
+			return nil
+		}))
+	if err != nil {
+		return err
+	}
+
+	g.AddObserver(&meterObserver{
+		loads:   loads,
+		sizes:   sizes,
+		latency: latency,
+		attrs:   set,
+		ok:      withOutcome(attrs, "ok"),
+		failed:  withOutcome(attrs, "error"),
+	})
+	return nil
+}
+
+// withOutcome is the attributes of the loads with outcome.
+func withOutcome(attrs []attribute.KeyValue, outcome string) metric.MeasurementOption {
+	attrs = append(attrs[:len(attrs):len(attrs)], OutcomeKey.String(outcome))
+	return metric.WithAttributeSet(attribute.NewSet(attrs...))
+}
+
+// meterObserver records the loads in OpenTelemetry instruments.
+type meterObserver struct {
+	loads   metric.Int64Counter
+	sizes   metric.Int64Histogram
+	latency metric.Float64Histogram
+
+	attrs      attribute.Set
+	ok, failed metric.MeasurementOption // attrs with the outcome
+}
+
+func (o *meterObserver) OnBatch(size int) {
+	o.sizes.Record(context.Background(), int64(size), metric.WithAttributeSet(o.attrs))
+}
+
+func (o *meterObserver) OnLoad(size int, latency time.Duration, err error) {
+	ctx := context.Background()
+	o.latency.Record(ctx, latency.Seconds(), metric.WithAttributeSet(o.attrs))
+	if err != nil {
+		o.loads.Add(ctx, 1, o.failed)
+	} else {
+		o.loads.Add(ctx, 1, o.ok)
+	}
+}
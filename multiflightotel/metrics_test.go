@@ -0,0 +1,108 @@
+package multiflightotel
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ymcvalu/multiflight"
+	"go.opentelemetry.io/otel/attribute"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+)
+
+// countingObserver counts the loader calls.
+type countingObserver struct {
+	multiflight.NopObserver
+	loads int32
+}
+
+func (o *countingObserver) OnLoad(size int, latency time.Duration, err error) {
+	atomic.AddInt32(&o.loads, 1)
+}
+
+func TestInstrument(t *testing.T) {
+	errBoom := errors.New("boom")
+	release := make(chan struct{})
+	loader := func(ctx context.Context, keys []int) (map[int]string, error) {
+		if keys[0] == 3 {
+			<-release
+			return nil, errBoom
+		}
+		return map[int]string{1: "1", 2: "2"}, nil
+	}
+
+	ast := assert.New(t)
+	reader := sdkmetric.NewManualReader()
+	g := multiflight.NewGroup[int, string]()
+	counting := &countingObserver{}
+	g.AddObserver(counting)
+	ast.NoError(Instrument(g, "users",
+		WithMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader))),
+		WithAttributes(attribute.String("env", "test"))))
+
+	_, err := g.Do(context.Background(), []int{1, 2}, loader)
+	ast.Nil(err)
+	failed := make(chan error)
+	go func() {
+		_, err := g.Do(context.Background(), []int{3}, loader)
+		failed <- err
+	}()
+	ast.Eventually(func() bool { return g.Len() == 1 }, time.Second, time.Millisecond)
+	metrics := collect(t, reader)
+	close(release)
+	ast.ErrorIs(<-failed, errBoom)
+
+	group := []attribute.KeyValue{GroupKey.String("users"), attribute.String("env", "test")}
+	set := func(kvs ...attribute.KeyValue) attribute.Set {
+		return attribute.NewSet(append(append([]attribute.KeyValue(nil), group...), kvs...)...)
+	}
+	inFlight := metrics["multiflight.in_flight_keys"].(metricdata.Sum[int64])
+	ast.False(inFlight.IsMonotonic)
+	ast.Equal([]metricdata.DataPoint[int64]{{Attributes: set(), Value: 1}}, stripTimes(inFlight.DataPoints))
+
+	metrics = collect(t, reader)
+	loads := metrics["multiflight.loads"].(metricdata.Sum[int64])
+	ast.ElementsMatch([]metricdata.DataPoint[int64]{
+		{Attributes: set(OutcomeKey.String("ok")), Value: 1},
+		{Attributes: set(OutcomeKey.String("error")), Value: 1},
+	}, stripTimes(loads.DataPoints))
+	sizes := metrics["multiflight.batch.size"].(metricdata.Histogram[int64]).DataPoints
+	if ast.Len(sizes, 1) {
+		ast.Equal(set(), sizes[0].Attributes)
+		ast.Equal(uint64(2), sizes[0].Count)
+		ast.Equal(int64(3), sizes[0].Sum)
+	}
+	latency := metrics["multiflight.load.duration"].(metricdata.Histogram[float64]).DataPoints
+	if ast.Len(latency, 1) {
+		ast.Equal(uint64(2), latency[0].Count)
+	}
+	inFlight = metrics["multiflight.in_flight_keys"].(metricdata.Sum[int64])
+	ast.Equal(int64(0), inFlight.DataPoints[0].Value)
+
+	// the other observers of the group are still notified
+	ast.Equal(int32(2), atomic.LoadInt32(&counting.loads))
+}
+
+// collect returns the data of the metrics reader has by name.
+func collect(t *testing.T, reader sdkmetric.Reader) map[string]metricdata.Aggregation {
+	var rm metricdata.ResourceMetrics
+	assert.NoError(t, reader.Collect(context.Background(), &rm))
+	metrics := map[string]metricdata.Aggregation{}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			metrics[m.Name] = m.Data
+		}
+	}
+	return metrics
+}
+
+func stripTimes(points []metricdata.DataPoint[int64]) []metricdata.DataPoint[int64] {
+	for i := range points {
+		points[i].StartTime, points[i].Time = time.Time{}, time.Time{}
+	}
+	return points
+}
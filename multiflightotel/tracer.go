@@ -0,0 +1,66 @@
+// Package multiflightotel traces and measures the loads of multiflight
+// groups with OpenTelemetry.
+package multiflightotel
+
+import (
+	"context"
+	"time"
+
+	"github.com/ymcvalu/multiflight"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Attributes of the spans.
+const (
+	KeysKey    = attribute.Key("multiflight.keys")
+	ChunkKey   = attribute.Key("multiflight.chunk")
+	OutcomeKey = attribute.Key("multiflight.outcome")
+	LoadsKey   = attribute.Key("multiflight.loads")
+)
+
+// tracer traces with OpenTelemetry spans.
+type tracer struct {
+	tracer trace.Tracer
+}
+
+// Tracer returns a multiflight.Tracer starting spans with t, to pass to
+// multiflight.WithTracer:
+//
+//   - a "multiflight.load" span around every loader call, with the
+//     number of its keys, the index of its chunk and its outcome, "ok"
+//     or "error";
+//   - a "multiflight.wait" span for the time a call waited for keys
+//     loaded by other callers, with the number of these keys and links
+//     to the spans of their loads.
+func Tracer(t trace.Tracer) multiflight.Tracer {
+	return &tracer{tracer: t}
+}
+
+func (t *tracer) StartLoad(ctx context.Context, keys, chunk int) (context.Context, func(err error)) {
+	ctx, span := t.tracer.Start(ctx, "multiflight.load",
+		trace.WithAttributes(KeysKey.Int(keys), ChunkKey.Int(chunk)))
+	return ctx, func(err error) {
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+			span.SetAttributes(OutcomeKey.String("error"))
+		} else {
+			span.SetAttributes(OutcomeKey.String("ok"))
+		}
+		span.End()
+	}
+}
+
+func (t *tracer) Waited(ctx context.Context, start time.Time, keys int, loads []context.Context) {
+	links := make([]trace.Link, 0, len(loads))
+	for _, load := range loads {
+		links = append(links, trace.LinkFromContext(load))
+	}
+	_, span := t.tracer.Start(ctx, "multiflight.wait",
+		trace.WithTimestamp(start),
+		trace.WithLinks(links...),
+		trace.WithAttributes(KeysKey.Int(keys), LoadsKey.Int(len(loads))))
+	span.End()
+}
@@ -0,0 +1,91 @@
+package multiflightotel
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/ymcvalu/multiflight"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestTracer(t *testing.T) {
+	errBoom := errors.New("boom")
+	release := make(chan struct{})
+	loader := func(ctx context.Context, keys []int) (map[int]string, error) {
+		<-release
+		if keys[0] == 3 {
+			return nil, errBoom
+		}
+		vals := make(map[int]string, len(keys))
+		for _, k := range keys {
+			vals[k] = "v"
+		}
+		return vals, nil
+	}
+
+	ast := assert.New(t)
+	recorder := tracetest.NewSpanRecorder()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+	tr := tp.Tracer("test")
+	g := multiflight.NewGroup(
+		multiflight.WithTracer[int, string](Tracer(tr)),
+		multiflight.WithMaxBatchSize[int, string](2),
+	)
+
+	leaderCtx, leaderSpan := tr.Start(context.Background(), "leader")
+	leader := make(chan error)
+	go func() {
+		_, err := g.Do(leaderCtx, []int{1, 2, 3}, loader)
+		leader <- err
+	}()
+	ast.Eventually(func() bool { return g.Len() == 3 }, time.Second, time.Millisecond)
+	followerCtx, followerSpan := tr.Start(context.Background(), "follower")
+	follower := make(chan error)
+	go func() {
+		_, err := g.Do(followerCtx, []int{1, 2}, loader)
+		follower <- err
+	}()
+	ast.Eventually(func() bool { return g.Stats().Waiters == 5 }, time.Second, time.Millisecond)
+	close(release)
+	ast.ErrorIs(<-leader, errBoom)
+	ast.Nil(<-follower)
+	leaderSpan.End()
+	followerSpan.End()
+
+	spans := map[string][]sdktrace.ReadOnlySpan{}
+	for _, s := range recorder.Ended() {
+		spans[s.Name()] = append(spans[s.Name()], s)
+	}
+	ast.Len(spans["multiflight.load"], 2)
+	ast.Len(spans["multiflight.wait"], 1)
+
+	// the loads are children of the leader, with their keys, chunk and
+	// outcome
+	loads := map[int64]sdktrace.ReadOnlySpan{}
+	for _, s := range spans["multiflight.load"] {
+		ast.Equal(leaderSpan.SpanContext().SpanID(), s.Parent().SpanID())
+		attrs := attribute.NewSet(s.Attributes()...)
+		chunk, _ := attrs.Value(ChunkKey)
+		loads[chunk.AsInt64()] = s
+	}
+	first, second := loads[0], loads[1]
+	ast.ElementsMatch([]attribute.KeyValue{KeysKey.Int(2), ChunkKey.Int(0), OutcomeKey.String("ok")}, first.Attributes())
+	ast.Equal(codes.Unset, first.Status().Code)
+	ast.ElementsMatch([]attribute.KeyValue{KeysKey.Int(1), ChunkKey.Int(1), OutcomeKey.String("error")}, second.Attributes())
+	ast.Equal(codes.Error, second.Status().Code)
+
+	// the follower waited for the first load of the leader
+	wait := spans["multiflight.wait"][0]
+	ast.Equal(followerSpan.SpanContext().SpanID(), wait.Parent().SpanID())
+	ast.ElementsMatch([]attribute.KeyValue{KeysKey.Int(2), LoadsKey.Int(1)}, wait.Attributes())
+	if ast.Len(wait.Links(), 1) {
+		ast.Equal(first.SpanContext(), wait.Links()[0].SpanContext)
+	}
+	ast.False(wait.StartTime().After(first.EndTime()))
+}
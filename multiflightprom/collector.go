@@ -0,0 +1,98 @@
+// Package multiflightprom exports the metrics of multiflight groups to
+// Prometheus.
+package multiflightprom
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/ymcvalu/multiflight"
+)
+
+// LatencyBuckets are the buckets of the loader latency histogram, in
+// seconds.
+var LatencyBuckets = prometheus.ExponentialBuckets(0.001, 2, 14)
+
+// collector exports the metrics of a group.
+type collector struct {
+	stats    func() multiflight.Stats
+	inFlight func() int
+
+	loads   *prometheus.Desc
+	hits    *prometheus.Desc
+	misses  *prometheus.Desc
+	shared  *prometheus.Desc
+	errors  *prometheus.Desc
+	keys    *prometheus.Desc
+	latency prometheus.Histogram
+}
+
+// Collector returns a collector of the metrics of g: counters of loader
+// calls, cache hits and misses, keys sharing loads in flight and keys
+// that failed, a histogram of the loader latency and a gauge of the keys
+// in flight. Every metric has a group label set to name, so collectors
+// of groups with different names can be registered together.
+//
+// The latency is observed from the first loader call after Collector
+// returns, the counters cover the whole life of g.
+func Collector[K comparable, V any](g *multiflight.Group[K, V], name string) prometheus.Collector {
+	labels := prometheus.Labels{"group": name}
+	desc := func(metric, help string) *prometheus.Desc {
+		return prometheus.NewDesc(prometheus.BuildFQName("multiflight", "", metric), help, nil, labels)
+	}
+	c := &collector{
+		stats:    g.Stats,
+		inFlight: g.Len,
+		loads:    desc("loads_total", "Loader calls, retries and hedges included."),
+		hits:     desc("cache_hits_total", "Keys served from the caches."),
+		misses:   desc("cache_misses_total", "Keys served neither from the caches nor from loads in flight."),
+		shared:   desc("shared_keys_total", "Keys that joined loads in flight."),
+		errors:   desc("errors_total", "Keys that failed to load."),
+		keys:     desc("in_flight_keys", "Keys being loaded."),
+		latency: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace:   "multiflight",
+			Name:        "load_duration_seconds",
+			Help:        "Latency of the loader calls.",
+			Buckets:     LatencyBuckets,
+			ConstLabels: labels,
+		}),
+	}
+	g.AddObserver(latencyObserver{latency: c.latency})
+	return c
+}
+
+// Describe implements prometheus.Collector.
+func (c *collector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.loads
+	ch <- c.hits
+	ch <- c.misses
+	ch <- c.shared
+	ch <- c.errors
+	ch <- c.keys
+	c.latency.Describe(ch)
+}
+
+// Collect implements prometheus.Collector.
+func (c *collector) Collect(ch chan<- prometheus.Metric) {
+	s := c.stats()
+	counter := func(desc *prometheus.Desc, v uint64) {
+		ch <- prometheus.MustNewConstMetric(desc, prometheus.CounterValue, float64(v))
+	}
+	counter(c.loads, s.Loads)
+	counter(c.hits, s.CacheHits)
+	counter(c.misses, s.CacheMisses)
+	counter(c.shared, s.SharedKeys)
+	counter(c.errors, s.Errors)
+	ch <- prometheus.MustNewConstMetric(c.keys, prometheus.GaugeValue, float64(c.inFlight()))
+	c.latency.Collect(ch)
+}
+
+// latencyObserver observes the loader latency.
+type latencyObserver struct {
+	multiflight.NopObserver
+	latency prometheus.Histogram
+}
+
+func (o latencyObserver) OnLoad(size int, latency time.Duration, err error) {
+	o.latency.Observe(latency.Seconds())
+}
@@ -0,0 +1,65 @@
+package multiflightprom
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	"github.com/ymcvalu/multiflight"
+)
+
+func TestCollector(t *testing.T) {
+	errBoom := errors.New("boom")
+	loader := func(ctx context.Context, keys []int) (map[int]string, error) {
+		if keys[0] == 0 {
+			return nil, errBoom
+		}
+		return map[int]string{keys[0]: "val"}, nil
+	}
+
+	ast := assert.New(t)
+	users := multiflight.NewGroup(multiflight.WithTTL[int, string](time.Minute))
+	orders := multiflight.NewGroup[int, string]()
+	reg := prometheus.NewPedanticRegistry()
+	ast.Nil(reg.Register(Collector(users, "users")))
+	ast.Nil(reg.Register(Collector(orders, "orders")))
+
+	for i := 0; i < 2; i++ {
+		_, err := users.Do(context.Background(), []int{1}, loader)
+		ast.Nil(err)
+	}
+	_, err := orders.Do(context.Background(), []int{0}, loader)
+	ast.ErrorIs(err, errBoom)
+
+	expected := `
+# HELP multiflight_cache_hits_total Keys served from the caches.
+# TYPE multiflight_cache_hits_total counter
+multiflight_cache_hits_total{group="orders"} 0
+multiflight_cache_hits_total{group="users"} 1
+# HELP multiflight_cache_misses_total Keys served neither from the caches nor from loads in flight.
+# TYPE multiflight_cache_misses_total counter
+multiflight_cache_misses_total{group="orders"} 1
+multiflight_cache_misses_total{group="users"} 1
+# HELP multiflight_errors_total Keys that failed to load.
+# TYPE multiflight_errors_total counter
+multiflight_errors_total{group="orders"} 1
+multiflight_errors_total{group="users"} 0
+# HELP multiflight_in_flight_keys Keys being loaded.
+# TYPE multiflight_in_flight_keys gauge
+multiflight_in_flight_keys{group="orders"} 0
+multiflight_in_flight_keys{group="users"} 0
+# HELP multiflight_loads_total Loader calls, retries and hedges included.
+# TYPE multiflight_loads_total counter
+multiflight_loads_total{group="orders"} 1
+multiflight_loads_total{group="users"} 1
+`
+	ast.Nil(testutil.GatherAndCompare(reg, strings.NewReader(expected),
+		"multiflight_cache_hits_total", "multiflight_cache_misses_total", "multiflight_errors_total",
+		"multiflight_in_flight_keys", "multiflight_loads_total"))
+	ast.Equal(2, testutil.CollectAndCount(reg, "multiflight_load_duration_seconds"))
+}
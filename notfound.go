@@ -0,0 +1,49 @@
+package multiflight
+
+import "time"
+
+// WithNotFoundCoalesce keeps the entries of keys loaded and not found
+// among the keys being loaded for d, so that callers asking for them
+// meanwhile get the same not found result instead of loading them
+// again, e.g. to absorb a burst of calls for a key that doesn't exist,
+// even without a result cache. Until swept, these entries count as keys
+// being loaded, for Len and WithMaxInFlightKeys among others. DoRefresh,
+// Set, Invalidate and Forget drop them.
+func WithNotFoundCoalesce[K comparable, V any](d time.Duration) Option[K, V] {
+	return func(o *options[K, V]) {
+		o.notFoundCoalesce = d
+	}
+}
+
+// linger keeps the not found entry e registered for the not found
+// coalesce window. Must be called with g.mu held.
+func (g *Group[K, V]) linger(e *ent[K, V]) {
+	time.AfterFunc(g.opts.notFoundCoalesce, func() {
+		g.withLock(func() {
+			g.remove(e)
+			g.releaseCapacity()
+		})
+	})
+}
+
+// lingering reports whether e is a not found entry kept registered by
+// WithNotFoundCoalesce rather than a load in flight. Must be called
+// with g.mu held.
+func (e *ent[K, V]) lingering() bool {
+	return e.completed
+}
+
+// dropNotFound drops the lingering not found entries of keys.
+func (g *Group[K, V]) dropNotFound(keys []K) {
+	if g.opts.notFoundCoalesce <= 0 {
+		return
+	}
+	g.withLock(func() {
+		for _, key := range keys {
+			if e, has := g.m[key]; has && e.lingering() {
+				g.remove(e)
+			}
+		}
+		g.releaseCapacity()
+	})
+}
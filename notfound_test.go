@@ -0,0 +1,60 @@
+package multiflight
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNotFoundCoalesce(t *testing.T) {
+	var loads int32
+	loader := func(ctx context.Context, keys []int) (map[int]string, error) {
+		atomic.AddInt32(&loads, 1)
+		time.Sleep(time.Millisecond)
+		return nil, nil
+	}
+
+	ast := assert.New(t)
+	g := NewGroup(WithNotFoundCoalesce[int, string](time.Hour))
+
+	// a burst of calls for a missing key loads it once
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			vals, err := g.Do(context.Background(), []int{1}, loader)
+			ast.Nil(err)
+			ast.Empty(vals)
+		}()
+		if i%10 == 0 {
+			time.Sleep(time.Millisecond)
+		}
+	}
+	wg.Wait()
+	ast.Equal(int32(1), atomic.LoadInt32(&loads))
+	ast.Equal(1, g.Len())
+
+	// refreshes and sets drop the not found result
+	_, err := g.DoRefresh(context.Background(), []int{1}, loader)
+	ast.Nil(err)
+	ast.Equal(int32(2), atomic.LoadInt32(&loads))
+	g.Set(1, "1")
+	ast.Equal(0, g.Len())
+
+	// the entry is swept after the window
+	g = NewGroup(WithNotFoundCoalesce[int, string](20 * time.Millisecond))
+	_, err = g.Do(context.Background(), []int{2}, loader)
+	ast.Nil(err)
+	_, err = g.Do(context.Background(), []int{2}, loader)
+	ast.Nil(err)
+	ast.Equal(int32(3), atomic.LoadInt32(&loads))
+	ast.Eventually(func() bool { return g.Len() == 0 }, time.Second, time.Millisecond)
+	_, err = g.Do(context.Background(), []int{2}, loader)
+	ast.Nil(err)
+	ast.Equal(int32(4), atomic.LoadInt32(&loads))
+}
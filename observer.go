@@ -0,0 +1,60 @@
+package multiflight
+
+import "time"
+
+// Observer receives notifications about the work done by a Group. Its
+// methods may be called from many goroutines at once. Embed NopObserver
+// to implement only some of them.
+type Observer interface {
+	// OnBatch is called with the number of keys of every loader call,
+	// after keys shared with other callers have been left out.
+	OnBatch(size int)
+	// OnLoad is called once every loader call returns, with its number
+	// of keys, how long it took and the error it failed with.
+	OnLoad(size int, latency time.Duration, err error)
+}
+
+// NopObserver is an Observer that ignores every notification.
+type NopObserver struct{}
+
+// OnBatch implements Observer.
+func (NopObserver) OnBatch(size int) {}
+
+// OnLoad implements Observer.
+func (NopObserver) OnLoad(size int, latency time.Duration, err error) {}
+
+// WithObserver reports the work of the group to o.
+func WithObserver[K comparable, V any](o Observer) Option[K, V] {
+	return func(opts *options[K, V]) {
+		opts.observer = o
+	}
+}
+
+// AddObserver reports the work of the group to o as well, from now on,
+// e.g. to export metrics of a group created elsewhere. Scoped groups
+// created afterwards report to o too.
+func (g *Group[K, V]) AddObserver(o Observer) {
+	for {
+		old := g.observers.Load()
+		var observers []Observer
+		if old != nil {
+			observers = append(observers, *old...)
+		}
+		observers = append(observers, o)
+		if g.observers.CompareAndSwap(old, &observers) {
+			return
+		}
+	}
+}
+
+// observe calls notify with every observer of the group.
+func (g *Group[K, V]) observe(notify func(o Observer)) {
+	if o := g.opts.observer; o != nil {
+		notify(o)
+	}
+	if observers := g.observers.Load(); observers != nil {
+		for _, o := range *observers {
+			notify(o)
+		}
+	}
+}
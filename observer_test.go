@@ -0,0 +1,103 @@
+package multiflight
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type batchObserver struct {
+	NopObserver
+
+	mu    sync.Mutex
+	sizes []int
+}
+
+func (o *batchObserver) OnBatch(size int) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.sizes = append(o.sizes, size)
+}
+
+func TestObserverOnBatch(t *testing.T) {
+	release := make(chan struct{})
+	loader := func(ctx context.Context, keys []int) (map[int]string, error) {
+		<-release
+		resuts := make(map[int]string, len(keys))
+		for _, k := range keys {
+			resuts[k] = fmt.Sprintf("val: %d", k)
+		}
+		return resuts, nil
+	}
+
+	ast := assert.New(t)
+	o := &batchObserver{}
+	g := NewGroup(WithObserver[int, string](o))
+
+	wg := sync.WaitGroup{}
+	do := func(keys ...int) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := g.Do(context.Background(), keys, loader)
+			ast.Nil(err)
+		}()
+	}
+
+	do(1, 2, 3)
+	ast.Eventually(func() bool { return g.Stats().Waiters == 3 }, time.Second, time.Millisecond)
+	// only 4 and 5 are sent to the loader
+	do(2, 3, 4, 5)
+	ast.Eventually(func() bool { return g.Stats().Waiters == 7 }, time.Second, time.Millisecond)
+
+	close(release)
+	wg.Wait()
+	ast.ElementsMatch([]int{3, 2}, o.sizes)
+}
+
+type loadObserver struct {
+	NopObserver
+
+	mu    sync.Mutex
+	sizes []int
+	errs  []error
+}
+
+func (o *loadObserver) OnLoad(size int, latency time.Duration, err error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.sizes = append(o.sizes, size)
+	o.errs = append(o.errs, err)
+}
+
+func TestAddObserver(t *testing.T) {
+	errBoom := errors.New("boom")
+	loader := func(ctx context.Context, keys []int) (map[int]string, error) {
+		if keys[0] == 0 {
+			return nil, errBoom
+		}
+		return map[int]string{}, nil
+	}
+
+	ast := assert.New(t)
+	static, added := &loadObserver{}, &loadObserver{}
+	g := NewGroup(WithObserver[int, string](static))
+
+	_, err := g.Do(context.Background(), []int{1, 2}, loader)
+	ast.Nil(err)
+	g.AddObserver(added)
+	_, err = g.Do(context.Background(), []int{0}, loader)
+	ast.ErrorIs(err, errBoom)
+	_, err = g.Scoped().Do(context.Background(), []int{3}, loader)
+	ast.Nil(err)
+
+	ast.Equal([]int{2, 1, 1}, static.sizes)
+	ast.Equal([]error{nil, errBoom, nil}, static.errs)
+	ast.Equal([]int{1, 1}, added.sizes)
+	ast.Equal([]error{errBoom, nil}, added.errs)
+}
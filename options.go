@@ -0,0 +1,259 @@
+package multiflight
+
+import (
+	"context"
+	"time"
+)
+
+// Option configures a Group created by NewGroup.
+type Option[K comparable, V any] func(*options[K, V])
+
+type options[K comparable, V any] struct {
+	maxInFlightKeys   int
+	failOverCap       bool
+	maxWaitersPerKey  int
+	observer          Observer
+	tracer            Tracer
+	profilerLabels    bool
+	profilerName      string
+	log               eventLog[K]
+	hooks             Hooks[K, V]
+	prefetch          func(key K, val V) []K
+	maxBatchSize      int
+	limiter           Limiter
+	limitPerChunk     bool
+	breaker           Breaker
+	partialOnError    bool
+	cache             bool
+	ttl               time.Duration
+	negativeTTL       time.Duration
+	notFoundCoalesce  time.Duration
+	errorTTL          time.Duration
+	errorCacheable    func(error) bool
+	retryAttempts     int
+	retryBackoff      func(attempt int) time.Duration
+	retryable         func(error) bool
+	hedgeDelay        time.Duration
+	maxHedges         int
+	loadTimeout       time.Duration
+	slowThreshold     time.Duration
+	onSlow            func(keys []K, elapsed time.Duration)
+	ttlJitter         float64
+	shedPolicy        ShedPolicy
+	batchWindow       time.Duration
+	processor         func(ctx context.Context, key K, val V) (V, error)
+	defaultLoader     Loader[K, V]
+	resolver          func(ctx context.Context) Loader[K, V]
+	partition         func(ctx context.Context) string
+	maxPartitions     int
+	keyFilter         func(key K) bool
+	hotKeys           int
+	dumpLimit         int
+	router            func(key K) int
+	loaders           []Loader[K, V]
+	routed            *Loader[K, V] // routes the keys of calls without a loader, see WithLoaders
+	store             Cache[K, V]
+	maxConcurrentKeys int
+	maxEntries        int
+	fallback          Loader[K, V]
+	softTTL           time.Duration
+	staleGrace        time.Duration
+	equal             func(a, b V) bool
+	equalExtendsTTL   bool
+	onChange          func(key K, oldVal, newVal V)
+	refreshAhead      time.Duration
+	earlyBeta         float64
+	workerPool        int
+	janitorInterval   time.Duration
+	cancelPolicy      CancelPolicy
+	maxBytes          int64
+	sizer             func(key K, val V) int64
+	onEvict           func(key K, val V, reason EvictReason)
+	errorWindow       int
+	batchBuckets      []int
+	circuitThreshold  float64
+	circuitCooldown   time.Duration
+	acceptExtraKeys   bool
+	notFound          func(key K, val V) bool
+	maxFollowerWait   time.Duration
+	clone             func(V) V
+	interner          func(V) any
+}
+
+// CallOption configures a single call to a Group.
+type CallOption func(*callOptions)
+
+type callOptions struct {
+	priority int
+	refresh  bool
+	force    bool       // don't join loads in flight
+	timings  *Timings   // filled in by DoTimed
+	stats    *CallStats // filled in by DoStats
+	source   any        // identifies the loader of the call, see WithBatchKey
+	failFast bool
+	pinned   bool // the call pins its partition until it registers its keys, see partitionOf
+}
+
+func newCallOptions(opts []CallOption) callOptions {
+	co := callOptions{}
+	for _, opt := range opts {
+		opt(&co)
+	}
+	return co
+}
+
+// NewGroup returns a Group configured by opts. A zero Group is still
+// ready to use and behaves like NewGroup without options.
+func NewGroup[K comparable, V any](opts ...Option[K, V]) *Group[K, V] {
+	g := new(Group[K, V])
+	for _, opt := range opts {
+		opt(&g.opts)
+	}
+	if g.opts.cache {
+		g.cache = newCache(&g.opts)
+	}
+	if n := g.opts.maxConcurrentKeys; n > 0 {
+		g.keySem = newWeighted(int64(n))
+	}
+	if n := g.opts.hotKeys; n > 0 {
+		g.hot = newHotKeys[K](n)
+	}
+	if g.opts.circuitThreshold > 0 {
+		g.opts.breaker = NewRateBreaker(g.opts.circuitThreshold, g.opts.errorWindowSize(), g.opts.circuitCooldown)
+	}
+	if g.opts.loaders != nil {
+		routed := route(g.opts.router, g.opts.loaders)
+		g.opts.routed = &routed
+		g.opts.defaultLoader = routed
+	}
+	if g.opts.defaultLoader != nil {
+		g.SetLoader(g.opts.defaultLoader)
+	}
+	g.startWorkers()
+	return g
+}
+
+// Scoped returns a group with the configuration, result cache, hot keys,
+// concurrent keys budget and worker pool of g but its own in-flight
+// keys, so its calls never share a load with calls to g or to other
+// scoped groups while still reading and filling the cache. A scoped
+// group holds no resources beyond its in-flight keys and is meant to be
+// cheap and short-lived, e.g. one per request. Its Stats only count its
+// own calls, and it keeps the default loader g has when Scoped is
+// called. Once g is closed or draining, so is the scoped group.
+func (g *Group[K, V]) Scoped() *Group[K, V] {
+	s := &Group[K, V]{
+		parent: g,
+		opts:   g.opts,
+		cache:  g.cache,
+		keySem: g.keySem,
+		pool:   g.pool,
+		hot:    g.hot,
+	}
+	s.loader.Store(g.loader.Load())
+	s.observers.Store(g.observers.Load())
+	return s
+}
+
+// WithMaxInFlightKeys caps the number of keys being loaded at the same
+// time. A caller whose new keys would exceed the cap blocks until enough
+// loads complete, unless WithFailOverCapacity is set. Keys joining loads
+// already in flight never count against the cap, and a call that exceeds
+// the cap on its own is admitted once nothing else is in flight.
+func WithMaxInFlightKeys[K comparable, V any](n int) Option[K, V] {
+	return func(o *options[K, V]) {
+		o.maxInFlightKeys = n
+	}
+}
+
+// WithFailOverCapacity makes callers that would exceed the in-flight cap
+// fail immediately with ErrOverCapacity instead of blocking.
+func WithFailOverCapacity[K comparable, V any]() Option[K, V] {
+	return func(o *options[K, V]) {
+		o.failOverCap = true
+	}
+}
+
+// WithMaxWaitersPerKey limits the number of callers attached to a single
+// in-flight key, the caller that started the load included. Further
+// callers don't wait for that key: Do serves their other keys and
+// returns a *KeysError wrapping ErrTooManyWaiters listing the rejected
+// ones.
+func WithMaxWaitersPerKey[K comparable, V any](n int) Option[K, V] {
+	return func(o *options[K, V]) {
+		o.maxWaitersPerKey = n
+	}
+}
+
+// WithMaxBatchSize splits the keys a call has to load into loader calls
+// of at most n keys, which run concurrently. With WithBatchWindow it is
+// instead the most keys dispatched per window.
+func WithMaxBatchSize[K comparable, V any](n int) Option[K, V] {
+	return func(o *options[K, V]) {
+		o.maxBatchSize = n
+	}
+}
+
+// WithPartialOnError keeps the values a loader returns along with an
+// error: keys present in the returned map get their values and only the
+// other keys fail with the error. By default an error fails every key
+// of the call.
+func WithPartialOnError[K comparable, V any]() Option[K, V] {
+	return func(o *options[K, V]) {
+		o.partialOnError = true
+	}
+}
+
+// WithAcceptExtraKeys keeps the values a loader returns for keys it
+// wasn't asked for, instead of dropping them: they are cached, and
+// stored in the external cache, and the loads of these keys in flight
+// complete with them right away.
+func WithAcceptExtraKeys[K comparable, V any]() Option[K, V] {
+	return func(o *options[K, V]) {
+		o.acceptExtraKeys = true
+	}
+}
+
+// WithNotFoundFunc treats the values notFound reports true for, e.g.
+// tombstones, like keys missing from the map a loader returns: they are
+// left out of the results and never cached as values, only as not found
+// records with WithNegativeTTL.
+func WithNotFoundFunc[K comparable, V any](notFound func(key K, val V) bool) Option[K, V] {
+	return func(o *options[K, V]) {
+		o.notFound = notFound
+	}
+}
+
+// WithMaxFollowerWait bounds to d the time a call waits for keys other
+// callers are loading, from when it starts waiting. Past d the call
+// fails with ErrFollowerTimeout while the loads go on for the others.
+// Keys the call loads itself are not bounded, see WithLoadTimeout.
+func WithMaxFollowerWait[K comparable, V any](d time.Duration) Option[K, V] {
+	return func(o *options[K, V]) {
+		o.maxFollowerWait = d
+	}
+}
+
+// WithLoadTimeout bounds every loader call to d, whatever the deadline
+// of the context it runs with. Keys of a call that fails or is still
+// running past d get an error wrapping both ErrLoadTimeout and
+// context.DeadlineExceeded, and a loader ignoring its context is given
+// up on, its results dropped. With WithRetry, every attempt gets its
+// own d.
+func WithLoadTimeout[K comparable, V any](d time.Duration) Option[K, V] {
+	return func(o *options[K, V]) {
+		o.loadTimeout = d
+	}
+}
+
+// WithValueProcessor runs process on every value a loader returns before
+// it is cached or handed to callers, e.g. to decode or validate it. The
+// value is replaced by the one process returns, and a key for which it
+// fails gets its error instead, without affecting the other keys of the
+// batch. Cached values and values shared by concurrent callers are
+// processed only once, when loaded.
+func WithValueProcessor[K comparable, V any](process func(ctx context.Context, key K, val V) (V, error)) Option[K, V] {
+	return func(o *options[K, V]) {
+		o.processor = process
+	}
+}
@@ -0,0 +1,61 @@
+package multiflight
+
+import (
+	"context"
+)
+
+// WithWorkerPool runs loads on a fixed pool of n goroutines owned by the
+// group instead of on the goroutines of the callers, which only wait for
+// the results. It bounds the loads running at the same time to n however
+// many callers there are. The pool is shared with scoped groups and runs
+// until Close, after which loads fail with ErrClosed.
+func WithWorkerPool[K comparable, V any](n int) Option[K, V] {
+	return func(o *options[K, V]) {
+		o.workerPool = n
+	}
+}
+
+// pool hands loads over to the worker goroutines.
+type pool struct {
+	jobs chan func()
+	done <-chan struct{} // closed when the workers stop
+}
+
+// work runs jobs until the pool is closed.
+func (p *pool) work() {
+	for {
+		select {
+		case <-p.done:
+			return
+		case job := <-p.jobs:
+			job()
+		}
+	}
+}
+
+// submit waits for a worker to take job.
+func (p *pool) submit(ctx context.Context, job func()) error {
+	select {
+	case p.jobs <- job:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-p.done:
+		return ErrClosed
+	}
+}
+
+// runLoad loads ents, on the worker pool if there is one.
+func (g *Group[K, V]) runLoad(ctx context.Context, ents []*ent[K, V], load loadFunc[K, V]) {
+	if g.pool == nil {
+		g.doLoad(ctx, ents, load)
+		return
+	}
+
+	err := g.pool.submit(ctx, func() {
+		g.doLoad(ctx, ents, load)
+	})
+	if err != nil {
+		g.failAll(ents, err)
+	}
+}
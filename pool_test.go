@@ -0,0 +1,87 @@
+package multiflight
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"runtime"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// goid returns the id of the calling goroutine.
+func goid() uint64 {
+	buf := make([]byte, 64)
+	buf = buf[:runtime.Stack(buf, false)]
+	buf = bytes.TrimPrefix(buf, []byte("goroutine "))
+	id, _ := strconv.ParseUint(string(buf[:bytes.IndexByte(buf, ' ')]), 10, 64)
+	return id
+}
+
+func TestWorkerPool(t *testing.T) {
+	const (
+		PoolSize  = 3
+		WorkerNum = 20
+	)
+
+	var (
+		mu                  sync.Mutex
+		loaders             = make(map[uint64]struct{})
+		running, maxRunning int32
+	)
+	loader := func(ctx context.Context, keys []int) (map[int]string, error) {
+		mu.Lock()
+		loaders[goid()] = struct{}{}
+		mu.Unlock()
+
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			m := atomic.LoadInt32(&maxRunning)
+			if n <= m || atomic.CompareAndSwapInt32(&maxRunning, m, n) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond * 5)
+
+		resuts := make(map[int]string, len(keys))
+		for _, k := range keys {
+			resuts[k] = fmt.Sprintf("val: %d", k)
+		}
+		return resuts, nil
+	}
+
+	ast := assert.New(t)
+	g := NewGroup(WithWorkerPool[int, string](PoolSize))
+
+	var callers sync.Map
+	wg := sync.WaitGroup{}
+	for i := 0; i < WorkerNum; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			callers.Store(goid(), struct{}{})
+			results, err := g.Do(context.Background(), []int{i}, loader)
+			ast.Nil(err)
+			ast.Equal(map[int]string{i: fmt.Sprintf("val: %d", i)}, results)
+		}(i)
+	}
+	wg.Wait()
+
+	// loads ran on the pool only, never more at once than its size
+	ast.LessOrEqual(len(loaders), PoolSize)
+	for id := range loaders {
+		_, has := callers.Load(id)
+		ast.False(has)
+	}
+	ast.LessOrEqual(atomic.LoadInt32(&maxRunning), int32(PoolSize))
+
+	ast.Nil(g.Close(context.Background()))
+	_, err := g.Do(context.Background(), []int{100}, loader)
+	ast.ErrorIs(err, ErrClosed)
+}
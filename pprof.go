@@ -0,0 +1,39 @@
+package multiflight
+
+import (
+	"context"
+	"runtime/pprof"
+	"strconv"
+)
+
+// Profiler labels of the loader calls with WithProfilerLabels.
+const (
+	GroupLabel     = "multiflight_group"
+	BatchSizeLabel = "multiflight_batch_size"
+)
+
+// WithProfilerLabels runs the loader calls with the pprof labels
+// GroupLabel set to name and BatchSizeLabel to the number of keys of
+// the call, so that CPU and goroutine profiles tell the work of the
+// loaders of the group apart from that of the callers.
+func WithProfilerLabels[K comparable, V any](name string) Option[K, V] {
+	return func(o *options[K, V]) {
+		o.profilerName = name
+		o.profilerLabels = true
+	}
+}
+
+// labeled returns load running with the profiler labels of the group,
+// or load itself without.
+func (g *Group[K, V]) labeled(load loadFunc[K, V]) loadFunc[K, V] {
+	if !g.opts.profilerLabels {
+		return load
+	}
+	return func(ctx context.Context, keys []K) (vals map[K]V, lives map[K]lifetime, err error) {
+		labels := pprof.Labels(GroupLabel, g.opts.profilerName, BatchSizeLabel, strconv.Itoa(len(keys)))
+		pprof.Do(ctx, labels, func(ctx context.Context) {
+			vals, lives, err = load(ctx, keys)
+		})
+		return vals, lives, err
+	}
+}
@@ -0,0 +1,45 @@
+package multiflight
+
+import (
+	"context"
+	"fmt"
+	"runtime/pprof"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProfilerLabels(t *testing.T) {
+	labels := make(chan map[string]string, 2)
+	loader := func(ctx context.Context, keys []int) (map[int]string, error) {
+		l := make(map[string]string)
+		pprof.ForLabels(ctx, func(key, value string) bool {
+			l[key] = value
+			return true
+		})
+		labels <- l
+		vals := make(map[int]string, len(keys))
+		for _, k := range keys {
+			vals[k] = fmt.Sprint(k)
+		}
+		return vals, nil
+	}
+
+	ast := assert.New(t)
+	g := NewGroup(WithProfilerLabels[int, string]("users"), WithLoadTimeout[int, string](time.Second))
+	_, err := g.Do(context.Background(), []int{1, 2, 3}, loader)
+	ast.Nil(err)
+	ast.Equal(map[string]string{GroupLabel: "users", BatchSizeLabel: "3"}, <-labels)
+
+	// the caller labels are kept
+	ctx := pprof.WithLabels(context.Background(), pprof.Labels("request", "42"))
+	_, err = g.Do(ctx, []int{4}, loader)
+	ast.Nil(err)
+	ast.Equal(map[string]string{GroupLabel: "users", BatchSizeLabel: "1", "request": "42"}, <-labels)
+
+	// without the option the loader runs with the labels of the caller
+	_, err = NewGroup[int, string]().Do(ctx, []int{1}, loader)
+	ast.Nil(err)
+	ast.Equal(map[string]string{"request": "42"}, <-labels)
+}
@@ -0,0 +1,55 @@
+package multiflight
+
+import "context"
+
+// WithPrefetch calls related with every value loaded for callers and
+// loads the keys it returns in the background, unless they are cached or
+// being loaded already, so that later calls find them in the cache, e.g.
+// the neighbours of a node of a graph. Prefetching goes through the same
+// limits as other loads and is skipped while the group is at the cap of
+// WithMaxInFlightKeys. Prefetched values don't prefetch in turn.
+// WithPrefetch does nothing unless the group caches results.
+func WithPrefetch[K comparable, V any](related func(key K, val V) []K) Option[K, V] {
+	return func(o *options[K, V]) {
+		o.prefetch = related
+	}
+}
+
+// prefetch loads with load, of the given source, in the background, the
+// keys related to the values in vals that are neither cached nor in
+// flight.
+func (g *Group[K, V]) prefetch(ctx context.Context, vals map[K]V, load loadFunc[K, V], source any) {
+	var keys []K
+	for k, v := range vals {
+		keys = append(keys, g.opts.prefetch(k, v)...)
+	}
+	keys = g.filter(keys)
+	if len(keys) == 0 {
+		return
+	}
+
+	var ents []*ent[K, V]
+	g.withLock(func() {
+		if g.m == nil {
+			g.m = make(map[K]*ent[K, V], 1024)
+		}
+		if g.rejected() != nil || g.overCapacity(keys, false) {
+			return
+		}
+		for _, key := range keys {
+			if _, has := g.m[key]; has {
+				continue
+			}
+			if it, ok := g.cache.peek(key); ok && it.err == nil {
+				continue
+			}
+			e := newEnt[K, V](key)
+			e.prefetch = true
+			g.m[key] = e
+			ents = append(ents, e)
+		}
+	})
+	if len(ents) > 0 {
+		g.revalidate(ctx, ents, load, source, 0)
+	}
+}
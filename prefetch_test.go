@@ -0,0 +1,85 @@
+package multiflight
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrefetch(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		loaded []int
+	)
+	loader := func(ctx context.Context, keys []int) (map[int]string, error) {
+		mu.Lock()
+		loaded = append(loaded, keys...)
+		mu.Unlock()
+		vals := make(map[int]string, len(keys))
+		for _, k := range keys {
+			vals[k] = fmt.Sprintf("val: %d", k)
+		}
+		return vals, nil
+	}
+	loadedKeys := func() []int {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]int(nil), loaded...)
+	}
+	related := func(key int, val string) []int {
+		return []int{key * 10, key*10 + 1}
+	}
+
+	ast := assert.New(t)
+	g := NewGroup(WithTTL[int, string](time.Minute), WithPrefetch(related))
+	g.Set(11, "cached")
+	results, err := g.Do(context.Background(), []int{1}, loader)
+	ast.Nil(err)
+	ast.Equal(map[int]string{1: "val: 1"}, results)
+
+	// the keys related to 1 that weren't cached are loaded in the
+	// background, and don't prefetch in turn
+	ast.Eventually(func() bool { return len(loadedKeys()) == 2 && g.Len() == 0 }, time.Second, time.Millisecond)
+	ast.Equal([]int{1, 10}, loadedKeys())
+	vals, misses := g.TryDo(context.Background(), []int{10, 11})
+	ast.Empty(misses)
+	ast.Equal(map[int]string{10: "val: 10", 11: "cached"}, vals)
+	time.Sleep(time.Millisecond * 10)
+	ast.Equal([]int{1, 10}, loadedKeys())
+
+	// nothing is prefetched without a cache
+	mu.Lock()
+	loaded = nil
+	mu.Unlock()
+	g = NewGroup(WithPrefetch(related))
+	_, err = g.Do(context.Background(), []int{2}, loader)
+	ast.Nil(err)
+	time.Sleep(time.Millisecond * 10)
+	ast.Equal([]int{2}, loadedKeys())
+}
+
+func TestPrefetchCached(t *testing.T) {
+	loader := func(ctx context.Context, keys []int) (map[int]string, error) {
+		t.Errorf("loaded %v", keys)
+		return nil, nil
+	}
+	related := func(key int, val string) []int {
+		return []int{2}
+	}
+
+	ast := assert.New(t)
+	g := NewGroup(WithLRU[int, string](2), WithPrefetch(related))
+	g.Set(2, "val: 2")
+	g.Set(3, "val: 3")
+
+	// checking that 2 is cached doesn't count as a read of it
+	g.prefetch(context.Background(), map[int]string{1: "val: 1"}, Loader[int, string](loader).batch(), nil)
+	g.Set(4, "val: 4")
+	vals, misses := g.TryDo(context.Background(), []int{2, 3})
+	ast.Equal(map[int]string{3: "val: 3"}, vals)
+	ast.Equal([]int{2}, misses)
+}
@@ -0,0 +1,31 @@
+package multiflight
+
+import (
+	"context"
+)
+
+// Limiter paces loader calls. *rate.Limiter from golang.org/x/time/rate
+// satisfies it.
+type Limiter interface {
+	// Wait blocks until the next call is allowed or ctx is done.
+	Wait(ctx context.Context) error
+}
+
+// WithLoadRateLimit makes the group wait on l before calling the loader.
+// The wait honors the context of the caller that runs the load, and an
+// error from Wait fails the keys of the batch. By default a call takes
+// one token however many chunks WithMaxBatchSize splits it into; see
+// WithRateLimitPerChunk.
+func WithLoadRateLimit[K comparable, V any](l Limiter) Option[K, V] {
+	return func(o *options[K, V]) {
+		o.limiter = l
+	}
+}
+
+// WithRateLimitPerChunk makes every chunk of a call wait for its own
+// token instead of the call taking one token for all its chunks.
+func WithRateLimitPerChunk[K comparable, V any]() Option[K, V] {
+	return func(o *options[K, V]) {
+		o.limitPerChunk = true
+	}
+}
@@ -0,0 +1,87 @@
+package multiflight
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type countingLimiter struct {
+	waits int32
+	err   error
+}
+
+func (l *countingLimiter) Wait(ctx context.Context) error {
+	atomic.AddInt32(&l.waits, 1)
+	if l.err != nil {
+		return l.err
+	}
+	return ctx.Err()
+}
+
+func TestLoadRateLimit(t *testing.T) {
+	var calls int32
+	loader := func(ctx context.Context, keys []int) (map[int]string, error) {
+		atomic.AddInt32(&calls, 1)
+		resuts := make(map[int]string, len(keys))
+		for _, k := range keys {
+			resuts[k] = fmt.Sprintf("val: %d", k)
+		}
+		return resuts, nil
+	}
+	keys := []int{1, 2, 3, 4, 5}
+
+	ast := assert.New(t)
+
+	// the whole call takes a single token
+	l := &countingLimiter{}
+	g := NewGroup(
+		WithMaxBatchSize[int, string](2),
+		WithLoadRateLimit[int, string](l),
+	)
+	results, err := g.Do(context.Background(), keys, loader)
+	ast.Nil(err)
+	ast.Len(results, len(keys))
+	ast.Equal(int32(1), l.waits)
+	ast.Equal(int32(3), atomic.LoadInt32(&calls))
+
+	// every chunk takes a token
+	l = &countingLimiter{}
+	g = NewGroup(
+		WithMaxBatchSize[int, string](2),
+		WithLoadRateLimit[int, string](l),
+		WithRateLimitPerChunk[int, string](),
+	)
+	results, err = g.Do(context.Background(), keys, loader)
+	ast.Nil(err)
+	ast.Len(results, len(keys))
+	ast.Equal(int32(3), atomic.LoadInt32(&l.waits))
+}
+
+func TestLoadRateLimitError(t *testing.T) {
+	var calls int32
+	loader := func(ctx context.Context, keys []int) (map[int]string, error) {
+		atomic.AddInt32(&calls, 1)
+		return map[int]string{}, nil
+	}
+
+	ast := assert.New(t)
+	errLimited := errors.New("limited")
+	g := NewGroup(WithLoadRateLimit[int, string](&countingLimiter{err: errLimited}))
+	_, err := g.Do(context.Background(), []int{1, 2}, loader)
+	ast.ErrorIs(err, errLimited)
+	ast.Equal(int32(0), calls)
+	ast.Equal(0, g.Len())
+
+	// the wait follows the caller's context
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	g = NewGroup(WithLoadRateLimit[int, string](&countingLimiter{}))
+	_, err = g.Do(ctx, []int{1, 2}, loader)
+	ast.ErrorIs(err, context.Canceled)
+	ast.Equal(int32(0), calls)
+}
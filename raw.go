@@ -0,0 +1,101 @@
+package multiflight
+
+import (
+	"context"
+	"errors"
+)
+
+// RawResult is the outcome of a key of DoRaw.
+type RawResult[K comparable, V any] struct {
+	Key   K
+	Val   V
+	Found bool  // the key has a value, Val
+	Err   error // the key failed, e.g. with its loader call
+}
+
+// DoRaw is a lower level Do for abstractions built on a group: it
+// returns the outcome of every key in the order of keys, duplicates
+// included, without assembling a map. Keys failing, and keys rejected,
+// e.g. with ErrShed, get their error in their RawResult, and only an
+// error failing the whole call, ctx ending or ErrFollowerTimeout
+// included, is returned. With CancelPartial, ctx ending fails only the
+// keys still pending instead, and with WithFailFast, the first key
+// failing fails the whole call. DoRaw is advanced API: RawResult may
+// gain fields.
+func (g *Group[K, V]) DoRaw(ctx context.Context, keys []K, load Loader[K, V], opts ...CallOption) ([]RawResult[K, V], error) {
+	if p := g.partitionOf(ctx); p != g {
+		return p.DoRaw(ctx, keys, load, append([]CallOption{pinned}, opts...)...)
+	}
+	co := newCallOptions(opts)
+	load = g.loaderOf(load, &co)
+	c, err := g.begin(ctx, keys, load.batch(), co)
+	if err != nil {
+		return nil, err
+	}
+	defer g.leave(c)
+
+	ents := make(map[K]*ent[K, V], len(c.ents))
+	var failed error
+	pending, err := g.await(ctx, c, load.batch(), co, func(e *ent[K, V]) bool {
+		ents[e.key] = e
+		if co.failFast && e.err != nil && !errors.Is(e.err, errResultNotFound) {
+			failed = e.err
+			return false
+		}
+		return true
+	})
+	var canceled error
+	switch {
+	case failed != nil:
+		return nil, failed
+	case pending != nil && g.opts.cancelPolicy == CancelPartial:
+		var missed []K
+		for _, e := range pending {
+			select {
+			case <-e.done:
+				ents[e.key] = e
+			default:
+				missed = append(missed, e.key)
+			}
+		}
+		canceled = &KeysError[K]{Keys: missed, Err: err}
+	case err != nil:
+		return nil, err
+	}
+
+	var rejected map[K]error
+	if len(c.shed)+len(c.rejected) > 0 {
+		rejected = make(map[K]error, len(c.shed)+len(c.rejected))
+		for _, k := range c.shed {
+			rejected[k] = &KeysError[K]{Keys: c.shed, Err: ErrShed}
+		}
+		for _, k := range c.rejected {
+			rejected[k] = &KeysError[K]{Keys: c.rejected, Err: ErrTooManyWaiters}
+		}
+	}
+	results := make([]RawResult[K, V], len(keys))
+	for i, k := range keys {
+		r := &results[i]
+		r.Key = k
+		if v, hit := c.result[k]; hit {
+			r.Val, r.Found = v, true
+			continue
+		}
+		if e, has := ents[k]; has {
+			switch {
+			case errors.Is(e.err, errResultNotFound):
+			case e.err != nil:
+				r.Err = e.err
+			default:
+				r.Val, r.Found = e.val, true
+			}
+			continue
+		}
+		if err, has := rejected[k]; has {
+			r.Err = err
+		} else {
+			r.Err = canceled
+		}
+	}
+	return results, nil
+}
@@ -0,0 +1,106 @@
+package multiflight
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDoRaw(t *testing.T) {
+	errBoom := errors.New("boom")
+	loader := func(ctx context.Context, keys []int) (map[int]string, error) {
+		if keys[0] == 4 {
+			return nil, errBoom
+		}
+		vals := make(map[int]string, len(keys))
+		for _, k := range keys {
+			if k != 3 {
+				vals[k] = fmt.Sprint(k)
+			}
+		}
+		return vals, nil
+	}
+
+	ast := assert.New(t)
+	g := NewGroup(WithTTL[int, string](time.Minute), WithMaxBatchSize[int, string](2))
+	_, err := g.Do(context.Background(), []int{2}, loader)
+	ast.Nil(err)
+
+	keys := []int{5, 2, 3, 1, 2}
+	results, err := g.DoRaw(context.Background(), keys, loader)
+	ast.Nil(err)
+	ast.Equal([]RawResult[int, string]{
+		{Key: 5, Val: "5", Found: true},
+		{Key: 2, Val: "2", Found: true},
+		{Key: 3},
+		{Key: 1, Val: "1", Found: true},
+		{Key: 2, Val: "2", Found: true},
+	}, results)
+
+	// the same as Do
+	vals, err := g.Do(context.Background(), keys, loader)
+	ast.Nil(err)
+	raw := map[int]string{}
+	for _, r := range results {
+		if r.Found {
+			raw[r.Key] = r.Val
+		}
+	}
+	ast.Equal(vals, raw)
+
+	// failing keys don't fail the others
+	results, err = g.DoRaw(context.Background(), []int{4, 1}, loader)
+	ast.Nil(err)
+	ast.Equal(4, results[0].Key)
+	ast.ErrorIs(results[0].Err, errBoom)
+	ast.Equal(RawResult[int, string]{Key: 1, Val: "1", Found: true}, results[1])
+	_, err = g.Do(context.Background(), []int{4, 1}, loader)
+	ast.ErrorIs(err, errBoom)
+
+	// ctx ending fails the call
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = g.DoRaw(ctx, []int{6}, loader)
+	ast.ErrorIs(err, context.Canceled)
+
+	// with WithFailFast, failing keys fail the call
+	_, err = g.DoRaw(context.Background(), []int{4, 1}, loader, WithFailFast())
+	ast.ErrorIs(err, errBoom)
+}
+
+func TestDoRawCancelPartial(t *testing.T) {
+	release := make(chan struct{})
+	loader := func(ctx context.Context, keys []int) (map[int]string, error) {
+		if keys[0] == 2 {
+			<-release
+		}
+		return map[int]string{keys[0]: fmt.Sprint(keys[0])}, nil
+	}
+
+	ast := assert.New(t)
+	g := NewGroup(WithCancelPolicy[int, string](CancelPartial))
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		g.Do(context.Background(), []int{2}, loader)
+	}()
+	ast.Eventually(func() bool { return g.InFlight(2) }, time.Second, time.Millisecond)
+
+	// the keys still pending when ctx ends fail, the others don't
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	results, err := g.DoRaw(ctx, []int{1, 2}, loader)
+	ast.Nil(err)
+	ast.Equal(RawResult[int, string]{Key: 1, Val: "1", Found: true}, results[0])
+	ast.Equal(2, results[1].Key)
+	ast.ErrorIs(results[1].Err, context.DeadlineExceeded)
+	var kerr *KeysError[int]
+	ast.ErrorAs(results[1].Err, &kerr)
+	ast.Equal([]int{2}, kerr.Keys)
+	close(release)
+	<-done
+}
@@ -0,0 +1,67 @@
+package multiflight
+
+import (
+	"context"
+	"time"
+)
+
+// WithRefreshAhead reloads cached values that are still being read
+// before they expire, so hot keys are always served from the cache. A
+// worker checks the cache every interval and reloads with the default
+// loader the values read since they were loaded that expire within the
+// next interval. Values nobody reads are left to expire. The worker runs
+// until Close, and only with WithTTL and a default loader.
+func WithRefreshAhead[K comparable, V any](interval time.Duration) Option[K, V] {
+	return func(o *options[K, V]) {
+		o.refreshAhead = interval
+	}
+}
+
+// refreshAhead is the refresh-ahead worker.
+func (g *Group[K, V]) refreshAhead(interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-g.ctx.Done():
+			return
+		case <-t.C:
+		}
+
+		g.refreshExpiring(g.ctx, interval)
+		g.eachPartition(func(p *Group[K, V]) {
+			p.refreshExpiring(g.ctx, interval)
+		})
+	}
+}
+
+// refreshExpiring reloads with the default loader the values of the
+// cache read since they were loaded that expire within d.
+func (g *Group[K, V]) refreshExpiring(ctx context.Context, d time.Duration) {
+	load := g.loader.Load()
+	if load == nil || *load == nil {
+		return
+	}
+	if keys := g.cache.expiring(d); len(keys) > 0 {
+		g.do(ctx, keys, (*load).batch(), callOptions{refresh: true, source: load})
+	}
+}
+
+// expiring returns the keys of the values read since they were cached
+// that expire within d.
+func (c *cache[K, V]) expiring(d time.Duration) []K {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	var keys []K
+	for key, it := range c.items {
+		if it.notFound || it.err != nil || it.accessed.IsZero() || it.expires.IsZero() {
+			continue
+		}
+		if now.Before(it.expires) && !it.expires.After(now.Add(d)) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
@@ -0,0 +1,80 @@
+package multiflight
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRefreshAhead(t *testing.T) {
+	var version, loaded int32
+	loader := countingLoader(&version, &loaded)
+
+	ast := assert.New(t)
+	clock := newFakeClock()
+	g := NewGroup(WithTTL[int, string](time.Minute), WithDefaultLoader(loader))
+	// start the worker once the clock is injected
+	g.cache.now = clock.Now
+	g.opts.refreshAhead = time.Millisecond * 10
+	g.startWorkers()
+
+	_, err := g.DoDefault(context.Background(), []int{1, 2})
+	ast.Nil(err)
+	// only 1 is read after being loaded
+	_, err = g.DoDefault(context.Background(), []int{1})
+	ast.Nil(err)
+	ast.Equal(int32(2), atomic.LoadInt32(&loaded))
+
+	atomic.StoreInt32(&version, 1)
+	clock.Advance(time.Minute - time.Millisecond*5)
+	ast.Eventually(func() bool { return atomic.LoadInt32(&loaded) == 3 }, time.Second, time.Millisecond)
+
+	// the reloaded value is served and outlives the old TTL
+	clock.Advance(time.Millisecond * 10)
+	results, err := g.DoDefault(context.Background(), []int{1})
+	ast.Nil(err)
+	ast.Equal(map[int]string{1: "val: 1 v1"}, results)
+	ast.Equal(int32(3), atomic.LoadInt32(&loaded))
+
+	// 2 wasn't read, so it expired
+	results, err = g.DoDefault(context.Background(), []int{2})
+	ast.Nil(err)
+	ast.Equal(map[int]string{2: "val: 2 v1"}, results)
+	ast.Equal(int32(4), atomic.LoadInt32(&loaded))
+
+	ast.Nil(g.Close(context.Background()))
+	ast.Nil(g.Close(context.Background()))
+}
+
+func TestRefreshAheadValueEqual(t *testing.T) {
+	var version, loaded int32
+	loader := countingLoader(&version, &loaded)
+
+	ast := assert.New(t)
+	clock := newFakeClock()
+	g := NewGroup(
+		WithTTL[int, string](time.Minute),
+		WithDefaultLoader(loader),
+		WithValueEqual[int, string](func(a, b string) bool { return a == b }),
+		WithEqualValueExtendsTTL[int, string](),
+		WithRefreshAhead[int, string](time.Hour),
+	)
+	defer g.Close(context.Background())
+	g.cache.now = clock.Now
+
+	_, err := g.DoDefault(context.Background(), []int{1})
+	ast.Nil(err)
+	_, err = g.DoDefault(context.Background(), []int{1})
+	ast.Nil(err)
+
+	// the value kept equal isn't read again, so it isn't refreshed again
+	clock.Advance(time.Second * 50)
+	g.refreshExpiring(context.Background(), time.Second*20)
+	ast.Equal(int32(2), atomic.LoadInt32(&loaded))
+	clock.Advance(time.Second * 50)
+	g.refreshExpiring(context.Background(), time.Second*20)
+	ast.Equal(int32(2), atomic.LoadInt32(&loaded))
+}
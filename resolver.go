@@ -0,0 +1,181 @@
+package multiflight
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+)
+
+// defaultMaxPartitions is the most partitions a group keeps without
+// WithMaxPartitions.
+const defaultMaxPartitions = 1024
+
+// WithLoaderResolver makes DoDefault load with the loader resolve
+// returns for the context of the call, e.g. the loader of the tenant the
+// context carries, or the default loader if it returns nil. Callers
+// sharing a load share the loader of the call that started it, whatever
+// their own context: use WithContextKeyPartition to keep the loads of
+// different tenants apart.
+func WithLoaderResolver[K comparable, V any](resolve func(ctx context.Context) Loader[K, V]) Option[K, V] {
+	return func(o *options[K, V]) {
+		o.resolver = resolve
+	}
+}
+
+// WithContextKeyPartition partitions the calls of the group by the
+// partition returns for their context, e.g. by tenant, so that calls of
+// different partitions never share loads or cached values. Every
+// partition but "" has its own in-flight keys and result cache, like a
+// Scoped group with a cache of its own, see Partition. Invalidate, Set,
+// MarkNotFound, Forget and the like apply to every partition, the
+// janitor and refresh-ahead cover them all, and Stats adds them up,
+// while Len, InFlight, Snapshot and Restore only see the "" partition.
+// Refresh-ahead reloads the values of a partition with the loader
+// WithLoaderResolver returned for the call that created it, or the
+// default loader.
+func WithContextKeyPartition[K comparable, V any](partition func(ctx context.Context) string) Option[K, V] {
+	return func(o *options[K, V]) {
+		o.partition = partition
+	}
+}
+
+// WithMaxPartitions caps the partitions of WithContextKeyPartition the
+// group keeps to n, 1024 by default. Creating one more drops the
+// partition called the least recently among those with no keys in
+// flight, along with its cache.
+func WithMaxPartitions[K comparable, V any](n int) Option[K, V] {
+	return func(o *options[K, V]) {
+		o.maxPartitions = n
+	}
+}
+
+// Partition returns the group of the partition name, see
+// WithContextKeyPartition, e.g. to Snapshot its cache. It is g itself
+// for "" or without partitions.
+func (g *Group[K, V]) Partition(name string) *Group[K, V] {
+	if g.opts.partition == nil || name == "" {
+		return g
+	}
+	return g.partition(context.Background(), name, false)
+}
+
+// partitionOf returns the group of the partition of ctx, g itself
+// without partitions or for the "" partition. A partition returned is
+// pinned against eviction until the call redirected to it registers
+// its keys, see pinned.
+func (g *Group[K, V]) partitionOf(ctx context.Context) *Group[K, V] {
+	if g.opts.partition == nil {
+		return g
+	}
+	name := g.opts.partition(ctx)
+	if name == "" {
+		return g
+	}
+	return g.partition(ctx, name, true)
+}
+
+// partition returns the group of the partition name, creating it for a
+// call with ctx if needed, and pins it if pin is set. Looking it up and
+// pinning it under g.mu keeps evictPartition from dropping it before
+// the call registers its keys.
+func (g *Group[K, V]) partition(ctx context.Context, name string, pin bool) *Group[K, V] {
+	var found *Group[K, V]
+	g.withLock(func() {
+		if p, has := g.partitions.Load(name); has {
+			found = p.(*Group[K, V])
+			if pin {
+				found.pins++
+			}
+		}
+	})
+	if found != nil {
+		atomic.StoreInt64(&found.used, time.Now().UnixNano())
+		return found
+	}
+
+	p := g.Scoped()
+	// g closes and drains its partitions itself
+	p.parent = nil
+	p.owner = g
+	p.opts.partition = nil
+	if g.cache != nil {
+		p.cache = newCache(&p.opts)
+	}
+	if g.opts.resolver != nil {
+		if load := g.opts.resolver(ctx); load != nil {
+			p.loader.Store(&load)
+		}
+	}
+	p.used = time.Now().UnixNano()
+	actual := p
+	g.withLock(func() {
+		if pin {
+			defer func() { actual.pins++ }()
+		}
+		if g.rejected() != nil {
+			// a closed or draining group fails the calls of its
+			// partitions, kept or not
+			p.closed, p.draining, p.closeErr = g.closed, g.draining, g.closeErr
+			return
+		}
+		if q, has := g.partitions.Load(name); has {
+			actual = q.(*Group[K, V])
+			return
+		}
+		max := g.opts.maxPartitions
+		if max <= 0 {
+			max = defaultMaxPartitions
+		}
+		if g.npartitions >= max {
+			g.evictPartition()
+		}
+		g.partitions.Store(name, p)
+		g.npartitions++
+	})
+	return actual
+}
+
+// pinned is the CallOption of calls redirected to a partition pinned by
+// partitionOf.
+func pinned(co *callOptions) {
+	co.pinned = true
+}
+
+// unpin releases a partition pinned by partitionOf.
+func (g *Group[K, V]) unpin() {
+	g.owner.withLock(func() {
+		g.pins--
+	})
+}
+
+// evictPartition drops the partition called the least recently among
+// those with no keys in flight nor calls pinning them, if any. Must be
+// called with g.mu held.
+func (g *Group[K, V]) evictPartition() {
+	var (
+		name   any
+		oldest *Group[K, V]
+	)
+	g.partitions.Range(func(n, v any) bool {
+		p := v.(*Group[K, V])
+		if oldest != nil && atomic.LoadInt64(&p.used) >= atomic.LoadInt64(&oldest.used) {
+			return true
+		}
+		if p.pins == 0 && p.Len() == 0 {
+			name, oldest = n, p
+		}
+		return true
+	})
+	if oldest != nil {
+		g.partitions.Delete(name)
+		g.npartitions--
+	}
+}
+
+// eachPartition calls f with every partition of g but "".
+func (g *Group[K, V]) eachPartition(f func(p *Group[K, V])) {
+	g.partitions.Range(func(_, p any) bool {
+		f(p.(*Group[K, V]))
+		return true
+	})
+}
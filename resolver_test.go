@@ -0,0 +1,200 @@
+package multiflight
+
+import (
+	"context"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type tenantKey struct{}
+
+func tenantOf(ctx context.Context) string {
+	tenant, _ := ctx.Value(tenantKey{}).(string)
+	return tenant
+}
+
+func TestLoaderResolver(t *testing.T) {
+	release := make(chan struct{})
+	loaderOf := func(tenant string) Loader[int, string] {
+		return func(ctx context.Context, keys []int) (map[int]string, error) {
+			<-release
+			vals := make(map[int]string, len(keys))
+			for _, k := range keys {
+				vals[k] = fmt.Sprint(tenant, k)
+			}
+			return vals, nil
+		}
+	}
+	resolve := func(ctx context.Context) Loader[int, string] {
+		if tenant := tenantOf(ctx); tenant != "" {
+			return loaderOf(tenant)
+		}
+		return nil
+	}
+	call := func(g *Group[int, string], tenant string) <-chan map[int]string {
+		results := make(chan map[int]string, 1)
+		go func() {
+			ctx := context.WithValue(context.Background(), tenantKey{}, tenant)
+			vals, _ := g.DoDefault(ctx, []int{1}, nil...)
+			results <- vals
+		}()
+		return results
+	}
+
+	ast := assert.New(t)
+
+	// without partitions the tenants share the load of the first one
+	g := NewGroup(
+		WithDefaultLoader(loaderOf("default")),
+		WithLoaderResolver[int, string](resolve),
+	)
+	a := call(g, "a")
+	ast.Eventually(func() bool { return g.Len() == 1 }, time.Second, time.Millisecond)
+	b := call(g, "b")
+	ast.Eventually(func() bool { return g.Stats().Waiters == 2 }, time.Second, time.Millisecond)
+	release <- struct{}{}
+	ast.Equal(map[int]string{1: "a1"}, <-a)
+	ast.Equal(map[int]string{1: "a1"}, <-b)
+	def := call(g, "")
+	release <- struct{}{}
+	ast.Equal(map[int]string{1: "default1"}, <-def)
+
+	// partitioned, every tenant loads and caches with its own loader
+	g = NewGroup(
+		WithTTL[int, string](time.Minute),
+		WithLoaderResolver[int, string](resolve),
+		WithContextKeyPartition[int, string](tenantOf),
+	)
+	a = call(g, "a")
+	b = call(g, "b")
+	release <- struct{}{}
+	release <- struct{}{}
+	ast.Equal(map[int]string{1: "a1"}, <-a)
+	ast.Equal(map[int]string{1: "b1"}, <-b)
+	ast.Equal(map[int]string{1: "a1"}, <-call(g, "a"))
+	ast.Equal(map[int]string{1: "b1"}, <-call(g, "b"))
+	ast.Equal(0, g.Len())
+}
+
+func TestPartitionsShareOperations(t *testing.T) {
+	var version, loaded int32
+	loader := countingLoader(&version, &loaded)
+	failing := func(ctx context.Context, keys []int) (map[int]string, error) {
+		t.Errorf("loaded %v", keys)
+		return nil, nil
+	}
+
+	ast := assert.New(t)
+	g := NewGroup(
+		WithTTL[int, string](time.Minute),
+		WithContextKeyPartition[int, string](tenantOf),
+	)
+	ctx := context.WithValue(context.Background(), tenantKey{}, "a")
+	vals, err := g.Do(ctx, []int{1, 2}, loader)
+	ast.Nil(err)
+	ast.Equal(map[int]string{1: "val: 1 v0", 2: "val: 2 v0"}, vals)
+	ast.Equal(uint64(1), g.Stats().Calls)
+	ast.Equal(uint64(2), g.Stats().LoadedKeys)
+	ast.Len(g.Partition("a").Snapshot(), 2)
+	ast.Empty(g.Snapshot())
+
+	// the group's operations reach the partitions
+	g.Invalidate(1)
+	g.Set(1, "set")
+	g.MarkNotFound(2)
+	vals, err = g.Do(ctx, []int{1, 2}, failing)
+	ast.Nil(err)
+	ast.Equal(map[int]string{1: "set"}, vals)
+
+	g.Forget(1)
+	atomic.StoreInt32(&version, 1)
+	vals, err = g.Do(ctx, []int{1}, loader)
+	ast.Nil(err)
+	ast.Equal(map[int]string{1: "val: 1 v1"}, vals)
+
+	g.ForgetAll()
+	ast.Empty(g.Partition("a").Snapshot())
+	g.ResetStats()
+	ast.Zero(g.Stats().Calls)
+}
+
+func TestMaxPartitions(t *testing.T) {
+	var version, loaded int32
+	loader := countingLoader(&version, &loaded)
+	release := make(chan struct{})
+	hung := func(ctx context.Context, keys []int) (map[int]string, error) {
+		<-release
+		return loader(ctx, keys)
+	}
+	tenant := func(name string) context.Context {
+		return context.WithValue(context.Background(), tenantKey{}, name)
+	}
+
+	ast := assert.New(t)
+	g := NewGroup(
+		WithTTL[int, string](time.Minute),
+		WithContextKeyPartition[int, string](tenantOf),
+		WithMaxPartitions[int, string](2),
+	)
+
+	// a partition with keys in flight isn't dropped
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		g.Do(tenant("a"), []int{1}, hung)
+	}()
+	ast.Eventually(func() bool { return g.Partition("a").Len() == 1 }, time.Second, time.Millisecond)
+	_, err := g.Do(tenant("b"), []int{1}, loader)
+	ast.Nil(err)
+	time.Sleep(time.Millisecond)
+	_, err = g.Do(tenant("c"), []int{1}, loader)
+	ast.Nil(err)
+	ast.Equal(1, g.Partition("a").Len())
+	close(release)
+	<-done
+
+	// the least recently called partition is dropped with its cache
+	_, err = g.Do(tenant("a"), []int{1}, loader)
+	ast.Nil(err)
+	ast.Equal(int32(3), atomic.LoadInt32(&loaded))
+	_, err = g.Do(tenant("b"), []int{1}, loader)
+	ast.Nil(err)
+	ast.Equal(int32(4), atomic.LoadInt32(&loaded))
+}
+
+func TestPartitionPinned(t *testing.T) {
+	var version, loaded int32
+	loader := countingLoader(&version, &loaded)
+	tenant := func(name string) context.Context {
+		return context.WithValue(context.Background(), tenantKey{}, name)
+	}
+
+	ast := assert.New(t)
+	g := NewGroup(
+		WithTTL[int, string](time.Minute),
+		WithContextKeyPartition[int, string](tenantOf),
+		WithMaxPartitions[int, string](1),
+	)
+
+	// a partition looked up for a call isn't dropped before the call
+	// registers its keys
+	p := g.partitionOf(tenant("a"))
+	time.Sleep(time.Millisecond)
+	_, err := g.Do(tenant("b"), []int{1}, loader)
+	ast.Nil(err)
+	ast.Same(p, g.Partition("a"))
+
+	// but is once the call is done
+	_, err = p.Do(tenant("a"), []int{1}, loader, pinned)
+	ast.Nil(err)
+	time.Sleep(time.Millisecond)
+	_, err = g.Do(tenant("b"), []int{1}, loader)
+	ast.Nil(err)
+	_, err = g.Do(tenant("c"), []int{1}, loader)
+	ast.Nil(err)
+	ast.NotSame(p, g.Partition("a"))
+}
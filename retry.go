@@ -0,0 +1,59 @@
+package multiflight
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// WithRetry retries failed loader calls up to attempts calls in total,
+// waiting backoff(n) after the n-th failed attempt. Only errors for
+// which retryable returns true are retried; a nil retryable retries all
+// of them and a nil backoff retries right away. ErrCircuitOpen is never
+// retried, whatever retryable says. Waiters stay attached
+// across attempts, and keys answered by an attempt (see
+// WithPartialOnError) are not loaded again. The retries stop when the
+// context of the load is done.
+func WithRetry[K comparable, V any](attempts int, backoff func(attempt int) time.Duration, retryable func(error) bool) Option[K, V] {
+	return func(o *options[K, V]) {
+		o.retryAttempts = attempts
+		o.retryBackoff = backoff
+		o.retryable = retryable
+	}
+}
+
+// retry decides whether to make another attempt after the given failed
+// one, waiting for the backoff. It returns the error to fail the keys
+// with when giving up.
+func (g *Group[K, V]) retry(ctx context.Context, attempt int, err error) error {
+	if attempt >= g.opts.retryAttempts {
+		return err
+	}
+	if errors.Is(err, ErrCircuitOpen) {
+		// the breaker refuses the attempts until its cooldown
+		return err
+	}
+	if g.opts.retryable != nil && !g.opts.retryable(err) {
+		return err
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	if g.opts.retryBackoff == nil {
+		return nil
+	}
+	d := g.opts.retryBackoff(attempt)
+	if d <= 0 {
+		return nil
+	}
+
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
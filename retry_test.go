@@ -0,0 +1,102 @@
+package multiflight
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRetry(t *testing.T) {
+	errTransient := errors.New("transient")
+
+	var mu sync.Mutex
+	var batches [][]int
+	loader := func(ctx context.Context, keys []int) (map[int]string, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		batches = append(batches, keys)
+		switch len(batches) {
+		case 1:
+			return map[int]string{1: "val: 1"}, errTransient
+		case 2:
+			return nil, errTransient
+		default:
+			return map[int]string{2: "val: 2"}, nil
+		}
+	}
+
+	ast := assert.New(t)
+	var backoffs []int
+	g := NewGroup(
+		WithPartialOnError[int, string](),
+		WithRetry[int, string](3, func(attempt int) time.Duration {
+			backoffs = append(backoffs, attempt)
+			return time.Millisecond
+		}, nil),
+	)
+	results, err := g.Do(context.Background(), []int{1, 2, 3}, loader)
+	ast.Nil(err)
+	ast.Equal(map[int]string{1: "val: 1", 2: "val: 2"}, results)
+	// only the keys missing after the partial success are retried
+	ast.Equal([][]int{{1, 2, 3}, {2, 3}, {2, 3}}, batches)
+	ast.Equal([]int{1, 2}, backoffs)
+	ast.Equal(uint64(3), g.Stats().Loads)
+	ast.Equal(0, g.Len())
+}
+
+func TestRetryGivesUp(t *testing.T) {
+	errTransient := errors.New("transient")
+	errFatal := errors.New("fatal")
+
+	var calls int
+	var fail error
+	loader := func(ctx context.Context, keys []int) (map[int]string, error) {
+		calls++
+		return nil, fail
+	}
+
+	ast := assert.New(t)
+	g := NewGroup(WithRetry[int, string](3, nil, func(err error) bool {
+		return errors.Is(err, errTransient)
+	}))
+
+	fail = errTransient
+	_, err := g.Do(context.Background(), []int{1}, loader)
+	ast.ErrorIs(err, errTransient)
+	ast.Equal(3, calls)
+
+	// not retryable
+	calls, fail = 0, errFatal
+	_, err = g.Do(context.Background(), []int{1}, loader)
+	ast.ErrorIs(err, errFatal)
+	ast.Equal(1, calls)
+
+	// the context stops the retries
+	calls, fail = 0, errTransient
+	g = NewGroup(WithRetry[int, string](3, func(int) time.Duration { return time.Hour }, nil))
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+	defer cancel()
+	_, err = g.Do(ctx, []int{1}, loader)
+	ast.ErrorIs(err, context.DeadlineExceeded)
+	ast.Equal(1, calls)
+	ast.Equal(uint64(1), g.Stats().Loads)
+
+	// an open circuit stops the retries, even without retryable
+	calls = 0
+	var backoffs []int
+	g = NewGroup(
+		WithBreaker[int, string](NewConsecutiveBreaker(1, time.Hour)),
+		WithRetry[int, string](3, func(attempt int) time.Duration {
+			backoffs = append(backoffs, attempt)
+			return 0
+		}, nil),
+	)
+	_, err = g.Do(context.Background(), []int{1}, loader)
+	ast.ErrorIs(err, ErrCircuitOpen)
+	ast.Equal(1, calls)
+	ast.Equal([]int{1}, backoffs)
+}
@@ -0,0 +1,89 @@
+package multiflight
+
+import (
+	"context"
+	"fmt"
+	"sync"
+)
+
+// WithRouter routes every key to the loader of WithLoaders at index
+// route(key).
+func WithRouter[K comparable, V any](route func(key K) int) Option[K, V] {
+	return func(o *options[K, V]) {
+		o.router = route
+	}
+}
+
+// WithLoaders routes the keys of the calls given a nil loader, e.g.
+// g.Do(ctx, keys, nil), and of DoDefault: the keys of every batch are
+// split by WithRouter and each of loaders is called with its keys only,
+// concurrently, merging what they return. A batch fails with the first
+// error of the loaders along with the values of the others, which
+// WithPartialOnError keeps. Keys routed out of loaders fail. Without
+// WithRouter, every key goes to the first loader. WithLoaders replaces
+// the default loader of the group, and calls given a nil loader share
+// batch windows like those of the default loader.
+func WithLoaders[K comparable, V any](loaders ...Loader[K, V]) Option[K, V] {
+	return func(o *options[K, V]) {
+		o.loaders = loaders
+	}
+}
+
+// loaderOf returns load, or the loader of WithLoaders for a nil load,
+// identifying it for the batch window unless the call has a batch key.
+func (g *Group[K, V]) loaderOf(load Loader[K, V], co *callOptions) Loader[K, V] {
+	if load != nil || g.opts.routed == nil {
+		return load
+	}
+	if co.source == nil {
+		co.source = g.opts.routed
+	}
+	return *g.opts.routed
+}
+
+// route returns a loader calling loaders with the keys router routes to
+// them.
+func route[K comparable, V any](router func(K) int, loaders []Loader[K, V]) Loader[K, V] {
+	return func(ctx context.Context, keys []K) (map[K]V, error) {
+		routes := make(map[int][]K)
+		for _, key := range keys {
+			r := 0
+			if router != nil {
+				r = router(key)
+			}
+			routes[r] = append(routes[r], key)
+		}
+
+		var (
+			mu       sync.Mutex
+			wg       sync.WaitGroup
+			vals     = make(map[K]V, len(keys))
+			firstErr error
+		)
+		for r, keys := range routes {
+			if r < 0 || r >= len(loaders) {
+				mu.Lock()
+				if firstErr == nil {
+					firstErr = fmt.Errorf("multiflight: no loader for route %d", r)
+				}
+				mu.Unlock()
+				continue
+			}
+			wg.Add(1)
+			go func(load Loader[K, V], keys []K) {
+				defer wg.Done()
+				routed, err := load(ctx, keys)
+				mu.Lock()
+				defer mu.Unlock()
+				for k, v := range routed {
+					vals[k] = v
+				}
+				if err != nil && firstErr == nil {
+					firstErr = err
+				}
+			}(loaders[r], keys)
+		}
+		wg.Wait()
+		return vals, firstErr
+	}
+}
@@ -0,0 +1,82 @@
+package multiflight
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRouter(t *testing.T) {
+	var (
+		mu     sync.Mutex
+		loaded = map[string][]int{}
+	)
+	release := make(chan struct{})
+	loader := func(name string) Loader[int, string] {
+		return func(ctx context.Context, keys []int) (map[int]string, error) {
+			<-release
+			mu.Lock()
+			loaded[name] = append(loaded[name], keys...)
+			mu.Unlock()
+			vals := make(map[int]string, len(keys))
+			for _, k := range keys {
+				vals[k] = fmt.Sprintf("%s: %d", name, k)
+			}
+			return vals, nil
+		}
+	}
+
+	ast := assert.New(t)
+	g := NewGroup(
+		WithRouter[int, string](func(key int) int { return key % 2 }),
+		WithLoaders(loader("even"), loader("odd")),
+	)
+	var wg sync.WaitGroup
+	for _, keys := range [][]int{{1, 2, 3}, {2, 3, 4}, {4, 5}} {
+		wg.Add(1)
+		go func(keys []int) {
+			defer wg.Done()
+			results, err := g.Do(context.Background(), keys, nil)
+			ast.Nil(err)
+			ast.Len(results, len(keys))
+			for _, k := range keys {
+				ast.Equal(map[bool]string{true: "even", false: "odd"}[k%2 == 0]+fmt.Sprintf(": %d", k), results[k])
+			}
+		}(keys)
+	}
+	ast.Eventually(func() bool { return g.Len() == 5 && g.Stats().Waiters == 8 }, time.Second, time.Millisecond)
+	close(release)
+	wg.Wait()
+
+	// every key was loaded once, by the loader of its route
+	for _, keys := range loaded {
+		sort.Ints(keys)
+	}
+	ast.Equal(map[string][]int{"even": {2, 4}, "odd": {1, 3, 5}}, loaded)
+
+	// a failing route fails the batch, unless the values of the other
+	// routes are kept
+	errBoom := errors.New("boom")
+	failing := func(ctx context.Context, keys []int) (map[int]string, error) {
+		return nil, errBoom
+	}
+	g = NewGroup(
+		WithRouter[int, string](func(key int) int { return key % 3 }),
+		WithLoaders(loader("first"), failing),
+		WithPartialOnError[int, string](),
+	)
+	_, err := g.DoDefault(context.Background(), []int{3, 4})
+	ast.ErrorIs(err, errBoom)
+	results, err := g.DoDefault(context.Background(), []int{3, 5})
+	ast.EqualError(err, "multiflight: no loader for route 2")
+	ast.Nil(results)
+	results, err = g.DoDefault(context.Background(), []int{3, 6})
+	ast.Nil(err)
+	ast.Equal(map[int]string{3: "first: 3", 6: "first: 6"}, results)
+}
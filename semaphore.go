@@ -0,0 +1,106 @@
+package multiflight
+
+import (
+	"container/list"
+	"context"
+	"sync"
+)
+
+// WithMaxConcurrentKeys bounds the number of keys being passed to loader
+// calls at the same time to n, so a load of many keys weighs more than a
+// load of a few. A load waits until enough of the budget is free, and a
+// load of more than n keys takes the whole budget, running alone. Loads
+// get the budget in the order they ask for it, so a stream of small
+// loads doesn't starve a large one.
+func WithMaxConcurrentKeys[K comparable, V any](n int) Option[K, V] {
+	return func(o *options[K, V]) {
+		o.maxConcurrentKeys = n
+	}
+}
+
+// weighted is a semaphore of a fixed number of units, handed out in
+// the order they are asked for.
+type weighted struct {
+	size int64
+
+	mu      sync.Mutex
+	cur     int64
+	waiters list.List // of *waiter, the first asked first
+}
+
+// waiter is a call of acquire waiting for units.
+type waiter struct {
+	n     int64
+	ready chan struct{} // closed once the units are taken for the waiter
+}
+
+func newWeighted(size int64) *weighted {
+	return &weighted{size: size}
+}
+
+// acquire takes n units, at most the size of the semaphore, blocking
+// until they are free, after those asked for earlier, or ctx is done.
+// It returns the units taken.
+func (s *weighted) acquire(ctx context.Context, n int64) (int64, error) {
+	if n > s.size {
+		n = s.size
+	}
+	s.mu.Lock()
+	if s.cur+n <= s.size && s.waiters.Len() == 0 {
+		s.cur += n
+		s.mu.Unlock()
+		return n, nil
+	}
+	w := &waiter{n: n, ready: make(chan struct{})}
+	elem := s.waiters.PushBack(w)
+	s.mu.Unlock()
+
+	select {
+	case <-w.ready:
+		return n, nil
+	case <-ctx.Done():
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	select {
+	case <-w.ready:
+		// taken meanwhile, too late to give up
+		return n, nil
+	default:
+	}
+	front := s.waiters.Front() == elem
+	s.waiters.Remove(elem)
+	if front {
+		// the waiters behind may fit now
+		s.notify()
+	}
+	return 0, ctx.Err()
+}
+
+// release returns n units taken by acquire.
+func (s *weighted) release(n int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.cur -= n
+	s.notify()
+}
+
+// notify takes units for the waiters, first come first served, as long
+// as the first one fits. Must be called with s.mu held.
+func (s *weighted) notify() {
+	for {
+		next := s.waiters.Front()
+		if next == nil {
+			return
+		}
+		w := next.Value.(*waiter)
+		if s.cur+w.n > s.size {
+			return
+		}
+		s.cur += w.n
+		s.waiters.Remove(next)
+		close(w.ready)
+	}
+}
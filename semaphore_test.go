@@ -0,0 +1,139 @@
+package multiflight
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMaxConcurrentKeys(t *testing.T) {
+	const MaxKeys = 10
+
+	ast := assert.New(t)
+
+	var running, overBudget int32
+	loader := func(ctx context.Context, keys []int) (map[int]string, error) {
+		n := atomic.AddInt32(&running, int32(len(keys)))
+		defer atomic.AddInt32(&running, -int32(len(keys)))
+		// a batch over the budget runs alone
+		if n > MaxKeys && n > int32(len(keys)) {
+			atomic.AddInt32(&overBudget, 1)
+		}
+		time.Sleep(time.Millisecond * 5)
+
+		resuts := make(map[int]string, len(keys))
+		for _, k := range keys {
+			resuts[k] = fmt.Sprintf("val: %d", k)
+		}
+		return resuts, nil
+	}
+
+	g := NewGroup(WithMaxConcurrentKeys[int, string](MaxKeys))
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// mix single keys, small batches and batches over the budget
+			size := []int{1, 3, 8, 15}[i%4]
+			keys := make([]int, 0, size)
+			for j := 0; j < size; j++ {
+				keys = append(keys, i*100+j)
+			}
+			results, err := g.Do(context.Background(), keys, loader)
+			ast.Nil(err)
+			ast.Len(results, size)
+		}(i)
+	}
+	wg.Wait()
+
+	ast.Equal(int32(0), atomic.LoadInt32(&overBudget))
+	ast.Equal(int32(0), atomic.LoadInt32(&running))
+}
+
+func TestWeighted(t *testing.T) {
+	ast := assert.New(t)
+	s := newWeighted(10)
+
+	n, err := s.acquire(context.Background(), 4)
+	ast.Nil(err)
+	ast.Equal(int64(4), n)
+
+	// a request over the size takes every unit
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*10)
+	defer cancel()
+	_, err = s.acquire(ctx, 20)
+	ast.ErrorIs(err, context.DeadlineExceeded)
+
+	done := make(chan int64)
+	go func() {
+		n, err := s.acquire(context.Background(), 20)
+		ast.Nil(err)
+		done <- n
+	}()
+	s.release(4)
+	ast.Equal(int64(10), <-done)
+}
+
+func TestWeightedFIFO(t *testing.T) {
+	ast := assert.New(t)
+	s := newWeighted(10)
+	_, err := s.acquire(context.Background(), 5)
+	ast.Nil(err)
+
+	// a large request waiting holds off the small ones after it
+	done := make(chan int64)
+	go func() {
+		n, err := s.acquire(context.Background(), 10)
+		ast.Nil(err)
+		done <- n
+	}()
+	ast.Eventually(func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return s.waiters.Len() == 1
+	}, time.Second, time.Millisecond)
+	for i := 0; i < 3; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*5)
+		_, err = s.acquire(ctx, 1)
+		cancel()
+		ast.ErrorIs(err, context.DeadlineExceeded)
+	}
+	s.release(5)
+	ast.Equal(int64(10), <-done)
+
+	// giving up at the front lets the waiters behind that fit through
+	gaveUp := make(chan struct{})
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		_, err := s.acquire(ctx, 10)
+		ast.ErrorIs(err, context.Canceled)
+		close(gaveUp)
+	}()
+	ast.Eventually(func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return s.waiters.Len() == 1
+	}, time.Second, time.Millisecond)
+	s.release(5)
+	got := make(chan int64)
+	go func() {
+		n, err := s.acquire(context.Background(), 5)
+		ast.Nil(err)
+		got <- n
+	}()
+	ast.Eventually(func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return s.waiters.Len() == 2
+	}, time.Second, time.Millisecond)
+	cancel()
+	<-gaveUp
+	ast.Equal(int64(5), <-got)
+}
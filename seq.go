@@ -0,0 +1,112 @@
+//go:build go1.23
+
+package multiflight
+
+import (
+	"context"
+	"errors"
+	"iter"
+)
+
+// DoSeq is like Do but returns a sequence yielding every key as soon as
+// its value is there, cached values first, so callers can process values
+// while the other keys are loading. Keys not found are skipped. An error
+// ends the sequence: a failing key is yielded with its error, and an
+// error failing the whole call, ctx ending or ErrFollowerTimeout
+// included, with the zero key. Breaking out of the loop stops waiting
+// for the keys left, whose loads go on for the other callers and the
+// cache. Every range over the sequence is a call of its own.
+func (g *Group[K, V]) DoSeq(ctx context.Context, keys []K, load Loader[K, V], opts ...CallOption) iter.Seq2[K, Result[V]] {
+	return func(yield func(K, Result[V]) bool) {
+		// look the partition up for every range, each pinning it
+		if p := g.partitionOf(ctx); p != g {
+			p.DoSeq(ctx, keys, load, append([]CallOption{pinned}, opts...)...)(yield)
+			return
+		}
+		co := newCallOptions(opts)
+		load := g.loaderOf(load, &co)
+		var zero K
+		c, err := g.begin(ctx, keys, load.batch(), co)
+		if err != nil {
+			yield(zero, Result[V]{Err: err})
+			return
+		}
+		defer g.leave(c)
+		if len(c.missEnts) > 0 {
+			if g.opts.batchWindow > 0 {
+				g.enqueue(ctx, c.missEnts, load.batch(), co.source, co.priority)
+			} else {
+				go g.runLoad(ctx, c.missEnts, load.batch())
+			}
+		}
+
+		for k, v := range c.result {
+			if !yield(k, Result[V]{Val: v}) {
+				return
+			}
+		}
+
+		// forward the entries as they complete until the range ends
+		stop := make(chan struct{})
+		defer close(stop)
+		done := make(chan *ent[K, V])
+		for _, e := range c.ents {
+			go func(e *ent[K, V]) {
+				select {
+				case <-e.done:
+					select {
+					case done <- e:
+					case <-stop:
+					}
+				case <-stop:
+				}
+			}(e)
+		}
+		own := make(map[*ent[K, V]]struct{}, len(c.missEnts))
+		for _, e := range c.missEnts {
+			own[e] = struct{}{}
+		}
+		followers := len(c.ents) - len(c.missEnts) // entries of other callers left
+		follow, cancel := g.followerContext(ctx, c)
+		defer cancel()
+		timeout := follow.Done()
+		for left := len(c.ents); left > 0; {
+			var e *ent[K, V]
+			select {
+			case e = <-done:
+			case <-ctx.Done():
+				yield(zero, Result[V]{Err: ctx.Err()})
+				return
+			case <-timeout:
+				if followers > 0 && ctx.Err() == nil {
+					yield(zero, Result[V]{Err: ErrFollowerTimeout})
+					return
+				}
+				timeout = nil
+				continue
+			}
+			left--
+			if _, leader := own[e]; !leader {
+				followers--
+			}
+			if errors.Is(e.err, errResultNotFound) {
+				continue
+			}
+			if e.err != nil {
+				yield(e.key, Result[V]{Err: e.err})
+				return
+			}
+			if !yield(e.key, Result[V]{Val: e.val}) {
+				return
+			}
+		}
+
+		if len(c.shed) > 0 {
+			yield(c.shed[0], Result[V]{Err: &KeysError[K]{Keys: c.shed, Err: ErrShed}})
+			return
+		}
+		if len(c.rejected) > 0 {
+			yield(c.rejected[0], Result[V]{Err: &KeysError[K]{Keys: c.rejected, Err: ErrTooManyWaiters}})
+		}
+	}
+}
@@ -0,0 +1,79 @@
+//go:build go1.23
+
+package multiflight
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDoSeq(t *testing.T) {
+	errBoom := errors.New("boom")
+	release := map[int]chan struct{}{}
+	for i := 1; i <= 5; i++ {
+		release[i] = make(chan struct{})
+	}
+	loader := func(ctx context.Context, keys []int) (map[int]string, error) {
+		<-release[keys[0]]
+		switch keys[0] {
+		case 3:
+			return nil, nil
+		case 4:
+			return nil, errBoom
+		}
+		return map[int]string{keys[0]: fmt.Sprint(keys[0])}, nil
+	}
+
+	ast := assert.New(t)
+	g := NewGroup(WithTTL[int, string](time.Minute), WithMaxBatchSize[int, string](1))
+	g.Set(0, "cached")
+
+	// values come cached first, then as they are loaded, and the first
+	// error ends the sequence
+	var got []int
+	for k, r := range g.DoSeq(context.Background(), []int{0, 1, 2, 3, 4}, loader) {
+		got = append(got, k)
+		switch k {
+		case 0:
+			ast.Equal("cached", r.Val)
+			close(release[2])
+		case 2:
+			ast.Equal("2", r.Val)
+			close(release[3])
+			close(release[1])
+		case 1:
+			ast.Nil(r.Err)
+			close(release[4])
+		case 4:
+			ast.ErrorIs(r.Err, errBoom)
+		}
+	}
+	ast.Equal([]int{0, 2, 1, 4}, got)
+	ast.Eventually(func() bool { return g.Len() == 0 }, time.Second, time.Millisecond)
+	ast.Equal(int64(0), g.Stats().Waiters)
+
+	// breaking out stops waiting while the load goes on
+	for k := range g.DoSeq(context.Background(), []int{1, 5}, loader) {
+		ast.Equal(1, k)
+		break
+	}
+	ast.Equal(1, g.Len())
+	ast.Equal(int64(0), g.Stats().Waiters)
+	close(release[5])
+	ast.Eventually(func() bool { return g.Len() == 0 }, time.Second, time.Millisecond)
+	vals, _ := g.TryDo(context.Background(), []int{5})
+	ast.Equal(map[int]string{5: "5"}, vals)
+
+	// a canceled call yields its error with the zero key
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	for k, r := range g.DoSeq(ctx, []int{6}, loader) {
+		ast.Equal(0, k)
+		ast.ErrorIs(r.Err, context.Canceled)
+	}
+}
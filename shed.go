@@ -0,0 +1,74 @@
+package multiflight
+
+import (
+	"errors"
+	"sync/atomic"
+	"time"
+)
+
+// ErrShed is reported for keys the load shedding policy refused to load.
+var ErrShed = errors.New("multiflight: load shed")
+
+// ShedState is the load of a group when a call brings new keys.
+type ShedState struct {
+	// InFlightKeys is the number of keys being loaded.
+	InFlightKeys int
+	// NewKeys is the number of keys the call would start loading.
+	NewKeys int
+	// PendingKeys is the number of keys queued in the batch window.
+	PendingKeys int
+	// LoadLatency is a moving average of the loader call latency.
+	LoadLatency time.Duration
+}
+
+// ShedPolicy decides whether the group is too busy to take new keys.
+type ShedPolicy interface {
+	// Shed reports whether to reject the new keys of a call.
+	Shed(s ShedState) bool
+}
+
+// ShedFunc adapts a function to a ShedPolicy.
+type ShedFunc func(s ShedState) bool
+
+// Shed implements ShedPolicy.
+func (f ShedFunc) Shed(s ShedState) bool {
+	return f(s)
+}
+
+// HighWaterMark sheds new keys that would bring the number of in-flight
+// keys above n.
+func HighWaterMark(n int) ShedPolicy {
+	return ShedFunc(func(s ShedState) bool {
+		return s.InFlightKeys+s.NewKeys > n
+	})
+}
+
+// WithLoadShedding consults policy whenever a call would start loading
+// keys. When it sheds, the keys the call would have loaded fail right
+// away: Do serves the other keys, which join loads already in flight or
+// come from the cache, and returns a *KeysError wrapping ErrShed listing
+// the rejected ones. Unlike WithMaxInFlightKeys it never blocks.
+func WithLoadShedding[K comparable, V any](policy ShedPolicy) Option[K, V] {
+	return func(o *options[K, V]) {
+		o.shedPolicy = policy
+	}
+}
+
+// shouldShed asks the shedding policy about the new keys among keys.
+// Must be called with g.mu held.
+func (g *Group[K, V]) shouldShed(keys []K, refresh bool) bool {
+	if g.opts.shedPolicy == nil {
+		return false
+	}
+
+	n := g.countNew(keys, refresh)
+	if n == 0 {
+		return false
+	}
+	return g.opts.shedPolicy.Shed(ShedState{
+		InFlightKeys: len(g.m),
+		NewKeys:      n,
+		PendingKeys:  len(g.queue),
+		LoadLatency:  time.Duration(atomic.LoadInt64(&g.stats.latency)),
+	})
+}
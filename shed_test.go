@@ -0,0 +1,81 @@
+package multiflight
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadShedding(t *testing.T) {
+	const WorkerNum = 50
+
+	release := make(chan struct{})
+	loader := func(ctx context.Context, keys []int) (map[int]string, error) {
+		<-release
+		resuts := make(map[int]string, len(keys))
+		for _, k := range keys {
+			resuts[k] = fmt.Sprintf("val: %d", k)
+		}
+		return resuts, nil
+	}
+
+	ast := assert.New(t)
+	g := NewGroup(WithLoadShedding[int, string](HighWaterMark(10)))
+
+	var shed int32
+	wg := sync.WaitGroup{}
+	for i := 0; i < WorkerNum; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			// key 0 is shared by every worker
+			keys := []int{0, i*2 + 1, i*2 + 2}
+			results, err := g.Do(context.Background(), keys, loader)
+			if err == nil {
+				ast.Len(results, len(keys))
+				return
+			}
+
+			ast.ErrorIs(err, ErrShed)
+			var keysErr *KeysError[int]
+			ast.True(errors.As(err, &keysErr))
+			atomic.AddInt32(&shed, int32(len(keysErr.Keys)))
+			for _, key := range keys {
+				_, has := results[key]
+				ast.NotEqual(has, contains(keysErr.Keys, key))
+			}
+		}(i)
+	}
+
+	ast.Eventually(func() bool {
+		stats := g.Stats()
+		return uint64(stats.Waiters)+stats.Shed == WorkerNum*3
+	}, time.Second, time.Millisecond)
+	ast.LessOrEqual(g.Len(), 10)
+	close(release)
+	wg.Wait()
+
+	stats := g.Stats()
+	ast.Greater(stats.Shed, uint64(0))
+	ast.Equal(uint64(atomic.LoadInt32(&shed)), stats.Shed)
+	ast.Equal(0, g.Len())
+
+	// the group takes new keys again
+	_, err := g.Do(context.Background(), []int{1000}, loader)
+	ast.Nil(err)
+}
+
+func contains(keys []int, key int) bool {
+	for _, k := range keys {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,118 @@
+package multiflight
+
+import (
+	"context"
+	"sync"
+)
+
+// SingleOption configures the Loader built by FromSingle.
+type SingleOption func(*singleOptions)
+
+type singleOptions struct {
+	concurrency int
+	notFound    func(error) bool
+}
+
+// WithSingleConcurrency runs up to n per-key calls concurrently.
+// n <= 1 runs them one after another, which is the default.
+func WithSingleConcurrency(n int) SingleOption {
+	return func(o *singleOptions) {
+		o.concurrency = n
+	}
+}
+
+// WithSingleNotFound reports whether an error returned for a key means
+// the key doesn't exist. Such keys are left out of the result instead
+// of failing the whole batch.
+func WithSingleNotFound(isNotFound func(error) bool) SingleOption {
+	return func(o *singleOptions) {
+		o.notFound = isNotFound
+	}
+}
+
+// FromSingle adapts a per-key function to a Loader by calling fn once
+// for every key of the batch. The first error that is not a not-found
+// error fails the batch, and per-key calls that haven't started yet are
+// skipped.
+func FromSingle[K comparable, V any](fn func(ctx context.Context, key K) (V, error), opts ...SingleOption) Loader[K, V] {
+	o := singleOptions{}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	if o.concurrency <= 1 {
+		return func(ctx context.Context, keys []K) (map[K]V, error) {
+			vals := make(map[K]V, len(keys))
+			for _, key := range keys {
+				v, err := fn(ctx, key)
+				if err != nil {
+					if o.notFound != nil && o.notFound(err) {
+						continue
+					}
+					return nil, err
+				}
+				vals[key] = v
+			}
+			return vals, nil
+		}
+	}
+
+	return func(ctx context.Context, keys []K) (map[K]V, error) {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		var (
+			mu       sync.Mutex // protects vals and firstErr
+			vals     = make(map[K]V, len(keys))
+			firstErr error
+			wg       sync.WaitGroup
+			sem      = make(chan struct{}, o.concurrency)
+		)
+
+		dispatched := 0
+		for _, key := range keys {
+			select {
+			case sem <- struct{}{}:
+			case <-ctx.Done():
+			}
+			if ctx.Err() != nil {
+				break
+			}
+			dispatched++
+
+			wg.Add(1)
+			go func(key K) {
+				defer func() {
+					<-sem
+					wg.Done()
+				}()
+
+				v, err := fn(ctx, key)
+
+				mu.Lock()
+				defer mu.Unlock()
+				if err != nil {
+					if o.notFound != nil && o.notFound(err) {
+						return
+					}
+					if firstErr == nil {
+						firstErr = err
+						cancel()
+					}
+					return
+				}
+				vals[key] = v
+			}(key)
+		}
+		wg.Wait()
+
+		if firstErr != nil {
+			return nil, firstErr
+		}
+		// the parent context ended before every key was dispatched
+		if dispatched < len(keys) {
+			return nil, ctx.Err()
+		}
+		return vals, nil
+	}
+}
@@ -0,0 +1,89 @@
+package multiflight
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFromSingle(t *testing.T) {
+	errNotFound := errors.New("not found")
+	fn := func(ctx context.Context, key int) (string, error) {
+		if key%2 == 1 {
+			return "", errNotFound
+		}
+		return fmt.Sprintf("val: %d", key), nil
+	}
+
+	ast := assert.New(t)
+	load := FromSingle(fn, WithSingleNotFound(func(err error) bool {
+		return errors.Is(err, errNotFound)
+	}))
+	vals, err := load(context.Background(), []int{1, 2, 3, 4})
+	ast.Nil(err)
+	ast.Equal(map[int]string{2: "val: 2", 4: "val: 4"}, vals)
+
+	// without the predicate not found is a plain error
+	vals, err = FromSingle(fn)(context.Background(), []int{2, 3})
+	ast.ErrorIs(err, errNotFound)
+	ast.Nil(vals)
+}
+
+func TestFromSingleConcurrency(t *testing.T) {
+	const Concurrency = 4
+
+	var running, maxRunning int32
+	fn := func(ctx context.Context, key int) (string, error) {
+		n := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			m := atomic.LoadInt32(&maxRunning)
+			if n <= m || atomic.CompareAndSwapInt32(&maxRunning, m, n) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond * 5)
+		return fmt.Sprintf("val: %d", key), nil
+	}
+
+	keys := make([]int, 0, 20)
+	for i := 0; i < 20; i++ {
+		keys = append(keys, i)
+	}
+
+	ast := assert.New(t)
+	vals, err := FromSingle(fn, WithSingleConcurrency(Concurrency))(context.Background(), keys)
+	ast.Nil(err)
+	ast.Len(vals, len(keys))
+	ast.LessOrEqual(atomic.LoadInt32(&maxRunning), int32(Concurrency))
+	ast.Greater(atomic.LoadInt32(&maxRunning), int32(1))
+}
+
+func TestFromSingleConcurrentError(t *testing.T) {
+	errBoom := errors.New("boom")
+
+	var calls int32
+	fn := func(ctx context.Context, key int) (string, error) {
+		atomic.AddInt32(&calls, 1)
+		if key == 0 {
+			return "", errBoom
+		}
+		select {
+		case <-ctx.Done():
+			return "", ctx.Err()
+		case <-time.After(time.Second):
+			return fmt.Sprintf("val: %d", key), nil
+		}
+	}
+
+	ast := assert.New(t)
+	vals, err := FromSingle(fn, WithSingleConcurrency(2))(context.Background(), []int{0, 1, 2, 3, 4, 5})
+	ast.ErrorIs(err, errBoom)
+	ast.Nil(vals)
+	ast.Less(atomic.LoadInt32(&calls), int32(6))
+}
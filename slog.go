@@ -0,0 +1,90 @@
+//go:build go1.21
+
+package multiflight
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+// WithLogger logs the work of the group to l: loader calls dispatched
+// and completed at the debug level, loader calls failing or given up on
+// past WithLoadTimeout at the warn level, and calls that stop waiting
+// for keys at the debug level. Events filtered out by the level of l
+// cost next to nothing. Keys are only counted unless WithLogKeys says
+// how to log them.
+func WithLogger[K comparable, V any](l *slog.Logger) Option[K, V] {
+	return func(o *options[K, V]) {
+		slogOf(o).logger = l
+	}
+}
+
+// WithLogKeys logs the keys of the events of WithLogger as key returns
+// them, e.g. hashed or truncated so that sensitive IDs aren't logged.
+func WithLogKeys[K comparable, V any](key func(K) slog.Value) Option[K, V] {
+	return func(o *options[K, V]) {
+		slogOf(o).key = key
+	}
+}
+
+// slogOf returns the slog event log of o, setting it up if needed.
+func slogOf[K comparable, V any](o *options[K, V]) *slogLog[K] {
+	l, ok := o.log.(*slogLog[K])
+	if !ok {
+		l = &slogLog[K]{}
+		o.log = l
+	}
+	return l
+}
+
+// slogLog logs the events of a group with slog.
+type slogLog[K comparable] struct {
+	logger *slog.Logger
+	key    func(K) slog.Value
+}
+
+// log logs msg at level with attrs, along with keys.
+func (l *slogLog[K]) log(ctx context.Context, level slog.Level, msg string, keys []K, attrs ...slog.Attr) {
+	if l.logger == nil || !l.logger.Enabled(ctx, level) {
+		return
+	}
+	if id, ok := BatchIDFromContext(ctx); ok {
+		attrs = append(attrs, slog.Uint64("batch", id))
+	}
+	attrs = append(attrs, slog.Int("size", len(keys)))
+	if l.key != nil {
+		vals := make([]any, 0, len(keys))
+		for _, k := range keys {
+			vals = append(vals, l.key(k).Any())
+		}
+		attrs = append(attrs, slog.Any("keys", vals))
+	}
+	l.logger.LogAttrs(ctx, level, msg, attrs...)
+}
+
+func (l *slogLog[K]) dispatched(ctx context.Context, keys []K, trigger string) {
+	l.log(ctx, slog.LevelDebug, "multiflight: batch dispatched", keys, slog.String("trigger", trigger))
+}
+
+func (l *slogLog[K]) completed(ctx context.Context, keys []K, d time.Duration, found, missing int) {
+	l.log(ctx, slog.LevelDebug, "multiflight: batch completed", keys,
+		slog.Duration("duration", d), slog.Int("found", found), slog.Int("missing", missing))
+}
+
+func (l *slogLog[K]) failed(ctx context.Context, keys []K, d time.Duration, err error) {
+	l.log(ctx, slog.LevelWarn, "multiflight: batch failed", keys,
+		slog.Duration("duration", d), slog.Any("error", err))
+}
+
+func (l *slogLog[K]) stuck(ctx context.Context, keys []K, d time.Duration) {
+	l.log(ctx, slog.LevelWarn, "multiflight: batch stuck", keys, slog.Duration("duration", d))
+}
+
+func (l *slogLog[K]) logsCanceled(ctx context.Context) bool {
+	return l.logger != nil && l.logger.Enabled(ctx, slog.LevelDebug)
+}
+
+func (l *slogLog[K]) canceled(ctx context.Context, keys []K, err error) {
+	l.log(ctx, slog.LevelDebug, "multiflight: waiter canceled", keys, slog.Any("error", err))
+}
@@ -0,0 +1,133 @@
+//go:build go1.21
+
+package multiflight
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// syncBuffer is a bytes.Buffer safe for concurrent use.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+// records returns the logged records without their time, and resets b.
+func (b *syncBuffer) records(t *testing.T) []map[string]any {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var records []map[string]any
+	for _, line := range strings.Split(strings.TrimSpace(b.buf.String()), "\n") {
+		if line == "" {
+			continue
+		}
+		r := map[string]any{}
+		assert.NoError(t, json.Unmarshal([]byte(line), &r))
+		delete(r, "time")
+		delete(r, "duration")
+		records = append(records, r)
+	}
+	b.buf.Reset()
+	return records
+}
+
+func TestLogger(t *testing.T) {
+	errBoom := errors.New("boom")
+	release, hung := make(chan struct{}), make(chan struct{})
+	defer close(hung)
+	loader := func(ctx context.Context, keys []int) (map[int]string, error) {
+		switch keys[0] {
+		case 3:
+			return nil, errBoom
+		case 4:
+			<-hung
+		case 5:
+			<-release
+		}
+		return map[int]string{1: "val: 1", 5: "val: 5"}, nil
+	}
+	var formatted int32
+	key := func(k int) slog.Value {
+		atomic.AddInt32(&formatted, 1)
+		return slog.StringValue(fmt.Sprintf("key-%d", k))
+	}
+
+	ast := assert.New(t)
+	buf := &syncBuffer{}
+	logger := slog.New(slog.NewJSONHandler(buf, &slog.HandlerOptions{Level: slog.LevelDebug}))
+	g := NewGroup(
+		WithLogger[int, string](logger),
+		WithLogKeys[int, string](key),
+		WithLoadTimeout[int, string](time.Millisecond*10),
+	)
+
+	g.Do(context.Background(), []int{1, 2}, loader)
+	ast.Equal([]map[string]any{
+		{"level": "DEBUG", "msg": "multiflight: batch dispatched", "trigger": "call", "size": 2.0, "batch": 1.0, "keys": []any{"key-1", "key-2"}},
+		{"level": "DEBUG", "msg": "multiflight: batch completed", "found": 1.0, "missing": 1.0, "size": 2.0, "batch": 1.0, "keys": []any{"key-1", "key-2"}},
+	}, buf.records(t))
+
+	g.Do(context.Background(), []int{3}, loader)
+	ast.Equal([]map[string]any{
+		{"level": "DEBUG", "msg": "multiflight: batch dispatched", "trigger": "call", "size": 1.0, "batch": 2.0, "keys": []any{"key-3"}},
+		{"level": "WARN", "msg": "multiflight: batch failed", "error": "boom", "size": 1.0, "batch": 2.0, "keys": []any{"key-3"}},
+	}, buf.records(t))
+
+	g.Do(context.Background(), []int{4}, loader)
+	ast.Equal([]map[string]any{
+		{"level": "DEBUG", "msg": "multiflight: batch dispatched", "trigger": "call", "size": 1.0, "batch": 3.0, "keys": []any{"key-4"}},
+		{"level": "WARN", "msg": "multiflight: batch stuck", "size": 1.0, "batch": 3.0, "keys": []any{"key-4"}},
+		{"level": "WARN", "msg": "multiflight: batch failed", "error": "multiflight: load timed out after 10ms", "size": 1.0, "batch": 3.0, "keys": []any{"key-4"}},
+	}, buf.records(t))
+
+	// a call waiting for the load of another one gives up
+	leader := make(chan struct{})
+	go func() {
+		defer close(leader)
+		g.Do(context.Background(), []int{5}, loader)
+	}()
+	ast.Eventually(func() bool { return g.Len() == 1 }, time.Second, time.Millisecond)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond)
+	defer cancel()
+	_, err := g.Do(ctx, []int{5}, loader)
+	ast.ErrorIs(err, context.DeadlineExceeded)
+	ast.Contains(buf.records(t), map[string]any{
+		"level": "DEBUG", "msg": "multiflight: waiter canceled", "error": "context deadline exceeded", "size": 1.0, "keys": []any{"key-5"},
+	})
+	close(release)
+	<-leader
+	ast.Equal("multiflight: batch completed", buf.records(t)[0]["msg"])
+
+	// filtered out events don't format keys
+	logger = slog.New(slog.NewJSONHandler(buf, &slog.HandlerOptions{Level: slog.LevelError}))
+	g = NewGroup(
+		WithLogKeys[int, string](key),
+		WithLogger[int, string](logger),
+		WithLoadTimeout[int, string](time.Millisecond),
+	)
+	atomic.StoreInt32(&formatted, 0)
+	g.Do(context.Background(), []int{1, 2}, loader)
+	g.Do(context.Background(), []int{3}, loader)
+	g.Do(context.Background(), []int{4}, loader)
+	ast.Empty(buf.records(t))
+	ast.Equal(int32(0), atomic.LoadInt32(&formatted))
+	ast.False(g.opts.log.logsCanceled(context.Background()))
+}
@@ -0,0 +1,38 @@
+package multiflight
+
+import "time"
+
+// WithSlowLoadThreshold calls report with the keys of every loader call
+// still running d after it started, once with the time elapsed then and
+// again with its final duration once it returns, e.g. to alert on a
+// degrading backend before loads time out. Loader calls returning within
+// d aren't reported.
+func WithSlowLoadThreshold[K comparable, V any](d time.Duration, report func(keys []K, elapsed time.Duration)) Option[K, V] {
+	return func(o *options[K, V]) {
+		o.slowThreshold = d
+		o.onSlow = report
+	}
+}
+
+// watchSlow reports the loader call of keys started at start if it runs
+// past the slow load threshold, and returns the function to call with
+// its duration once it returns, nil without a threshold.
+func (g *Group[K, V]) watchSlow(keys []K, start time.Time) func(d time.Duration) {
+	threshold, report := g.opts.slowThreshold, g.opts.onSlow
+	if threshold <= 0 || report == nil {
+		return nil
+	}
+
+	crossed := make(chan struct{})
+	t := time.AfterFunc(threshold, func() {
+		defer close(crossed)
+		report(keys, time.Since(start))
+	})
+	return func(d time.Duration) {
+		if t.Stop() {
+			return // returned in time
+		}
+		<-crossed
+		report(keys, d)
+	}
+}
@@ -0,0 +1,64 @@
+package multiflight
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSlowLoadThreshold(t *testing.T) {
+	type report struct {
+		keys    []int
+		elapsed time.Duration
+	}
+	var (
+		mu      sync.Mutex
+		reports []report
+	)
+	release := make(chan struct{})
+	loader := func(ctx context.Context, keys []int) (map[int]string, error) {
+		if keys[0] == 2 {
+			<-release
+		}
+		return nil, nil
+	}
+
+	ast := assert.New(t)
+	g := NewGroup(WithSlowLoadThreshold[int, string](time.Millisecond*10, func(keys []int, elapsed time.Duration) {
+		mu.Lock()
+		defer mu.Unlock()
+		reports = append(reports, report{keys: keys, elapsed: elapsed})
+	}))
+	reported := func() []report {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]report(nil), reports...)
+	}
+
+	// fast loads aren't reported
+	_, err := g.Do(context.Background(), []int{1}, loader)
+	ast.Nil(err)
+	time.Sleep(time.Millisecond * 20)
+	ast.Empty(reported())
+
+	// slow loads are reported once past the threshold and once done
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		g.Do(context.Background(), []int{2, 3}, loader)
+	}()
+	ast.Eventually(func() bool { return len(reported()) == 1 }, time.Second, time.Millisecond)
+	time.Sleep(time.Millisecond * 20)
+	close(release)
+	<-done
+	r := reported()
+	if ast.Len(r, 2) {
+		ast.Equal([]int{2, 3}, r[0].keys)
+		ast.Equal([]int{2, 3}, r[1].keys)
+		ast.GreaterOrEqual(r[0].elapsed, time.Millisecond*10)
+		ast.GreaterOrEqual(r[1].elapsed, time.Millisecond*30)
+	}
+}
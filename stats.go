@@ -0,0 +1,428 @@
+package multiflight
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// defaultErrorWindow is the number of load outcomes ErrorRate covers
+// without WithErrorWindow.
+const defaultErrorWindow = 100
+
+// defaultBatchBuckets are the bounds of the buckets of
+// Stats.BatchSizes without WithBatchBuckets.
+var defaultBatchBuckets = []int{1, 2, 4, 8, 16, 32, 64, 128, 256, 512, 1024}
+
+// DefaultBatchBuckets returns the bounds of the buckets of
+// Stats.BatchSizes without WithBatchBuckets.
+func DefaultBatchBuckets() []int {
+	return append([]int(nil), defaultBatchBuckets...)
+}
+
+// WithBatchBuckets sets the bounds of the buckets of Stats.BatchSizes,
+// in ascending order.
+func WithBatchBuckets[K comparable, V any](bounds ...int) Option[K, V] {
+	return func(o *options[K, V]) {
+		o.batchBuckets = append([]int(nil), bounds...)
+	}
+}
+
+// WithErrorWindow computes ErrorRate, and the error rate WithCircuitBreaker
+// opens at, over the last n loader calls.
+func WithErrorWindow[K comparable, V any](n int) Option[K, V] {
+	return func(o *options[K, V]) {
+		o.errorWindow = n
+	}
+}
+
+// Stats is a snapshot of the counters of a Group.
+type Stats struct {
+	// Calls counts the calls loading keys, e.g. Do.
+	Calls uint64
+	// Keys counts the keys these calls asked for.
+	Keys uint64
+	// SharedKeys counts the keys that joined loads in flight, the hits
+	// of deduplication as opposed to those of the caches.
+	SharedKeys uint64
+	// CacheHits counts the keys served from the caches.
+	CacheHits uint64
+	// CacheMisses counts the keys served neither from the caches nor
+	// from loads in flight, which started loads. Keys rejected, e.g. with
+	// ErrShed, are neither hits nor misses.
+	CacheMisses uint64
+	// LoadedKeys counts the keys loaded with a value.
+	LoadedKeys uint64
+	// FetchedKeys counts the keys asked to the loader, found or not,
+	// once per load whatever its retries.
+	FetchedKeys uint64
+	// AttemptedKeys counts the keys asked to the loader by every
+	// attempt, retries included.
+	AttemptedKeys uint64
+	// NotFound counts the keys loaded and not found.
+	NotFound uint64
+	// Errors counts the keys that failed to load.
+	Errors uint64
+	// Waiters is the number of callers currently waiting on keys.
+	Waiters int64
+	// MaxKeyWaiters is the largest number of callers currently waiting
+	// on a single key.
+	MaxKeyWaiters int64
+	// RejectedWaiters counts keys rejected with ErrTooManyWaiters.
+	RejectedWaiters uint64
+	// Loads counts loader calls, retries and hedges included.
+	Loads uint64
+	// Hedges counts the hedged loader calls.
+	Hedges uint64
+	// Shed counts keys rejected with ErrShed.
+	Shed uint64
+	// LoadLatency is a moving average of the loader call latency.
+	LoadLatency time.Duration
+	// Evictions counts the results evicted from the cache by WithLRU.
+	Evictions uint64
+	// Swept counts the expired results removed from the cache by the
+	// janitor.
+	Swept uint64
+	// ErrorRate is the fraction of the recent loader calls that failed.
+	ErrorRate float64
+	// BatchSizes counts the loader calls by number of keys.
+	BatchSizes BatchHistogram
+}
+
+// DedupRatio returns the keys asked for per key fetched from the loader,
+// what coalescing and caching save: 1 without any, 4 when only one key
+// in four is fetched. It is 0 without keys asked for and +Inf if none
+// was fetched. ResetStats starts a new window.
+func (s Stats) DedupRatio() float64 {
+	if s.Keys == 0 {
+		return 0
+	}
+	return float64(s.Keys) / float64(s.FetchedKeys)
+}
+
+// BatchHistogram counts loader calls by number of keys, e.g. to check
+// that WithBatchWindow coalesces keys.
+type BatchHistogram struct {
+	// Bounds are the inclusive upper bounds of the buckets.
+	Bounds []int
+	// Counts are the loader calls in each bucket, with one more bucket
+	// for the calls larger than the last bound.
+	Counts []uint64
+	// Max is the largest number of keys of a loader call.
+	Max int
+}
+
+// Quantile returns the bound of the bucket holding the quantile q of the
+// loader call sizes, e.g. 0.5 for the median, or Max beyond the bounds.
+// It is 0 without loader calls.
+func (h BatchHistogram) Quantile(q float64) int {
+	var total uint64
+	for _, n := range h.Counts {
+		total += n
+	}
+	if total == 0 {
+		return 0
+	}
+
+	rank := uint64(math.Ceil(q * float64(total)))
+	if rank == 0 {
+		rank = 1
+	}
+	var seen uint64
+	for i, n := range h.Counts {
+		if seen += n; seen >= rank {
+			if i < len(h.Bounds) {
+				return h.Bounds[i]
+			}
+			break
+		}
+	}
+	return h.Max
+}
+
+// stats holds the live counters of a Group, updated atomically.
+type stats struct {
+	calls           uint64
+	keys            uint64
+	sharedKeys      uint64
+	cacheHits       uint64
+	cacheMisses     uint64
+	loadedKeys      uint64
+	fetchedKeys     uint64
+	attemptedKeys   uint64
+	notFound        uint64
+	errors          uint64
+	waiters         int64
+	rejectedWaiters uint64
+	loads           uint64
+	hedges          uint64
+	shed            uint64
+	latency         int64 // moving average in nanoseconds
+	outcomes        outcomes
+	batchSizes      sizes
+}
+
+// sizes is a histogram of the loader call sizes.
+type sizes struct {
+	mu     sync.Mutex // protects the fields below
+	counts []uint64   // by bucket, allocated on the first call
+	max    int
+}
+
+// record adds the size of a loader call to the bucket of bounds it
+// falls in.
+func (s *sizes) record(bounds []int, size int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.counts == nil {
+		s.counts = make([]uint64, len(bounds)+1)
+	}
+	s.counts[sort.SearchInts(bounds, size)]++
+	if size > s.max {
+		s.max = size
+	}
+}
+
+// histogram returns a copy of the histogram with bounds.
+func (s *sizes) histogram(bounds []int) BatchHistogram {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	h := BatchHistogram{Bounds: append([]int(nil), bounds...), Counts: make([]uint64, len(bounds)+1), Max: s.max}
+	copy(h.Counts, s.counts)
+	return h
+}
+
+// reset empties the histogram.
+func (s *sizes) reset() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.counts, s.max = nil, 0
+}
+
+// outcomes is a ring of the last loader call outcomes.
+type outcomes struct {
+	mu       sync.Mutex // protects the fields below
+	failed   []bool     // allocated on the first call
+	next     int
+	n        int // number of outcomes in the ring
+	failures int // number of failed outcomes in the ring
+}
+
+// record adds the outcome of a loader call to a ring of size outcomes.
+func (o *outcomes) record(size int, failed bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.failed == nil {
+		o.failed = make([]bool, size)
+	}
+	if o.n == len(o.failed) {
+		if o.failed[o.next] {
+			o.failures--
+		}
+	} else {
+		o.n++
+	}
+	o.failed[o.next] = failed
+	if failed {
+		o.failures++
+	}
+	o.next = (o.next + 1) % len(o.failed)
+}
+
+// full reports whether the ring holds as many outcomes as it can.
+func (o *outcomes) full() bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.n > 0 && o.n == len(o.failed)
+}
+
+// reset empties the ring.
+func (o *outcomes) reset() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.next, o.n, o.failures = 0, 0, 0
+}
+
+// rate returns the fraction of failed outcomes in the ring, 0 if empty.
+func (o *outcomes) rate() float64 {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.n == 0 {
+		return 0
+	}
+	return float64(o.failures) / float64(o.n)
+}
+
+// observeLatency folds the latency of a loader call into the average.
+func (s *stats) observeLatency(d time.Duration) {
+	for {
+		old := atomic.LoadInt64(&s.latency)
+		avg := int64(d)
+		if old != 0 {
+			avg = old + (int64(d)-old)/5
+		}
+		if atomic.CompareAndSwapInt64(&s.latency, old, avg) {
+			return
+		}
+	}
+}
+
+// errorWindowSize returns the number of loader call outcomes ErrorRate
+// covers.
+func (o *options[K, V]) errorWindowSize() int {
+	if o.errorWindow <= 0 {
+		return defaultErrorWindow
+	}
+	return o.errorWindow
+}
+
+// batchBounds returns the bounds of the batch size histogram.
+func (o *options[K, V]) batchBounds() []int {
+	if o.batchBuckets == nil {
+		return defaultBatchBuckets
+	}
+	return o.batchBuckets
+}
+
+// recordOutcome adds the outcome of a loader call to the error window.
+func (g *Group[K, V]) recordOutcome(err error) {
+	g.stats.outcomes.record(g.opts.errorWindowSize(), err != nil)
+}
+
+// ErrorRate returns the fraction of the recent loader calls that failed,
+// over the window set by WithErrorWindow, e.g. to back off while the
+// backend degrades. It is 0 until the first call.
+func (g *Group[K, V]) ErrorRate() float64 {
+	return g.stats.outcomes.rate()
+}
+
+// Stats returns a snapshot of the group counters, added up over its
+// partitions, see WithContextKeyPartition.
+func (g *Group[K, V]) Stats() Stats {
+	s := Stats{
+		Calls:           atomic.LoadUint64(&g.stats.calls),
+		Keys:            atomic.LoadUint64(&g.stats.keys),
+		SharedKeys:      atomic.LoadUint64(&g.stats.sharedKeys),
+		CacheHits:       atomic.LoadUint64(&g.stats.cacheHits),
+		CacheMisses:     atomic.LoadUint64(&g.stats.cacheMisses),
+		LoadedKeys:      atomic.LoadUint64(&g.stats.loadedKeys),
+		FetchedKeys:     atomic.LoadUint64(&g.stats.fetchedKeys),
+		AttemptedKeys:   atomic.LoadUint64(&g.stats.attemptedKeys),
+		NotFound:        atomic.LoadUint64(&g.stats.notFound),
+		Errors:          atomic.LoadUint64(&g.stats.errors),
+		Waiters:         atomic.LoadInt64(&g.stats.waiters),
+		RejectedWaiters: atomic.LoadUint64(&g.stats.rejectedWaiters),
+		Loads:           atomic.LoadUint64(&g.stats.loads),
+		Hedges:          atomic.LoadUint64(&g.stats.hedges),
+		Shed:            atomic.LoadUint64(&g.stats.shed),
+		LoadLatency:     time.Duration(atomic.LoadInt64(&g.stats.latency)),
+		ErrorRate:       g.ErrorRate(),
+		BatchSizes:      g.stats.batchSizes.histogram(g.opts.batchBounds()),
+	}
+
+	if g.cache != nil {
+		s.Evictions = atomic.LoadUint64(&g.cache.evictions)
+		s.Swept = atomic.LoadUint64(&g.cache.swept)
+	}
+
+	g.withLock(func() {
+		for _, e := range g.m {
+			if n := int64(atomic.LoadInt32(&e.waiters)); n > s.MaxKeyWaiters {
+				s.MaxKeyWaiters = n
+			}
+		}
+	})
+	g.eachPartition(func(p *Group[K, V]) {
+		s.add(p.Stats())
+	})
+	return s
+}
+
+// add adds the counters of p, those of a partition, to s. The current
+// values are averaged over the loader calls of both.
+func (s *Stats) add(p Stats) {
+	if loads := s.Loads + p.Loads; loads > 0 {
+		s.LoadLatency = time.Duration((float64(s.LoadLatency)*float64(s.Loads) + float64(p.LoadLatency)*float64(p.Loads)) / float64(loads))
+		s.ErrorRate = (s.ErrorRate*float64(s.Loads) + p.ErrorRate*float64(p.Loads)) / float64(loads)
+	}
+	for _, n := range [][2]*uint64{
+		{&s.Calls, &p.Calls}, {&s.Keys, &p.Keys}, {&s.SharedKeys, &p.SharedKeys},
+		{&s.CacheHits, &p.CacheHits}, {&s.CacheMisses, &p.CacheMisses},
+		{&s.LoadedKeys, &p.LoadedKeys}, {&s.FetchedKeys, &p.FetchedKeys},
+		{&s.AttemptedKeys, &p.AttemptedKeys}, {&s.NotFound, &p.NotFound},
+		{&s.Errors, &p.Errors}, {&s.RejectedWaiters, &p.RejectedWaiters},
+		{&s.Loads, &p.Loads}, {&s.Hedges, &p.Hedges}, {&s.Shed, &p.Shed},
+		{&s.Evictions, &p.Evictions}, {&s.Swept, &p.Swept},
+	} {
+		*n[0] += *n[1]
+	}
+	s.Waiters += p.Waiters
+	if p.MaxKeyWaiters > s.MaxKeyWaiters {
+		s.MaxKeyWaiters = p.MaxKeyWaiters
+	}
+	for i, n := range p.BatchSizes.Counts {
+		s.BatchSizes.Counts[i] += n
+	}
+	if p.BatchSizes.Max > s.BatchSizes.Max {
+		s.BatchSizes.Max = p.BatchSizes.Max
+	}
+}
+
+// ResetStats sets the counters of Stats back to zero, e.g. to compute
+// DedupRatio over a window. Waiters, MaxKeyWaiters, LoadLatency and
+// ErrorRate, which are current values, are left alone. Collectors
+// exporting Stats as monotonic counters see them reset too.
+func (g *Group[K, V]) ResetStats() {
+	for _, n := range []*uint64{
+		&g.stats.calls, &g.stats.keys, &g.stats.sharedKeys, &g.stats.cacheHits,
+		&g.stats.cacheMisses, &g.stats.loadedKeys, &g.stats.fetchedKeys,
+		&g.stats.attemptedKeys, &g.stats.notFound, &g.stats.errors,
+		&g.stats.rejectedWaiters, &g.stats.loads, &g.stats.hedges, &g.stats.shed,
+	} {
+		atomic.StoreUint64(n, 0)
+	}
+	g.stats.batchSizes.reset()
+	if g.cache != nil {
+		atomic.StoreUint64(&g.cache.evictions, 0)
+		atomic.StoreUint64(&g.cache.swept, 0)
+	}
+	g.eachPartition(func(p *Group[K, V]) {
+		p.ResetStats()
+	})
+}
+
+// KeyWaiters is the number of callers waiting on a key.
+type KeyWaiters[K comparable] struct {
+	Key     K
+	Waiters int
+}
+
+// TopWaiters returns the n keys being loaded with the most callers
+// waiting on them, the most waited on first, e.g. to find a hot key
+// when latency spikes. Stats.Waiters is their total over all keys.
+// TopWaiters returns nil for n <= 0.
+func (g *Group[K, V]) TopWaiters(n int) []KeyWaiters[K] {
+	if n <= 0 {
+		return nil
+	}
+	var top []KeyWaiters[K]
+	g.withLock(func() {
+		top = make([]KeyWaiters[K], 0, len(g.m))
+		for key, e := range g.m {
+			if w := atomic.LoadInt32(&e.waiters); w > 0 {
+				top = append(top, KeyWaiters[K]{Key: key, Waiters: int(w)})
+			}
+		}
+	})
+	sort.Slice(top, func(i, j int) bool { return top[i].Waiters > top[j].Waiters })
+	if len(top) > n {
+		top = top[:n]
+	}
+	return top
+}
@@ -0,0 +1,242 @@
+package multiflight
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorRate(t *testing.T) {
+	errBoom := errors.New("boom")
+	failing := func(ctx context.Context, keys []int) (map[int]string, error) {
+		if keys[0]%4 == 0 {
+			return nil, errBoom
+		}
+		return map[int]string{keys[0]: fmt.Sprint(keys[0])}, nil
+	}
+
+	ast := assert.New(t)
+	g := NewGroup(WithErrorWindow[int, string](100))
+	ast.Equal(0.0, g.ErrorRate())
+
+	// one load in four fails
+	for i := 0; i < 250; i++ {
+		_, _ = g.Do(context.Background(), []int{i}, failing)
+	}
+	ast.InDelta(0.25, g.ErrorRate(), 0.01)
+	ast.InDelta(0.25, g.Stats().ErrorRate, 0.01)
+
+	// failures leave the window as loads succeed again
+	for i := 0; i < 60; i++ {
+		_, err := g.Do(context.Background(), []int{4*i + 1}, failing)
+		ast.Nil(err)
+	}
+	ast.InDelta(0.1, g.ErrorRate(), 0.01)
+	for i := 0; i < 40; i++ {
+		_, err := g.Do(context.Background(), []int{4*i + 2}, failing)
+		ast.Nil(err)
+	}
+	ast.Equal(0.0, g.ErrorRate())
+}
+
+func TestStatsCounters(t *testing.T) {
+	errBoom := errors.New("boom")
+	release := make(chan struct{})
+	loader := func(ctx context.Context, keys []int) (map[int]string, error) {
+		results := make(map[int]string, len(keys))
+		for _, k := range keys {
+			switch k {
+			case 3:
+				continue // not found
+			case 5:
+				<-release
+			case 6:
+				return nil, errBoom
+			}
+			results[k] = fmt.Sprint(k)
+		}
+		return results, nil
+	}
+
+	ast := assert.New(t)
+	g := NewGroup(WithTTL[int, string](time.Minute))
+
+	_, err := g.Do(context.Background(), []int{1, 2, 3}, loader)
+	ast.Nil(err)
+	_, err = g.Do(context.Background(), []int{1, 2}, loader)
+	ast.Nil(err)
+
+	errs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			_, err := g.Do(context.Background(), []int{5}, loader)
+			errs <- err
+		}()
+		ast.Eventually(func() bool { return g.Stats().Waiters == int64(i+1) }, time.Second, time.Millisecond)
+	}
+	close(release)
+	ast.Nil(<-errs)
+	ast.Nil(<-errs)
+
+	_, err = g.Do(context.Background(), []int{6}, loader)
+	ast.ErrorIs(err, errBoom)
+
+	s := g.Stats()
+	s.LoadLatency = 0
+	ast.Equal(Stats{
+		Calls:         5,
+		Keys:          8,
+		SharedKeys:    1,
+		CacheHits:     2,
+		CacheMisses:   5, // the keys but hits and shared ones
+		LoadedKeys:    3,
+		FetchedKeys:   5,
+		AttemptedKeys: 5,
+		NotFound:      1,
+		Errors:        1,
+		Loads:         3,
+		ErrorRate:     1.0 / 3,
+		BatchSizes: BatchHistogram{
+			Bounds: DefaultBatchBuckets(),
+			Counts: []uint64{2, 0, 1, 0, 0, 0, 0, 0, 0, 0, 0, 0},
+			Max:    3,
+		},
+	}, s)
+}
+
+func TestBatchSizes(t *testing.T) {
+	loader := func(ctx context.Context, keys []int) (map[int]string, error) {
+		return nil, nil
+	}
+
+	ast := assert.New(t)
+	g := NewGroup(WithBatchBuckets[int, string](1, 2, 4, 8))
+	ast.Equal(0, g.Stats().BatchSizes.Quantile(0.5))
+	for _, n := range []int{1, 3, 3, 10} {
+		keys := make([]int, n)
+		for i := range keys {
+			keys[i] = i
+		}
+		_, err := g.Do(context.Background(), keys, loader)
+		ast.Nil(err)
+	}
+
+	h := g.Stats().BatchSizes
+	ast.Equal(BatchHistogram{Bounds: []int{1, 2, 4, 8}, Counts: []uint64{1, 0, 2, 0, 1}, Max: 10}, h)
+	ast.Equal(1, h.Quantile(0))
+	ast.Equal(1, h.Quantile(0.25))
+	ast.Equal(4, h.Quantile(0.5))
+	ast.Equal(4, h.Quantile(0.75))
+	ast.Equal(10, h.Quantile(0.99))
+
+	// the bounds are copies
+	h.Bounds[0] = 100
+	ast.Equal([]int{1, 2, 4, 8}, g.Stats().BatchSizes.Bounds)
+	DefaultBatchBuckets()[0] = 100
+	ast.Equal(1, DefaultBatchBuckets()[0])
+}
+
+func TestDedupRatio(t *testing.T) {
+	errBoom := errors.New("boom")
+	var attempts int32
+	loader := func(ctx context.Context, keys []int) (map[int]string, error) {
+		if atomic.AddInt32(&attempts, 1) == 1 {
+			return nil, errBoom
+		}
+		vals := make(map[int]string, len(keys))
+		for _, k := range keys {
+			vals[k] = fmt.Sprint(k)
+		}
+		return vals, nil
+	}
+
+	ast := assert.New(t)
+	g := NewGroup(
+		WithTTL[int, string](time.Minute),
+		WithMaxBatchSize[int, string](2),
+		WithRetry[int, string](2, func(int) time.Duration { return 0 }, nil),
+	)
+	ast.Equal(0.0, g.Stats().DedupRatio())
+
+	// the failed attempt is counted apart from the keys fetched
+	_, err := g.Do(context.Background(), []int{1, 2, 3, 4}, loader)
+	ast.Nil(err)
+	_, err = g.Do(context.Background(), []int{1, 2, 3, 4, 1, 2, 3, 4}, loader)
+	ast.Nil(err)
+	s := g.Stats()
+	ast.Equal(uint64(12), s.Keys)
+	ast.Equal(uint64(4), s.FetchedKeys)
+	ast.Equal(uint64(6), s.AttemptedKeys)
+	ast.Equal(uint64(4), s.LoadedKeys)
+	ast.Equal(3.0, s.DedupRatio())
+
+	// a new window
+	g.ResetStats()
+	s = g.Stats()
+	ast.Equal(Stats{
+		LoadLatency: s.LoadLatency,
+		ErrorRate:   1.0 / 3, // current values are left alone
+		BatchSizes:  BatchHistogram{Bounds: DefaultBatchBuckets(), Counts: make([]uint64, 12)},
+	}, s)
+	_, err = g.Do(context.Background(), []int{1, 5}, loader)
+	ast.Nil(err)
+	ast.Equal(2.0, g.Stats().DedupRatio())
+	_, err = g.Do(context.Background(), []int{1}, loader)
+	ast.Nil(err)
+	ast.Equal(3.0, g.Stats().DedupRatio())
+	g.ResetStats()
+	_, err = g.Do(context.Background(), []int{1}, loader)
+	ast.Nil(err)
+	ast.True(math.IsInf(g.Stats().DedupRatio(), 1))
+}
+
+func TestTopWaiters(t *testing.T) {
+	errBoom := errors.New("boom")
+	release := make(chan struct{})
+	loader := func(ctx context.Context, keys []int) (map[int]string, error) {
+		<-release
+		if keys[0] == 3 {
+			return nil, errBoom
+		}
+		return map[int]string{keys[0]: fmt.Sprint(keys[0])}, nil
+	}
+
+	ast := assert.New(t)
+	g := NewGroup(WithMaxBatchSize[int, string](1))
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error, 7)
+	call := func(ctx context.Context, keys ...int) {
+		go func() {
+			_, err := g.Do(ctx, keys, loader)
+			errs <- err
+		}()
+	}
+	call(context.Background(), 1, 2, 3)
+	ast.Eventually(func() bool { return g.Len() == 3 }, time.Second, time.Millisecond)
+	call(ctx, 2, 3)
+	call(ctx, 3)
+	call(context.Background(), 3)
+	call(context.Background(), 3)
+	call(context.Background(), 2)
+	ast.Eventually(func() bool { return g.Stats().Waiters == 9 }, time.Second, time.Millisecond)
+	ast.Equal([]KeyWaiters[int]{{Key: 3, Waiters: 5}, {Key: 2, Waiters: 3}}, g.TopWaiters(2))
+	ast.Nil(g.TopWaiters(0))
+	ast.Nil(g.TopWaiters(-1))
+
+	// callers giving up and failing leave their keys
+	cancel()
+	ast.Eventually(func() bool { return g.Stats().Waiters == 6 }, time.Second, time.Millisecond)
+	ast.Equal([]KeyWaiters[int]{{Key: 3, Waiters: 3}, {Key: 2, Waiters: 2}, {Key: 1, Waiters: 1}}, g.TopWaiters(5))
+	close(release)
+	for i := 0; i < 6; i++ {
+		<-errs
+	}
+	ast.Empty(g.TopWaiters(5))
+	ast.Equal(int64(0), g.Stats().Waiters)
+}
@@ -0,0 +1,140 @@
+package multiflight
+
+import (
+	"context"
+	"sync"
+)
+
+// Cache is an external store of loaded values, e.g. an in-process LRU
+// already used by the application. Get returns the values of the keys
+// it has, Set stores values and Delete drops keys. A Cache must be safe
+// for concurrent use.
+type Cache[K comparable, V any] interface {
+	Get(ctx context.Context, keys []K) (map[K]V, error)
+	Set(ctx context.Context, vals map[K]V)
+	Delete(ctx context.Context, keys []K)
+}
+
+// WithCache makes the group read through and write through c: Do serves
+// the keys c has without loading them, loads only the others, and then
+// stores the loaded values in c. A failing Get is treated as a miss of
+// every key. DoRefresh skips Get, and Forget deletes the keys from c.
+func WithCache[K comparable, V any](c Cache[K, V]) Option[K, V] {
+	return func(o *options[K, V]) {
+		o.store = c
+	}
+}
+
+// WithCacheTiers is WithCache with a two-tier cache: the keys local
+// doesn't have are fetched from remote in one Get, whose hits are then
+// copied to local, and loaded values are stored in both tiers. A failing
+// tier is treated as a miss of every key, so a remote outage degrades
+// to loading rather than failing calls.
+func WithCacheTiers[K comparable, V any](local, remote Cache[K, V]) Option[K, V] {
+	return WithCache[K, V](&tieredCache[K, V]{local: local, remote: remote})
+}
+
+// tieredCache is a Cache reading through local to remote.
+type tieredCache[K comparable, V any] struct {
+	local  Cache[K, V]
+	remote Cache[K, V]
+}
+
+func (c *tieredCache[K, V]) Get(ctx context.Context, keys []K) (map[K]V, error) {
+	vals, err := c.local.Get(ctx, keys)
+	if err != nil || vals == nil {
+		vals = make(map[K]V, len(keys))
+	}
+	misses := make([]K, 0, len(keys))
+	for _, key := range keys {
+		if _, has := vals[key]; !has {
+			misses = append(misses, key)
+		}
+	}
+	if len(misses) == 0 {
+		return vals, nil
+	}
+
+	remote, err := c.remote.Get(ctx, misses)
+	if err != nil || len(remote) == 0 {
+		return vals, nil
+	}
+	c.local.Set(ctx, remote)
+	for k, v := range remote {
+		vals[k] = v
+	}
+	return vals, nil
+}
+
+func (c *tieredCache[K, V]) Set(ctx context.Context, vals map[K]V) {
+	c.local.Set(ctx, vals)
+	c.remote.Set(ctx, vals)
+}
+
+func (c *tieredCache[K, V]) Delete(ctx context.Context, keys []K) {
+	c.local.Delete(ctx, keys)
+	c.remote.Delete(ctx, keys)
+}
+
+// MemoryCache is a Cache keeping values in a map, without expiry or a
+// size bound.
+type MemoryCache[K comparable, V any] struct {
+	mu   sync.RWMutex
+	vals map[K]V
+}
+
+// NewMemoryCache returns an empty MemoryCache.
+func NewMemoryCache[K comparable, V any]() *MemoryCache[K, V] {
+	return &MemoryCache[K, V]{vals: make(map[K]V)}
+}
+
+// Get returns the stored values of keys.
+func (c *MemoryCache[K, V]) Get(ctx context.Context, keys []K) (map[K]V, error) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	vals := make(map[K]V, len(keys))
+	for _, key := range keys {
+		if v, has := c.vals[key]; has {
+			vals[key] = v
+		}
+	}
+	return vals, nil
+}
+
+// Set stores vals.
+func (c *MemoryCache[K, V]) Set(ctx context.Context, vals map[K]V) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for k, v := range vals {
+		c.vals[k] = v
+	}
+}
+
+// Delete drops keys.
+func (c *MemoryCache[K, V]) Delete(ctx context.Context, keys []K) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, key := range keys {
+		delete(c.vals, key)
+	}
+}
+
+// lookup serves keys from the external cache, returning the values it
+// has and the keys that are left to load.
+func (g *Group[K, V]) lookup(ctx context.Context, keys []K) (map[K]V, []K) {
+	vals, err := g.opts.store.Get(ctx, keys)
+	if err != nil || len(vals) == 0 {
+		return nil, keys
+	}
+
+	misses := make([]K, 0, len(keys))
+	for _, key := range keys {
+		if _, has := vals[key]; !has {
+			misses = append(misses, key)
+		}
+	}
+	return vals, misses
+}
@@ -0,0 +1,199 @@
+package multiflight
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// failingCache is a Cache whose Get fails while failing is set.
+type failingCache struct {
+	*MemoryCache[int, string]
+	failing int32
+}
+
+func (c *failingCache) Get(ctx context.Context, keys []int) (map[int]string, error) {
+	if atomic.LoadInt32(&c.failing) == 1 {
+		return nil, errors.New("cache down")
+	}
+	return c.MemoryCache.Get(ctx, keys)
+}
+
+func TestWithCache(t *testing.T) {
+	var version, loaded int32
+	loader := countingLoader(&version, &loaded)
+
+	ast := assert.New(t)
+	store := NewMemoryCache[int, string]()
+	store.Set(context.Background(), map[int]string{1: "cached: 1"})
+	g := NewGroup(WithCache[int, string](store))
+
+	// only the miss is loaded, and then written to the cache
+	results, err := g.Do(context.Background(), []int{1, 2}, loader)
+	ast.Nil(err)
+	ast.Equal(map[int]string{1: "cached: 1", 2: "val: 2 v0"}, results)
+	ast.Equal(int32(1), atomic.LoadInt32(&loaded))
+	vals, _ := store.Get(context.Background(), []int{1, 2})
+	ast.Equal(map[int]string{1: "cached: 1", 2: "val: 2 v0"}, vals)
+
+	results, err = g.Do(context.Background(), []int{1, 2}, loader)
+	ast.Nil(err)
+	ast.Equal(map[int]string{1: "cached: 1", 2: "val: 2 v0"}, results)
+	ast.Equal(int32(1), atomic.LoadInt32(&loaded))
+
+	// DoRefresh loads every key and replaces the cached values
+	atomic.StoreInt32(&version, 1)
+	results, err = g.DoRefresh(context.Background(), []int{1, 2}, loader)
+	ast.Nil(err)
+	ast.Equal(map[int]string{1: "val: 1 v1", 2: "val: 2 v1"}, results)
+	vals, _ = store.Get(context.Background(), []int{1, 2})
+	ast.Equal(results, vals)
+
+	// Forget deletes from the cache
+	g.Forget(1)
+	vals, _ = store.Get(context.Background(), []int{1, 2})
+	ast.Equal(map[int]string{2: "val: 2 v1"}, vals)
+}
+
+func TestWithCacheGetError(t *testing.T) {
+	var version, loaded int32
+	loader := countingLoader(&version, &loaded)
+
+	ast := assert.New(t)
+	store := &failingCache{MemoryCache: NewMemoryCache[int, string](), failing: 1}
+	store.MemoryCache.Set(context.Background(), map[int]string{1: "cached: 1"})
+	g := NewGroup(WithCache[int, string](store))
+
+	// a failing cache is a miss, not an error
+	results, err := g.Do(context.Background(), []int{1, 2}, loader)
+	ast.Nil(err)
+	ast.Equal(map[int]string{1: "val: 1 v0", 2: "val: 2 v0"}, results)
+	ast.Equal(int32(2), atomic.LoadInt32(&loaded))
+
+	atomic.StoreInt32(&store.failing, 0)
+	results, err = g.Do(context.Background(), []int{1, 2}, loader)
+	ast.Nil(err)
+	ast.Equal(map[int]string{1: "val: 1 v0", 2: "val: 2 v0"}, results)
+	ast.Equal(int32(2), atomic.LoadInt32(&loaded))
+}
+
+// countingCache is a Cache counting the keys asked and found.
+type countingCache struct {
+	*failingCache
+	asked, hits int32
+}
+
+func newCountingCache() *countingCache {
+	return &countingCache{failingCache: &failingCache{MemoryCache: NewMemoryCache[int, string]()}}
+}
+
+func (c *countingCache) Get(ctx context.Context, keys []int) (map[int]string, error) {
+	atomic.AddInt32(&c.asked, int32(len(keys)))
+	vals, err := c.failingCache.Get(ctx, keys)
+	atomic.AddInt32(&c.hits, int32(len(vals)))
+	return vals, err
+}
+
+func TestCacheTiers(t *testing.T) {
+	var version, loaded int32
+	loader := countingLoader(&version, &loaded)
+
+	ast := assert.New(t)
+	local, remote := newCountingCache(), newCountingCache()
+	remote.Set(context.Background(), map[int]string{2: "remote: 2"})
+	local.Set(context.Background(), map[int]string{1: "local: 1"})
+	g := NewGroup(WithCacheTiers[int, string](local, remote))
+
+	// remote is only asked for the local misses, and only the keys in
+	// neither are loaded
+	results, err := g.Do(context.Background(), []int{1, 2, 3}, loader)
+	ast.Nil(err)
+	ast.Equal(map[int]string{1: "local: 1", 2: "remote: 2", 3: "val: 3 v0"}, results)
+	ast.Equal(int32(1), atomic.LoadInt32(&loaded))
+	ast.Equal([]int32{3, 1}, []int32{local.asked, local.hits})
+	ast.Equal([]int32{2, 1}, []int32{remote.asked, remote.hits})
+
+	// remote hits and loaded values are in both tiers now
+	results, err = g.Do(context.Background(), []int{1, 2, 3}, loader)
+	ast.Nil(err)
+	ast.Equal(map[int]string{1: "local: 1", 2: "remote: 2", 3: "val: 3 v0"}, results)
+	ast.Equal([]int32{6, 4}, []int32{local.asked, local.hits})
+	ast.Equal([]int32{2, 1}, []int32{remote.asked, remote.hits})
+	vals, _ := remote.Get(context.Background(), []int{3})
+	ast.Equal(map[int]string{3: "val: 3 v0"}, vals)
+
+	// a failing remote is a miss
+	atomic.StoreInt32(&remote.failing, 1)
+	results, err = g.Do(context.Background(), []int{3, 4}, loader)
+	ast.Nil(err)
+	ast.Equal(map[int]string{3: "val: 3 v0", 4: "val: 4 v0"}, results)
+	ast.Equal(int32(2), atomic.LoadInt32(&loaded))
+
+	// Forget deletes from both tiers
+	g.Forget(2)
+	vals, _ = local.Get(context.Background(), []int{2})
+	ast.Empty(vals)
+	atomic.StoreInt32(&remote.failing, 0)
+	vals, _ = remote.Get(context.Background(), []int{2})
+	ast.Empty(vals)
+}
+
+func TestWithCacheInvalidateInFlight(t *testing.T) {
+	var version, loaded int32
+	loader := countingLoader(&version, &loaded)
+	release := make(chan struct{})
+	slow := func(ctx context.Context, keys []int) (map[int]string, error) {
+		<-release
+		return loader(ctx, keys)
+	}
+
+	ast := assert.New(t)
+	store := NewMemoryCache[int, string]()
+	g := NewGroup(WithCache[int, string](store))
+
+	// a load in flight doesn't write back what Invalidate deleted
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		results, err := g.Do(context.Background(), []int{1}, slow)
+		ast.Nil(err)
+		ast.Equal(map[int]string{1: "val: 1 v0"}, results)
+	}()
+	ast.Eventually(func() bool { return g.InFlight(1) }, time.Second, time.Millisecond)
+	g.Invalidate(1)
+	close(release)
+	<-done
+	vals, _ := store.Get(context.Background(), []int{1})
+	ast.Empty(vals)
+}
+
+func TestWithCacheSetInFlight(t *testing.T) {
+	var version, loaded int32
+	loader := countingLoader(&version, &loaded)
+	release := make(chan struct{})
+	slow := func(ctx context.Context, keys []int) (map[int]string, error) {
+		<-release
+		return loader(ctx, keys)
+	}
+
+	ast := assert.New(t)
+	store := NewMemoryCache[int, string]()
+	g := NewGroup(WithCache[int, string](store))
+
+	// a load in flight doesn't overwrite what Set stored
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		g.Do(context.Background(), []int{1}, slow)
+	}()
+	ast.Eventually(func() bool { return g.InFlight(1) }, time.Second, time.Millisecond)
+	g.Set(1, "set")
+	close(release)
+	<-done
+	vals, _ := store.Get(context.Background(), []int{1})
+	ast.Equal(map[int]string{1: "set"}, vals)
+}
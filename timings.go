@@ -0,0 +1,61 @@
+package multiflight
+
+import (
+	"context"
+	"time"
+)
+
+// Timings breaks down where a call spent its time.
+type Timings struct {
+	// LockWait is the time spent acquiring the group lock to register
+	// the keys.
+	LockWait time.Duration
+	// Load is the time spent loading the keys the call started loading.
+	Load time.Duration
+	// FollowerWait is the time spent waiting for keys other callers
+	// were loading.
+	FollowerWait time.Duration
+}
+
+// DoTimed is like Do but also returns where the call spent its time, for
+// callers to sample when debugging latency. Do doesn't measure anything.
+func (g *Group[K, V]) DoTimed(ctx context.Context, keys []K, load Loader[K, V], opts ...CallOption) (map[K]V, Timings, error) {
+	co := newCallOptions(opts)
+	load = g.loaderOf(load, &co)
+	co.timings = new(Timings)
+	result, _, err := g.doCall(ctx, keys, load.batch(), co)
+	return result, *co.timings, err
+}
+
+// CallStats tells where the keys of a call came from.
+type CallStats struct {
+	// CacheHits is the number of keys served from the caches.
+	CacheHits int
+	// SharedKeys is the number of keys that joined loads in flight.
+	SharedKeys int
+	// LoadedKeys is the number of keys the call loaded itself.
+	LoadedKeys int
+	// Slowest is how long the call waited for its slowest key.
+	Slowest time.Duration
+	// BatchIDs are the IDs of the loader calls that completed the keys
+	// of the call, its own and those it joined, see BatchIDFromContext.
+	BatchIDs []uint64
+}
+
+// DoStats is like Do but also returns where the keys of the call came
+// from, e.g. to log per request. Do doesn't count anything.
+func (g *Group[K, V]) DoStats(ctx context.Context, keys []K, load Loader[K, V], opts ...CallOption) (map[K]V, CallStats, error) {
+	co := newCallOptions(opts)
+	load = g.loaderOf(load, &co)
+	co.stats = new(CallStats)
+	result, _, err := g.doCall(ctx, keys, load.batch(), co)
+	return result, *co.stats, err
+}
+
+// now returns the current time if t is measured.
+func (t *Timings) now() time.Time {
+	if t == nil {
+		return time.Time{}
+	}
+	return time.Now()
+}
@@ -0,0 +1,84 @@
+package multiflight
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDoTimed(t *testing.T) {
+	release := make(chan struct{})
+	loader := func(ctx context.Context, keys []int) (map[int]string, error) {
+		<-release
+		time.Sleep(time.Millisecond * 20)
+		return map[int]string{1: "val: 1"}, nil
+	}
+
+	ast := assert.New(t)
+	g := NewGroup[int, string]()
+
+	leader := make(chan Timings)
+	go func() {
+		_, tm, err := g.DoTimed(context.Background(), []int{1}, loader)
+		ast.Nil(err)
+		leader <- tm
+	}()
+	ast.Eventually(func() bool { return g.Len() == 1 }, time.Second, time.Millisecond)
+	go func() {
+		ast.Eventually(func() bool { return g.Stats().Waiters == 2 }, time.Second, time.Millisecond)
+		close(release)
+	}()
+
+	results, tm, err := g.DoTimed(context.Background(), []int{1}, loader)
+	ast.Nil(err)
+	ast.Equal(map[int]string{1: "val: 1"}, results)
+	ast.Zero(tm.Load)
+	ast.GreaterOrEqual(tm.FollowerWait, time.Millisecond*20)
+
+	tm = <-leader
+	ast.GreaterOrEqual(tm.Load, time.Millisecond*20)
+	ast.Zero(tm.FollowerWait)
+}
+
+func TestDoStats(t *testing.T) {
+	release := make(chan struct{})
+	loader := func(ctx context.Context, keys []int) (map[int]string, error) {
+		<-release
+		time.Sleep(time.Millisecond * 20)
+		results := make(map[int]string, len(keys))
+		for _, k := range keys {
+			results[k] = "val"
+		}
+		return results, nil
+	}
+
+	ast := assert.New(t)
+	g := NewGroup(WithTTL[int, string](time.Minute))
+	g.Set(1, "cached")
+
+	leader := make(chan CallStats, 1)
+	go func() {
+		_, cs, err := g.DoStats(context.Background(), []int{1, 2, 3}, loader)
+		ast.Nil(err)
+		leader <- cs
+	}()
+	ast.Eventually(func() bool { return g.Len() == 2 }, time.Second, time.Millisecond)
+	go func() {
+		ast.Eventually(func() bool { return g.Stats().Waiters == 4 }, time.Second, time.Millisecond)
+		close(release)
+	}()
+
+	results, cs, err := g.DoStats(context.Background(), []int{1, 2, 4}, loader)
+	ast.Nil(err)
+	ast.Len(results, 3)
+	ast.Equal(1, cs.CacheHits)
+	ast.Equal(1, cs.SharedKeys)
+	ast.Equal(1, cs.LoadedKeys)
+	ast.GreaterOrEqual(cs.Slowest, time.Millisecond*20)
+
+	cs = <-leader
+	ast.Equal(CallStats{CacheHits: 1, LoadedKeys: 2, Slowest: cs.Slowest, BatchIDs: cs.BatchIDs}, cs)
+	ast.GreaterOrEqual(cs.Slowest, time.Millisecond*20)
+}
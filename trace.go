@@ -0,0 +1,81 @@
+package multiflight
+
+import (
+	"context"
+	"time"
+)
+
+// Tracer traces the loader calls of a group and the calls waiting for
+// loads of other callers, see WithTracer. Its methods may be called from
+// many goroutines at once. Package multiflightotel implements it with
+// OpenTelemetry.
+type Tracer interface {
+	// StartLoad is called before every loader call, with the number of
+	// its keys and the index of its chunk in the batch, see
+	// WithMaxBatchSize. It returns the context to call the loader with
+	// and a function called with the error of the call once it returns.
+	StartLoad(ctx context.Context, keys, chunk int) (context.Context, func(err error))
+	// Waited is called once a call is done waiting for keys loaded by
+	// other callers, with the time it started waiting, the number of
+	// these keys and the contexts StartLoad returned for their loads.
+	Waited(ctx context.Context, start time.Time, keys int, loads []context.Context)
+}
+
+// WithTracer traces the loads of the group with t.
+func WithTracer[K comparable, V any](t Tracer) Option[K, V] {
+	return func(o *options[K, V]) {
+		o.tracer = t
+	}
+}
+
+// loadTrace is a traced loader call.
+type loadTrace struct {
+	ctx context.Context
+}
+
+// traceLoad starts tracing the loader call of ents, recording it in the
+// entries for the callers waiting on them, and returns the context to
+// call the loader with and the function ending the trace.
+func (g *Group[K, V]) traceLoad(ctx context.Context, t Tracer, chunk int, ents []*ent[K, V]) (context.Context, func(error)) {
+	ctx, end := t.StartLoad(ctx, len(ents), chunk)
+	lt := &loadTrace{ctx: ctx}
+	g.withLock(func() {
+		for _, e := range ents {
+			if !e.completed { // by ForgetAll
+				e.trace = lt
+			}
+		}
+	})
+	return ctx, end
+}
+
+// traceWait reports to t the loads of other callers the call c waited
+// for since start.
+func (g *Group[K, V]) traceWait(ctx context.Context, t Tracer, c *call[K, V], start time.Time) {
+	own := make(map[*ent[K, V]]struct{}, len(c.missEnts))
+	for _, e := range c.missEnts {
+		own[e] = struct{}{}
+	}
+
+	var (
+		keys  int
+		loads []context.Context
+		seen  = make(map[*loadTrace]struct{})
+	)
+	for _, e := range c.ents {
+		if _, leader := own[e]; leader {
+			continue
+		}
+		keys++
+		select {
+		case <-e.done:
+		default:
+			continue // the call stopped waiting before the load returned
+		}
+		if _, has := seen[e.trace]; e.trace != nil && !has {
+			seen[e.trace] = struct{}{}
+			loads = append(loads, e.trace.ctx)
+		}
+	}
+	t.Waited(ctx, start, keys, loads)
+}
@@ -0,0 +1,97 @@
+package multiflight
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type chunkKey struct{}
+
+type traced struct {
+	keys, chunk int
+	err         error
+}
+
+type waited struct {
+	keys   int
+	chunks []int
+}
+
+// recordingTracer records the traces in calls order.
+type recordingTracer struct {
+	mu    sync.Mutex
+	loads []traced
+	waits []waited
+}
+
+func (t *recordingTracer) StartLoad(ctx context.Context, keys, chunk int) (context.Context, func(err error)) {
+	return context.WithValue(ctx, chunkKey{}, chunk), func(err error) {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		t.loads = append(t.loads, traced{keys: keys, chunk: chunk, err: err})
+	}
+}
+
+func (t *recordingTracer) Waited(ctx context.Context, start time.Time, keys int, loads []context.Context) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	w := waited{keys: keys}
+	for _, l := range loads {
+		w.chunks = append(w.chunks, l.Value(chunkKey{}).(int))
+	}
+	t.waits = append(t.waits, w)
+}
+
+func TestTracer(t *testing.T) {
+	errBoom := errors.New("boom")
+	release := make(chan struct{})
+	loader := func(ctx context.Context, keys []int) (map[int]string, error) {
+		<-release
+		vals := make(map[int]string, len(keys))
+		for _, k := range keys {
+			if k == 3 {
+				return nil, errBoom
+			}
+			vals[k] = fmt.Sprint(ctx.Value(chunkKey{}))
+		}
+		return vals, nil
+	}
+
+	ast := assert.New(t)
+	tracer := &recordingTracer{}
+	g := NewGroup(WithTracer[int, string](tracer), WithMaxBatchSize[int, string](2))
+	leader := make(chan error)
+	go func() {
+		_, err := g.Do(context.Background(), []int{1, 2, 3}, loader)
+		leader <- err
+	}()
+	ast.Eventually(func() bool { return g.Len() == 3 }, time.Second, time.Millisecond)
+	follower := make(chan error)
+	go func() {
+		_, err := g.Do(context.Background(), []int{1, 2, 4}, loader)
+		follower <- err
+	}()
+	ast.Eventually(func() bool { return g.Stats().Waiters == 6 }, time.Second, time.Millisecond)
+	close(release)
+	ast.ErrorIs(<-leader, errBoom)
+	ast.Nil(<-follower)
+
+	// the loader calls are traced by chunk, and the follower waited for
+	// the load of the first chunk of the leader
+	ast.ElementsMatch([]traced{
+		{keys: 2, chunk: 0},
+		{keys: 1, chunk: 1, err: errBoom},
+		{keys: 1, chunk: 0},
+	}, tracer.loads)
+	ast.Equal([]waited{{keys: 2, chunks: []int{0}}}, tracer.waits)
+	vals, err := g.Do(context.Background(), []int{5}, loader)
+	ast.Nil(err)
+	ast.Equal(map[int]string{5: "0"}, vals) // the loader got the traced context
+	ast.Len(tracer.waits, 1)                // a call loading its own keys didn't wait
+}
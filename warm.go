@@ -0,0 +1,100 @@
+package multiflight
+
+import (
+	"context"
+)
+
+// WarmReport counts what Warm did with the keys it was given.
+type WarmReport struct {
+	// Loaded counts the keys loaded and cached.
+	Loaded int
+	// Present counts the keys that were cached already.
+	Present int
+	// Missing counts the keys the loader reported missing.
+	Missing int
+	// Failed counts the keys of the loads that failed.
+	Failed int
+}
+
+// WarmOption configures a call to Warm.
+type WarmOption func(*warmOptions)
+
+type warmOptions struct {
+	chunk    int
+	progress func(done, total int)
+}
+
+// WithWarmChunk makes Warm load n keys at a time, 100 by default, and
+// no more than WithMaxBatchSize allows.
+func WithWarmChunk(n int) WarmOption {
+	return func(o *warmOptions) {
+		o.chunk = n
+	}
+}
+
+// WithWarmProgress calls progress after every chunk Warm loads with the
+// number of keys done so far and the total number of keys.
+func WithWarmProgress(progress func(done, total int)) WarmOption {
+	return func(o *warmOptions) {
+		o.progress = progress
+	}
+}
+
+// Warm loads the keys that aren't cached yet into the cache, e.g. the
+// known hot keys before taking traffic. It loads them a chunk at a time
+// like Do would, so other calls keep being served meanwhile and the
+// group options apply, and carries on when a chunk fails, returning the
+// first error along with the report. Warm is only useful with a cache.
+func (g *Group[K, V]) Warm(ctx context.Context, keys []K, load Loader[K, V], opts ...WarmOption) (WarmReport, error) {
+	o := warmOptions{chunk: 100}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.chunk <= 0 {
+		o.chunk = len(keys)
+	}
+	if size := g.opts.maxBatchSize; size > 0 && o.chunk > size {
+		// a chunk per loader call, so that a failing call only fails
+		// its own keys
+		o.chunk = size
+	}
+
+	var (
+		report   WarmReport
+		firstErr error
+	)
+	for done := 0; done < len(keys); {
+		chunk := keys[done:]
+		if len(chunk) > o.chunk {
+			chunk = chunk[:o.chunk]
+		}
+		done += len(chunk)
+
+		_, misses := g.TryDo(ctx, chunk)
+		report.Present += len(chunk) - len(misses)
+		if len(misses) > 0 {
+			results, err := g.Do(ctx, misses, load)
+			if err != nil {
+				report.Failed += len(misses)
+				if firstErr == nil {
+					firstErr = err
+				}
+			} else {
+				report.Loaded += len(results)
+				report.Missing += len(misses) - len(results)
+			}
+		}
+
+		if o.progress != nil {
+			o.progress(done, len(keys))
+		}
+		if ctx.Err() != nil {
+			report.Failed += len(keys) - done
+			if firstErr == nil {
+				firstErr = ctx.Err()
+			}
+			break
+		}
+	}
+	return report, firstErr
+}
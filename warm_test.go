@@ -0,0 +1,65 @@
+package multiflight
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWarm(t *testing.T) {
+	errBoom := errors.New("boom")
+	var loaded int32
+	loader := func(ctx context.Context, keys []int) (map[int]string, error) {
+		atomic.AddInt32(&loaded, int32(len(keys)))
+		resuts := make(map[int]string, len(keys))
+		for _, k := range keys {
+			switch {
+			case k == 9:
+				return nil, errBoom
+			case k%4 != 0:
+				resuts[k] = fmt.Sprintf("val: %d", k)
+			}
+		}
+		return resuts, nil
+	}
+
+	ast := assert.New(t)
+	g := NewGroup(WithTTL[int, string](time.Minute))
+	g.Set(1, "val: 1")
+	g.Set(2, "val: 2")
+
+	var progress []int
+	report, err := g.Warm(context.Background(), []int{1, 2, 3, 4, 5, 6, 7, 8, 9}, loader,
+		WithWarmChunk(3),
+		WithWarmProgress(func(done, total int) {
+			ast.Equal(9, total)
+			progress = append(progress, done)
+		}),
+	)
+	ast.ErrorIs(err, errBoom)
+	ast.Equal(WarmReport{Loaded: 3, Present: 2, Missing: 1, Failed: 3}, report)
+	ast.Equal([]int{3, 6, 9}, progress)
+
+	// warmed keys are served from the cache
+	atomic.StoreInt32(&loaded, 0)
+	results, err := g.Do(context.Background(), []int{3, 5, 6}, loader)
+	ast.Nil(err)
+	ast.Len(results, 3)
+	ast.Equal(int32(0), atomic.LoadInt32(&loaded))
+
+	// chunks are split like loader calls
+	var calls int32
+	g = NewGroup(WithTTL[int, string](time.Minute), WithMaxBatchSize[int, string](2))
+	report, err = g.Warm(context.Background(), []int{1, 2, 3, 5, 9, 10}, func(ctx context.Context, keys []int) (map[int]string, error) {
+		atomic.AddInt32(&calls, 1)
+		return loader(ctx, keys)
+	})
+	ast.ErrorIs(err, errBoom)
+	ast.Equal(WarmReport{Loaded: 4, Failed: 2}, report)
+	ast.Equal(int32(3), atomic.LoadInt32(&calls))
+}